@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/jdavasligil/sandbox/grid"
+	"github.com/jdavasligil/sandbox/render"
+	"github.com/jdavasligil/sandbox/sim"
+)
+
+// API serves HTTP endpoints for driving the simulation from other programs:
+//
+//	POST /spawn     {"x", "y", "r", "material", "vx", "vy"} fills a disc,
+//	                or a single cell if r is 0
+//	POST /clear     {"x", "y", "w", "h"} erases a region, or everything
+//	                if the body is empty
+//	POST /pause     freezes physics
+//	POST /resume    unfreezes it
+//	GET  /gravity   {"gravity"} in px/s/s
+//	PUT  /gravity   {"gravity"} sets it
+//	GET  /stats     the counts of APIStats
+//	GET  /stream    a WebSocket of the grid, described by Stream
+//	GET  /          a page watching the stream
+//
+// POST and PUT requests must be sent as Content-Type application/json, even
+// those without a body. A web page can only send that to another site once
+// a CORS preflight allows it, which the API never does, so pages the user
+// visits cannot drive a local sandbox. A spawn must land on the grid with r
+// from 0 to MAXRADIUS, and gravity must be finite.
+//
+// Requests are carried out between ticks by the "api" system, so they see
+// and leave the world as a tick does. They are not recorded by -record.
+type API struct {
+	cmds chan func(*sim.Simulation)
+}
+
+// APIStats are the counts returned by GET /stats.
+type APIStats struct {
+	Tick      uint64  `json:"tick"`
+	Paused    bool    `json:"paused"`
+	Gravity   float32 `json:"gravity"`
+	Particles int     `json:"particles"`
+	Falling   int     `json:"falling"`
+	Resting   int     `json:"resting"` // cells of resting particles and walls
+}
+
+type spawnRequest struct {
+	X        int     `json:"x"`
+	Y        int     `json:"y"`
+	R        int     `json:"r"`
+	Material string  `json:"material"`
+	VX       float32 `json:"vx"`
+	VY       float32 `json:"vy"`
+}
+
+type clearRequest struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+type gravityRequest struct {
+	Gravity float32 `json:"gravity"`
+}
+
+// ServeAPI schedules the API on sim and serves it on addr in the background.
+// Streamed frames use the colors of palette.
+func ServeAPI(addr string, s *sim.Simulation, palette render.Palette) error {
+	ln, err := listenLocal(addr)
+	if err != nil {
+		return err
+	}
+	api := &API{cmds: make(chan func(*sim.Simulation), 16)}
+	s.Systems().Add("api", sim.StageInput, api)
+	stream := NewStream(palette)
+	s.Systems().Add("stream", sim.StageInput, stream)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /spawn", jsonOnly(api.spawn))
+	mux.HandleFunc("POST /clear", jsonOnly(api.clear))
+	mux.HandleFunc("POST /pause", jsonOnly(api.pause(true)))
+	mux.HandleFunc("POST /resume", jsonOnly(api.pause(false)))
+	mux.HandleFunc("GET /gravity", api.gravity)
+	mux.HandleFunc("PUT /gravity", jsonOnly(api.setGravity))
+	mux.HandleFunc("GET /stats", api.stats)
+	mux.Handle("GET /stream", websocket.Server{Handler: stream.serve, Handshake: sameOrigin})
+	mux.HandleFunc("GET /{$}", ServeViewer)
+	apiLog.Info("serving", "url", "http://"+ln.Addr().String()+"/")
+	go func() {
+		apiLog.Error("stopped serving", "err", http.Serve(ln, mux))
+	}()
+	return nil
+}
+
+// Run carries out the requests waiting for this tick.
+func (api *API) Run(s *sim.Simulation) {
+	for {
+		select {
+		case cmd := <-api.cmds:
+			cmd(s)
+		default:
+			return
+		}
+	}
+}
+
+// do runs fn on the simulation and replies with what it returns as JSON,
+// or with no content if that is nil.
+func (api *API) do(w http.ResponseWriter, r *http.Request, fn func(s *sim.Simulation) any) {
+	done := make(chan any, 1)
+	select {
+	case api.cmds <- func(s *sim.Simulation) { done <- fn(s) }:
+	case <-r.Context().Done():
+		return
+	}
+	select {
+	case v := <-done:
+		if v == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	case <-r.Context().Done():
+	}
+}
+
+// jsonOnly serves h only for requests sent as application/json, refusing
+// the rest with 415 Unsupported Media Type.
+func jsonOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if t, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || t != "application/json" {
+			http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// decode reads the JSON body of r into v, leaving v alone if it is empty.
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func (api *API) spawn(w http.ResponseWriter, r *http.Request) {
+	req := spawnRequest{Material: sim.Sand.String()}
+	if !decode(w, r, &req) {
+		return
+	}
+	m, err := sim.ParseMaterial(req.Material)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.R < 0 || req.R > sim.MAXRADIUS {
+		http.Error(w, fmt.Sprintf("r must be from 0 to %d", sim.MAXRADIUS), http.StatusBadRequest)
+		return
+	}
+	if req.X < 0 || req.Y < 0 || req.X >= grid.WIDTH || req.Y >= grid.HEIGHT {
+		http.Error(w, fmt.Sprintf("(%d, %d) is off the %dx%d grid", req.X, req.Y, grid.WIDTH, grid.HEIGHT), http.StatusBadRequest)
+		return
+	}
+	if !finite(req.VX) || !finite(req.VY) {
+		http.Error(w, "vx and vy must be finite", http.StatusBadRequest)
+		return
+	}
+	api.do(w, r, func(s *sim.Simulation) any {
+		v := sim.Velocity{X: req.VX, Y: req.VY}
+		s.Record(func() {
+			if req.R > 0 {
+				s.SpawnDisc(req.X, req.Y, req.R, m, v)
+			} else {
+				s.SpawnCell(req.X, req.Y, m, v)
+			}
+		})
+		return nil
+	})
+}
+
+func (api *API) clear(w http.ResponseWriter, r *http.Request) {
+	var req *clearRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	api.do(w, r, func(s *sim.Simulation) any {
+		if req == nil {
+			s.Clear()
+		} else {
+			s.Delete(image.Rect(req.X, req.Y, req.X+req.W, req.Y+req.H))
+		}
+		return nil
+	})
+}
+
+func (api *API) pause(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		api.do(w, r, func(s *sim.Simulation) any {
+			s.SetPaused(paused)
+			return nil
+		})
+	}
+}
+
+func (api *API) gravity(w http.ResponseWriter, r *http.Request) {
+	api.do(w, r, func(s *sim.Simulation) any {
+		return gravityRequest{s.Gravity()}
+	})
+}
+
+func (api *API) setGravity(w http.ResponseWriter, r *http.Request) {
+	var req gravityRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if !finite(req.Gravity) {
+		http.Error(w, "gravity must be finite", http.StatusBadRequest)
+		return
+	}
+	api.do(w, r, func(s *sim.Simulation) any {
+		s.SetGravity(req.Gravity)
+		return req
+	})
+}
+
+func (api *API) stats(w http.ResponseWriter, r *http.Request) {
+	api.do(w, r, func(s *sim.Simulation) any {
+		st := s.Stats()
+		return APIStats{
+			Tick:      s.Tick(),
+			Paused:    s.Paused(),
+			Gravity:   s.Gravity(),
+			Particles: st.Particles,
+			Falling:   st.Falling,
+			Resting:   s.Resting(),
+		}
+	})
+}
+
+func finite(v float32) bool {
+	return !math.IsNaN(float64(v)) && !math.IsInf(float64(v), 0)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jdavasligil/sandbox/sim"
+)
+
+func TestAPIRejects(t *testing.T) {
+	smallWorld(t)
+	gravity := sim.GRAVITY
+	t.Cleanup(func() { sim.GRAVITY = gravity })
+	s := sim.NewSimulation(nil)
+	api := &API{cmds: make(chan func(*sim.Simulation), 16)}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case cmd := <-api.cmds:
+				cmd(s)
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	for _, tc := range []struct {
+		name    string
+		handler http.HandlerFunc
+		ctype   string
+		body    string
+		want    int
+	}{
+		{"spawn", jsonOnly(api.spawn), "application/json", `{"x": 10, "y": 10, "r": 5}`, http.StatusNoContent},
+		{"spawn as a form", jsonOnly(api.spawn), "text/plain", `{"x": 10, "y": 10}`, http.StatusUnsupportedMediaType},
+		{"spawn without a type", jsonOnly(api.spawn), "", `{"x": 10, "y": 10}`, http.StatusUnsupportedMediaType},
+		{"spawn with charset", jsonOnly(api.spawn), "application/json; charset=utf-8", `{"x": 10, "y": 10}`, http.StatusNoContent},
+		{"huge radius", jsonOnly(api.spawn), "application/json", `{"x": 10, "y": 10, "r": 1000000000}`, http.StatusBadRequest},
+		{"negative radius", jsonOnly(api.spawn), "application/json", `{"x": 10, "y": 10, "r": -1}`, http.StatusBadRequest},
+		{"off the grid", jsonOnly(api.spawn), "application/json", `{"x": 200, "y": 10}`, http.StatusBadRequest},
+		{"above the grid", jsonOnly(api.spawn), "application/json", `{"x": 10, "y": -1}`, http.StatusBadRequest},
+		{"clear as a form", jsonOnly(api.clear), "text/plain", ``, http.StatusUnsupportedMediaType},
+		{"pause as a form", jsonOnly(api.pause(true)), "application/x-www-form-urlencoded", ``, http.StatusUnsupportedMediaType},
+		{"gravity", jsonOnly(api.setGravity), "application/json", `{"gravity": 100}`, http.StatusOK},
+		{"gravity as a form", jsonOnly(api.setGravity), "text/plain", `{"gravity": 100}`, http.StatusUnsupportedMediaType},
+		{"gravity too large", jsonOnly(api.setGravity), "application/json", `{"gravity": 1e39}`, http.StatusBadRequest},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body))
+		if tc.ctype != "" {
+			r.Header.Set("Content-Type", tc.ctype)
+		}
+		w := httptest.NewRecorder()
+		tc.handler(w, r)
+		if w.Code != tc.want {
+			t.Errorf("%s: status %d, want %d: %s", tc.name, w.Code, tc.want, w.Body)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"image"
+	"slices"
+	"strings"
+	"syscall/js"
+	"time"
+
+	"golang.org/x/mobile/event/key"
+	"golang.org/x/mobile/event/mouse"
+
+	"github.com/jdavasligil/sandbox/grid"
+	"github.com/jdavasligil/sandbox/input"
+	"github.com/jdavasligil/sandbox/render"
+	"github.com/jdavasligil/sandbox/sim"
+)
+
+const CANVASID = "sandbox" // id of the canvas element drawn into, made if missing
+
+// RunWindow runs the frontend of the platform, used unless -tui is given.
+var RunWindow = RunCanvas
+
+// Canvas is the Renderer of an HTML canvas.
+type Canvas struct {
+	paint  chan struct{}
+	events chan any
+}
+
+func (r *Canvas) Present() {
+	select {
+	case r.paint <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Canvas) Input() <-chan any {
+	return r.events
+}
+
+// RunCanvas draws into the canvas with id CANVASID, calls run with its
+// Renderer on a goroutine of its own and draws the frames published to
+// shared for as long as the page is open. Mouse and touch input on the
+// canvas become mouse events, and touches draw like the left button.
+func RunCanvas(cfg WindowOptions, shared *render.Shared, run func(Renderer)) {
+	doc := js.Global().Get("document")
+	canvas := doc.Call("getElementById", CANVASID)
+	if canvas.IsNull() {
+		canvas = doc.Call("createElement", "canvas")
+		canvas.Set("id", CANVASID)
+		doc.Get("body").Call("appendChild", canvas)
+	}
+	canvas.Set("width", grid.WIDTH)
+	canvas.Set("height", grid.HEIGHT)
+	ctx := canvas.Call("getContext", "2d")
+	pixels := ctx.Call("createImageData", grid.WIDTH, grid.HEIGHT)
+
+	r := &Canvas{paint: make(chan struct{}, 1), events: make(chan any, EVENTBUF)}
+	pending := make(chan any, EVENTBUF)
+	send := func(e any) {
+		sendEvent(pending, e)
+	}
+	listen := func(target js.Value, name string, fn func(e js.Value)) {
+		target.Call("addEventListener", name, js.FuncOf(func(this js.Value, args []js.Value) any {
+			fn(args[0])
+			return nil
+		}), map[string]any{"passive": false})
+	}
+	// at converts page coordinates to grid coordinates.
+	at := func(x, y float64) (float32, float32) {
+		rect := canvas.Call("getBoundingClientRect")
+		gx := (x - rect.Get("left").Float()) * float64(grid.WIDTH) / rect.Get("width").Float()
+		gy := (y - rect.Get("top").Float()) * float64(grid.HEIGHT) / rect.Get("height").Float()
+		return float32(gx), float32(gy)
+	}
+	buttons := [3]mouse.Button{mouse.ButtonLeft, mouse.ButtonMiddle, mouse.ButtonRight}
+	pointer := func(dir mouse.Direction) func(e js.Value) {
+		return func(e js.Value) {
+			m := mouse.Event{Direction: dir}
+			m.X, m.Y = at(e.Get("clientX").Float(), e.Get("clientY").Float())
+			if b := e.Get("button").Int(); dir != mouse.DirNone && b < len(buttons) {
+				m.Button = buttons[b]
+			}
+			send(m)
+		}
+	}
+	listen(canvas, "mousedown", pointer(mouse.DirPress))
+	listen(canvas, "mousemove", pointer(mouse.DirNone))
+	listen(js.Global(), "mouseup", pointer(mouse.DirRelease))
+	listen(canvas, "contextmenu", func(e js.Value) { e.Call("preventDefault") })
+	listen(canvas, "wheel", func(e js.Value) {
+		e.Call("preventDefault")
+		m := mouse.Event{Button: mouse.ButtonWheelDown, Direction: mouse.DirStep}
+		if e.Get("deltaY").Float() < 0 {
+			m.Button = mouse.ButtonWheelUp
+		}
+		m.X, m.Y = at(e.Get("clientX").Float(), e.Get("clientY").Float())
+		send(m)
+	})
+	touch := func(dir mouse.Direction) func(e js.Value) {
+		return func(e js.Value) {
+			e.Call("preventDefault")
+			t := e.Get("changedTouches").Index(0)
+			m := mouse.Event{Button: mouse.ButtonLeft, Direction: dir}
+			m.X, m.Y = at(t.Get("clientX").Float(), t.Get("clientY").Float())
+			send(m)
+		}
+	}
+	listen(canvas, "touchstart", touch(mouse.DirPress))
+	listen(canvas, "touchmove", touch(mouse.DirNone))
+	listen(canvas, "touchend", touch(mouse.DirRelease))
+	listen(canvas, "touchcancel", touch(mouse.DirRelease))
+	listen(js.Global(), "keydown", func(e js.Value) {
+		c, ok := BrowserChord(e)
+		if !ok {
+			return
+		}
+		if _, bound := cfg.Keymap[c]; bound {
+			e.Call("preventDefault")
+			send(c)
+		}
+	})
+	go run(r)
+
+	shading := render.NewShading()
+	opts := cfg.Draw
+	themes, theme := cfg.Themes, cfg.Theme
+	buf := image.NewRGBA(image.Rect(0, 0, grid.WIDTH, grid.HEIGHT))
+	front := shared.Published()
+	full := true
+	var all, grown, covered, drawn, moved, restore grid.Tiles
+	var overlay image.Rectangle
+	var hud render.HUDCache
+	var perf render.PerfGraph
+	var cursor image.Point
+	hover := false
+	frames, fps := 0, 0
+	fpsStart := time.Now()
+	for {
+		select {
+		case e := <-pending:
+			switch e := e.(type) {
+			case input.Chord:
+				cmd := cfg.Keymap[e]
+				view, ok := cmd.(input.View)
+				if !ok {
+					sendEvent(r.events, cmd)
+					continue
+				}
+				switch view {
+				case input.ViewVelocity:
+					if opts.Mode == render.ModeVelocity {
+						opts.Mode = render.ModeNormal
+					} else {
+						opts.Mode = render.ModeVelocity
+					}
+				case input.ViewTrails:
+					opts.Trails = !opts.Trails
+				case input.ViewTheme:
+					theme = (theme + 1) % len(themes)
+					opts.Palette = themes[theme]
+				case input.ViewHUD:
+					opts.HUD = !opts.HUD
+				case input.ViewStats:
+					opts.Panel = !opts.Panel
+				case input.ViewPerf:
+					opts.Perf = !opts.Perf
+				case input.ViewScreenshot:
+					// Let the browser save it as a download.
+					a := doc.Call("createElement", "a")
+					a.Set("href", canvas.Call("toDataURL", "image/png"))
+					a.Set("download", "sandbox.png")
+					a.Call("click")
+				default:
+					uiLog.Warn("not supported in the browser", "command", view)
+				}
+				full = true
+				r.Present()
+			case mouse.Event:
+				cursor = image.Point{int(e.X), int(e.Y)}
+				hover = cursor.In(buf.Bounds()) && !cursor.In(render.ToolbarBounds())
+				if m, ok := render.ToolbarHit(cursor); ok && e.Direction == mouse.DirPress {
+					sendEvent(r.events, m)
+					continue
+				}
+				sendEvent(r.events, e)
+			}
+		case <-r.paint:
+			drawStart := time.Now()
+			frames++
+			if time.Since(fpsStart) >= time.Second {
+				fps = frames
+				frames = 0
+				fpsStart = time.Now()
+			}
+			var dirty grid.Tiles
+			if f := shared.Published(); f != front {
+				front = f
+				dirty = f.Dirty
+			}
+			g := &front.Grid
+			stats, status := front.Stats, front.Status
+			if full || opts.Trails {
+				all = grid.AllTiles(all)
+				dirty = all
+				full = false
+			}
+			if len(dirty) > 0 {
+				grown = dirty.Grow(grown)
+				dirty = grown
+				shading.Compute(g, dirty)
+			}
+			covered = grid.TilesOf(overlay, covered)
+			restore = covered.Union(moved, restore)
+			drawn = dirty.Union(restore, drawn)
+			for _, i := range drawn {
+				render.DrawGrid(g, &shading, &front.Field, opts, buf, grid.TileRect(i))
+			}
+			moved = moved[:0]
+			if !opts.Trails {
+				moved = render.DrawMotion(front, &shading, opts, buf, moved)
+			}
+			upload := drawn.Bounds().Union(moved.Bounds())
+			overlay = image.Rectangle{}
+			if hover {
+				for _, t := range status.Symmetry.Transforms() {
+					p := t(sim.Position{X: float32(cursor.X), Y: float32(cursor.Y)})
+					overlay = overlay.Union(render.DrawCircle(buf, int(p.X), int(p.Y), status.Radius, opts.Palette.Cursor))
+				}
+			}
+			for _, p := range front.Peers {
+				overlay = overlay.Union(render.DrawCircle(buf, p.X, p.Y, p.R, opts.Palette.Accent))
+			}
+			for _, em := range front.Taps {
+				overlay = overlay.Union(render.DrawEmitter(buf, em, opts.Palette.Accent))
+			}
+			for _, pt := range front.Portals {
+				overlay = overlay.Union(render.DrawPortal(buf, pt, opts.Palette.Accent))
+			}
+			for _, r := range front.Goals {
+				overlay = overlay.Union(render.DrawStroke(buf, sim.ToolRect, r.Min, r.Max.Sub(image.Point{1, 1}), opts.Palette.Accent))
+			}
+			if !status.Selection.Empty() {
+				sel := status.Selection
+				overlay = overlay.Union(render.DrawStroke(buf, sim.ToolSelect, sel.Min, sel.Max.Sub(image.Point{1, 1}), opts.Palette.Accent))
+			}
+			if status.Stroke != sim.ToolBrush {
+				overlay = overlay.Union(render.DrawStroke(buf, status.Stroke, status.Anchor, cursor, opts.Palette.Cursor))
+			}
+			overlay = overlay.Union(render.DrawToolbar(buf, status.Material, opts.Palette))
+			if opts.HUD {
+				lines := slices.Clip(hud.Lines(fps, stats, status))
+				if status.Restore {
+					lines = append(lines, cfg.RestoreHint)
+				}
+				if stats.Particles == 0 && cfg.PresetHint != "" {
+					lines = append(lines, cfg.PresetHint)
+				}
+				overlay = overlay.Union(render.DrawHUD(buf, lines, opts.Palette, render.UISCALE))
+			}
+			if opts.Panel {
+				overlay = overlay.Union(render.DrawPanel(buf, front.Panel, opts.Palette, render.UISCALE))
+			}
+			if opts.Perf {
+				overlay = overlay.Union(render.DrawPerf(buf, &perf, opts.Palette, render.UISCALE))
+			}
+			if banner := render.Banner(status.Outcome); banner != "" {
+				overlay = overlay.Union(render.DrawBanner(buf, banner, opts.Palette, render.UISCALE))
+			}
+			upload = upload.Union(overlay).Intersect(buf.Bounds())
+			if !upload.Empty() {
+				// Only the rows touched are copied over.
+				i, j := buf.PixOffset(0, upload.Min.Y), buf.PixOffset(0, upload.Max.Y)
+				js.CopyBytesToJS(pixels.Get("data").Call("subarray", i, j), buf.Pix[i:j])
+				ctx.Call("putImageData", pixels, 0, 0, upload.Min.X, upload.Min.Y, upload.Dx(), upload.Dy())
+			}
+			perf.Add(front.Took, time.Since(drawStart))
+			select {
+			case shared.Ready <- time.Now():
+			default:
+			}
+		}
+	}
+}
+
+// browserKeys names the keys of KeyboardEvent.code after their key.Code,
+// besides letters and digits.
+var browserKeys = map[string]string{
+	"Escape": "escape", "Enter": "returnenter", "Tab": "tab", "Space": "spacebar",
+	"Backspace": "deletebackspace", "Delete": "deleteforward", "Insert": "insert",
+	"Home": "home", "End": "end", "PageUp": "pageup", "PageDown": "pagedown",
+	"ArrowLeft": "leftarrow", "ArrowRight": "rightarrow", "ArrowUp": "uparrow", "ArrowDown": "downarrow",
+	"Minus": "hyphenminus", "Equal": "equalsign", "BracketLeft": "leftsquarebracket",
+	"BracketRight": "rightsquarebracket", "Backslash": "backslash", "Semicolon": "semicolon",
+	"Quote": "apostrophe", "Backquote": "graveaccent", "Comma": "comma", "Period": "fullstop",
+	"Slash": "slash",
+}
+
+// BrowserChord returns the chord of a keydown event, named by the physical
+// key so bindings do not move with the layout.
+func BrowserChord(e js.Value) (input.Chord, bool) {
+	code := e.Get("code").String()
+	name, ok := browserKeys[code]
+	switch {
+	case ok:
+	case strings.HasPrefix(code, "Key"), strings.HasPrefix(code, "Digit"):
+		name = strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(code, "Key"), "Digit"))
+	case len(code) > 1 && code[0] == 'F':
+		name = strings.ToLower(code)
+	}
+	c := input.Chord{Code: input.KeyCode(name)}
+	if c.Code == key.CodeUnknown {
+		return c, false
+	}
+	for _, m := range []struct {
+		prop string
+		mod  key.Modifiers
+	}{{"shiftKey", key.ModShift}, {"ctrlKey", key.ModControl}, {"altKey", key.ModAlt}, {"metaKey", key.ModMeta}} {
+		if e.Get(m.prop).Bool() {
+			c.Mods |= m.mod
+		}
+	}
+	return c, true
+}
@@ -0,0 +1,39 @@
+package main
+
+import "time"
+
+const MAXCATCHUP = 4 // late ticks run back to back before the rest are dropped
+
+// Clock paces the simulation at a fixed period. Ticks that run late are
+// made up by running the following ones back to back, so slow ticks do not
+// slow time down, up to MAXCATCHUP ticks behind. Past that the backlog is
+// dropped rather than spent catching up on an overloaded world.
+type Clock struct {
+	period time.Duration
+	next   time.Time // when the next tick is due
+}
+
+func NewClock(period time.Duration) *Clock {
+	return &Clock{period: period, next: time.Now().Add(period)}
+}
+
+// Reset changes the period, timing the next tick from now.
+func (c *Clock) Reset(period time.Duration) {
+	c.period = period
+	c.next = time.Now().Add(period)
+}
+
+// Wait blocks until the next tick is due and returns how many ticks were
+// dropped to get there.
+func (c *Clock) Wait() int {
+	now := time.Now()
+	dropped := 0
+	if late := now.Sub(c.next); late < 0 {
+		time.Sleep(-late)
+	} else if late > MAXCATCHUP*c.period {
+		dropped = int(late / c.period)
+		c.next = now
+	}
+	c.next = c.next.Add(c.period)
+	return dropped
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/jdavasligil/go-ecs"
+
+	"github.com/jdavasligil/sandbox/render"
+	"github.com/jdavasligil/sandbox/sim"
+)
+
+const SERVERREPORT = time.Minute // time between the counts logged by RunServer
+
+// HeadlessOptions says how long RunHeadless runs and what it writes once
+// it is done.
+type HeadlessOptions struct {
+	Ticks int
+
+	// Snapshot is the PNG the final world is drawn to, if set.
+	Snapshot string
+	Draw     render.DrawOptions
+
+	// Stats prints the final counts as a JSON object on stdout, for
+	// scripts to check.
+	Stats bool
+}
+
+// HeadlessStats are the counts printed by -stats.
+type HeadlessStats struct {
+	Ticks     int     `json:"ticks"`
+	Seconds   float64 `json:"seconds"`
+	Particles int     `json:"particles"`
+	Falling   int     `json:"falling"`
+	Resting   int     `json:"resting"` // cells of resting particles and walls
+}
+
+// RunHeadless simulates opts.Ticks ticks as fast as possible without a
+// window, playing back replay if it is not nil, and logs how it went.
+func RunHeadless(s *sim.Simulation, opts HeadlessOptions, replay *sim.ReplayReader, recorder *sim.ReplayWriter) error {
+	start := time.Now()
+	for i := 0; i < opts.Ticks; i++ {
+		if replay != nil && !replay.Done() {
+			if err := replay.Feed(s, recorder); err != nil {
+				replayLog.Error("replay stopped", "err", err)
+				replay = nil
+			}
+		}
+		s.Step()
+	}
+	elapsed := time.Since(start)
+	if recorder != nil {
+		if err := recorder.Flush(); err != nil {
+			replayLog.Error("cannot record", "err", err)
+		}
+	}
+	falling, _ := ecs.Query[sim.Falling](s.World())
+	simLog.Info("done",
+		"ticks", opts.Ticks,
+		"elapsed", elapsed.Round(time.Millisecond),
+		"rate", int(float64(opts.Ticks)/elapsed.Seconds()),
+		"entities", s.World().EntityCount(),
+		"falling", len(falling),
+	)
+
+	if opts.Snapshot != "" {
+		if err := render.WriteSnapshot(opts.Snapshot, s, opts.Draw); err != nil {
+			return err
+		}
+		captureLog.Info("saved snapshot", "path", opts.Snapshot)
+	}
+	if opts.Stats {
+		return json.NewEncoder(os.Stdout).Encode(HeadlessStats{
+			Ticks:     opts.Ticks,
+			Seconds:   elapsed.Seconds(),
+			Particles: s.World().EntityCount(),
+			Falling:   len(falling),
+			Resting:   s.Resting(),
+		})
+	}
+	return nil
+}
+
+// RunServer simulates sim in real time until the process is stopped, for
+// players and API clients to watch and draw on. It autosaves every
+// autosave, if that is not 0, and logs the counts every SERVERREPORT.
+func RunServer(s *sim.Simulation, autosave time.Duration) {
+	clock := NewClock(time.Duration(float64(sim.SIMTICK) / s.Speed()))
+	report := time.NewTicker(SERVERREPORT)
+	var autosaveTick <-chan time.Time
+	if autosave > 0 {
+		autosaveTick = time.NewTicker(autosave).C
+	}
+	ticks, dropped := 0, 0
+	for {
+		dropped += clock.Wait()
+		s.Step()
+		ticks++
+		select {
+		case <-report.C:
+			falling, _ := ecs.Query[sim.Falling](s.World())
+			simLog.Debug("report", "ticks", ticks, "dropped", dropped, "entities", s.World().EntityCount(), "falling", len(falling))
+			ticks, dropped = 0, 0
+		case <-autosaveTick:
+			s.Autosave(sim.AUTOSAVEDIR)
+		default:
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/jdavasligil/sandbox/sim"
+)
+
+// The loggers of each part of the program, tagging their records with its
+// name as sys.
+var (
+	mainLog     = sim.Subsystem("main")
+	simLog      = sim.Subsystem("sim")
+	uiLog       = sim.Subsystem("ui")
+	captureLog  = sim.Subsystem("capture")
+	replayLog   = sim.Subsystem("replay")
+	autosaveLog = sim.Subsystem("autosave")
+	hostLog     = sim.Subsystem("host")
+	joinLog     = sim.Subsystem("join")
+	streamLog   = sim.Subsystem("stream")
+	apiLog      = sim.Subsystem("api")
+	pprofLog    = sim.Subsystem("pprof")
+	metricsLog  = sim.Subsystem("metrics")
+)
+
+// fatal logs msg and its attributes as an error to l and exits.
+func fatal(l *slog.Logger, msg string, args ...any) {
+	l.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	_ "image/png"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jdavasligil/sandbox/grid"
+	"github.com/jdavasligil/sandbox/input"
+	"github.com/jdavasligil/sandbox/render"
+	"github.com/jdavasligil/sandbox/sim"
+)
+
+const EVENTBUF = 64 // window events queued for the simulation
+
+// LoadImage decodes the image at path and stretches it to the grid.
+func LoadImage(path string) (*image.RGBA, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	src, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, grid.WIDTH, grid.HEIGHT))
+	for y := 0; y < grid.HEIGHT; y++ {
+		for x := 0; x < grid.WIDTH; x++ {
+			sx := b.Min.X + x*b.Dx()/grid.WIDTH
+			sy := b.Min.Y + y*b.Dy()/grid.HEIGHT
+			dst.Set(x, y, src.At(sx, sy))
+		}
+	}
+	return dst, nil
+}
+
+var (
+	backgroundPath = flag.String("background", "", "PNG image drawn behind the particles")
+	themeName      = flag.String("theme", "classic", "built-in theme name or path to a JSON palette")
+	configPath     = flag.String("config", "sandbox.toml", "file of world size and physics settings")
+	width          = flag.Int("width", 800, "grid width in cells, overriding the config")
+	height         = flag.Int("height", 800, "grid height in cells, overriding the config")
+	verbose        = flag.Bool("v", false, "log debug records too, such as a report every second")
+	quiet          = flag.Bool("quiet", false, "log only warnings and errors")
+	seed           = flag.Uint64("seed", 0, "random seed, overriding any scene seed; random if unset")
+	headless       = flag.Bool("headless", false, "simulate -ticks ticks without a window and exit")
+	headlessTicks  = flag.Int("ticks", 600, "ticks simulated by -headless")
+	snapshotPath   = flag.String("snapshot", "", "PNG the world is drawn to when -headless finishes")
+	printStats     = flag.Bool("stats", false, "print final counts as JSON when -headless finishes")
+	tui            = flag.Bool("tui", false, "draw in the terminal instead of a window")
+	fullscreen     = flag.Bool("fullscreen", false, "open the window fullscreen, where the driver allows it")
+	simRate        = flag.Int("simrate", 64, "simulation ticks per second, overriding the config")
+	frameRate      = flag.Int("fps", 60, "frames per second, or 0 to pace frames by the display")
+	uiScale        = flag.Int("uiscale", 1, "times larger the HUD and toolbar are drawn, from 1 to 3, overriding the config")
+	gamepadPath    = flag.String("gamepad", "", "joystick device to read, such as /dev/input/js0")
+	keysPath       = flag.String("keys", "", "JSON file of key bindings overriding the defaults")
+	stampsPath     = flag.String("stamps", "", "directory of extra .txt stamps")
+	savePath       = flag.String("save", "sandbox.sav", "file written by Ctrl+S and read by Ctrl+O")
+	obstaclesPath  = flag.String("obstacles", "", "PNG image whose dark pixels become walls")
+	ffmpegPath     = flag.String("ffmpeg", "ffmpeg", "ffmpeg binary used to record video")
+	soundPlayer    = flag.String("sound", "", "command playing 16-bit mono PCM at 22050Hz from stdin, such as \"aplay -q -f S16_LE -r 22050\"; silent if unset")
+	soundVolume    = flag.Int("volume", 50, "percent volume of -sound")
+	musicDir       = flag.String("music", "music", "directory of .ogg and .mp3 tracks looped under -sound, decoded by -ffmpeg")
+	musicVolume    = flag.Int("musicvolume", 40, "percent volume of the -music tracks")
+	autosavePeriod = flag.Duration("autosave", 2*time.Minute, "time between autosaves, or 0 to disable")
+	recordPath     = flag.String("record", "", "file to record the session's input to for -replay")
+	replayPath     = flag.String("replay", "", "file of recorded input to play back")
+	scenePath      = flag.String("scene", "", "JSON scene to start from")
+	generateSpec   = flag.String("generate", "", "generated scene to start from, such as terrain or hourglass:neck=6,bulb=320,fill=0.8; -seed varies it")
+	pprofAddr      = flag.String("pprof", "", "serve pprof profiles on this address, such as localhost:6060")
+	apiAddr        = flag.String("api", "", "serve the HTTP control API on this address, such as localhost:8080")
+	metricsAddr    = flag.String("metrics", "", "serve Prometheus metrics on this address, such as localhost:9090")
+	hostAddr       = flag.String("host", "", "let players join a shared sandbox on this address, such as :7000 for every interface")
+	spawnRate      = flag.Float64("spawnrate", 32, "spawns per second allowed each player of -host, or 0 for no limit")
+	drainRate      = flag.Float64("drainrate", 1024, "particles per second swallowed by drains, or 0 for no limit")
+	joinAddr       = flag.String("join", "", "join the shared sandbox of a host, such as ws://example.com:7000/play")
+	scriptPath     = flag.String("script", "", "Lua script defining elements, brushes and timed events")
+	checkWorld     = flag.Bool("check", false, "check the world for consistency after every tick and exit on the first fault; slow")
+	disabled       = flag.String("disable", "", "comma separated systems to turn off, such as emit,physics")
+)
+
+// isFlagSet reports whether the named flag was given on the command line.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+func main() {
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "usage: sandbox [serve] [flags]\n\n")
+		fmt.Fprintf(out, "serve runs the world without a window for players to join on -host,\n")
+		fmt.Fprintf(out, "%s, every interface, unless it is given.\n\n", SERVEADDR)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	serving := false
+	switch args := flag.Args(); {
+	case len(args) == 0:
+	case args[0] == "serve":
+		// Its flags follow it.
+		serving = true
+		flag.CommandLine.Parse(args[1:])
+		if flag.NArg() > 0 {
+			fatal(mainLog, "unexpected arguments", "args", flag.Args())
+		}
+	default:
+		fatal(mainLog, "unknown command", "command", args[0])
+	}
+	sim.ConfigureLogging(*verbose, *quiet)
+	if *pprofAddr != "" {
+		if err := ServePprof(*pprofAddr); err != nil {
+			fatal(mainLog, "cannot start", "err", err)
+		}
+	}
+	cfg, err := sim.LoadConfig(*configPath)
+	if err != nil {
+		fatal(mainLog, "cannot start", "err", err)
+	}
+	// A player draws the grid of the host, whatever its own size.
+	var remote *Remote
+	if *joinAddr != "" {
+		remote, err = Join(*joinAddr)
+		if err != nil {
+			fatal(mainLog, "cannot start", "err", err)
+		}
+		cfg.Width, cfg.Height = remote.Hello.Width, remote.Hello.Height
+	}
+	// Flags given on the command line win over the config file.
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "width":
+			if remote == nil {
+				cfg.Width = *width
+			}
+		case "height":
+			if remote == nil {
+				cfg.Height = *height
+			}
+		case "simrate":
+			cfg.SimRate = *simRate
+		case "fps":
+			cfg.FrameRate = *frameRate
+		case "uiscale":
+			cfg.UIScale = *uiScale
+		}
+	})
+	if err := cfg.Check(); err != nil {
+		fatal(mainLog, "cannot start", "err", err)
+	}
+	sim.Configure(cfg)
+	render.UISCALE = cfg.UIScale
+
+	var background *image.RGBA
+	if *backgroundPath != "" {
+		var err error
+		background, err = LoadImage(*backgroundPath)
+		if err != nil {
+			fatal(mainLog, "cannot start", "err", err)
+		}
+	}
+
+	palette, err := render.LoadPalette(*themeName)
+	if err != nil {
+		fatal(mainLog, "cannot start", "err", err)
+	}
+	themes := render.Themes
+	theme := -1
+	for i, p := range themes {
+		if p.Name == palette.Name {
+			theme = i
+		}
+	}
+	if theme < 0 {
+		themes = append(themes, palette)
+		theme = len(themes) - 1
+	}
+
+	// Elements a script defines must be registered before the keymap binds
+	// them and the simulation schedules their updates. A client joined to
+	// a host draws the host's elements and runs no script.
+	var script *sim.Script
+	if *scriptPath != "" && remote == nil {
+		script, err = sim.LoadScript(*scriptPath)
+		if err != nil {
+			fatal(mainLog, "cannot start", "err", err)
+		}
+	}
+
+	keymap, err := input.LoadKeymap(*keysPath)
+	if err != nil {
+		fatal(mainLog, "cannot start", "err", err)
+	}
+
+	stamps, err := sim.LoadStamps(*stampsPath)
+	if err != nil {
+		fatal(mainLog, "cannot start", "err", err)
+	}
+
+	shared := render.NewShared()
+	frontend := RunWindow
+	if *tui {
+		frontend = RunTUI
+	}
+	windowOptions := WindowOptions{
+		Draw:   render.DrawOptions{HUD: true, Background: background, Palette: palette},
+		Themes: themes,
+		Theme:  theme,
+		Keymap: keymap,
+		FFmpeg: *ffmpegPath,
+	}
+	if remote != nil {
+		frontend(windowOptions, shared, func(r Renderer) {
+			remote.Mirror(r, shared)
+		})
+		return
+	}
+
+	s := sim.NewSimulation(stamps)
+	if script != nil {
+		script.Attach(s)
+	}
+	if *hostAddr == "" && serving {
+		*hostAddr = SERVEADDR
+	}
+	if *hostAddr != "" {
+		if err := ServeHost(*hostAddr, s, palette, *spawnRate); err != nil {
+			fatal(mainLog, "cannot start", "err", err)
+		}
+	}
+	if *apiAddr != "" {
+		if err := ServeAPI(*apiAddr, s, palette); err != nil {
+			fatal(mainLog, "cannot start", "err", err)
+		}
+	}
+	if *metricsAddr != "" {
+		if err := ServeMetrics(*metricsAddr, s); err != nil {
+			fatal(mainLog, "cannot start", "err", err)
+		}
+	}
+	if *disabled != "" {
+		for _, name := range strings.Split(*disabled, ",") {
+			if err := s.Systems().Enable(name, false); err != nil {
+				fatal(mainLog, "cannot start", "err", err)
+			}
+		}
+	}
+	if *obstaclesPath != "" {
+		img, err := LoadImage(*obstaclesPath)
+		if err != nil {
+			fatal(mainLog, "cannot start", "err", err)
+		}
+		s.PlaceObstacles(img)
+	}
+
+	s.SavePath = *savePath
+	s.Check = *checkWorld
+	s.DrainRate = *drainRate
+	var replay *sim.ReplayReader
+	if *replayPath != "" {
+		var seed [2]uint64
+		replay, seed, err = sim.OpenReplay(*replayPath)
+		if err != nil {
+			fatal(mainLog, "cannot start", "err", err)
+		}
+		s.Seed(seed[0], seed[1])
+	}
+	seeded := replay != nil
+	if !seeded && isFlagSet("seed") {
+		s.Seed(*seed, 0)
+		seeded = true
+	}
+	// The scenes come after the seed, so they draw the same random numbers
+	// as when any replay was recorded.
+	if *generateSpec != "" {
+		sc, err := sim.Generate(*generateSpec, s.Seeds()[0])
+		if err != nil {
+			fatal(mainLog, "cannot start", "err", err)
+		}
+		if err := s.ApplyScene(sc); err != nil {
+			fatal(mainLog, "cannot apply generated scene", "spec", *generateSpec, "err", err)
+		}
+	}
+	if *scenePath != "" {
+		sc, err := sim.LoadScene(*scenePath)
+		if err != nil {
+			fatal(mainLog, "cannot start", "err", err)
+		}
+		if seeded {
+			sc.Seed = nil
+		}
+		if err := s.ApplyScene(sc); err != nil {
+			fatal(mainLog, "cannot apply scene", "path", *scenePath, "err", err)
+		}
+	}
+	if seed := s.Seeds(); !seeded && seed[1] == 0 {
+		mainLog.Info("random seed", "seed", seed[0])
+	}
+	var recorder *sim.ReplayWriter
+	if *recordPath != "" {
+		recorder, err = sim.CreateReplay(*recordPath, s.Seeds())
+		if err != nil {
+			fatal(mainLog, "cannot start", "err", err)
+		}
+	}
+
+	if serving {
+		RunServer(s, *autosavePeriod)
+		return
+	}
+	if *headless {
+		opts := HeadlessOptions{
+			Ticks:    *headlessTicks,
+			Snapshot: *snapshotPath,
+			Draw:     render.DrawOptions{Background: background, Palette: palette},
+			Stats:    *printStats,
+		}
+		if err := RunHeadless(s, opts, replay, recorder); err != nil {
+			fatal(mainLog, "cannot start", "err", err)
+		}
+		return
+	}
+	if *fullscreen {
+		// screen.NewWindowOptions has no way to ask for it yet.
+		mainLog.Warn("-fullscreen is not supported by the window driver; maximize the window instead")
+	}
+
+	tracks, err := sim.FindMusic(*musicDir)
+	if err != nil {
+		fatal(mainLog, "cannot start", "err", err)
+	}
+	if *soundPlayer == "" && isFlagSet("music") {
+		mainLog.Warn("-music plays only with -sound")
+	}
+	if *soundPlayer != "" {
+		var music *sim.Music
+		if len(tracks) > 0 {
+			music = sim.StartMusic(*ffmpegPath, tracks, *musicVolume)
+		}
+		sound, err := sim.StartSound(*soundPlayer, *soundVolume, music)
+		if err != nil {
+			fatal(mainLog, "cannot start", "err", err)
+		}
+		s.SetSound(sound)
+	}
+
+	restoreHint := ""
+	if path, ok := sim.NewestAutosave(sim.AUTOSAVEDIR); ok {
+		s.OfferRestore(path)
+		restoreHint = "RESTORE AUTOSAVE?"
+		if c, ok := keymap.Find(input.ActionRestore); ok {
+			restoreHint += " (" + c.String() + ")"
+		}
+		autosaveLog.Info("found autosave", "path", path)
+	}
+
+	var readPad func() input.Pad
+	if *gamepadPath != "" {
+		readPad, err = input.OpenGamepad(*gamepadPath)
+		if err != nil {
+			fatal(mainLog, "cannot start", "err", err)
+		}
+	}
+
+	windowOptions.RestoreHint = restoreHint
+	windowOptions.PresetHint = sim.PresetHint(keymap)
+	windowOptions.ReadPad = readPad
+	frontend(windowOptions, shared, func(r Renderer) {
+		Simulate(r, shared, s, replay, recorder)
+	})
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jdavasligil/go-ecs"
+
+	"github.com/jdavasligil/sandbox/sim"
+)
+
+// TICKBUCKETS are the upper bounds of the tick duration histogram.
+var TICKBUCKETS = [...]time.Duration{
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	2 * time.Millisecond,
+	4 * time.Millisecond,
+	8 * time.Millisecond,
+	16 * time.Millisecond,
+	32 * time.Millisecond,
+	64 * time.Millisecond,
+}
+
+// Metrics serves the state of a simulation on GET /metrics in the
+// Prometheus text format:
+//
+//	sandbox_tick_seconds            histogram of the time each tick took
+//	sandbox_entities                particles in the world
+//	sandbox_falling                 particles in motion
+//	sandbox_moved                   particles moved by the last tick
+//	sandbox_particles{material}     particles of each material
+//	sandbox_dropped_events_total    input events the frontend dropped
+//	                                because the simulation fell behind
+//
+// Like the API, a scrape is answered between ticks by the "metrics" system,
+// so it never sees a tick half done.
+type Metrics struct {
+	scrapes chan chan []byte
+
+	buckets [len(TICKBUCKETS) + 1]uint64 // ticks no longer than each bound, and the rest
+	sum     time.Duration
+	count   uint64
+	moved   int // particles moved by the last tick
+}
+
+// ServeMetrics schedules the metrics of sim and serves them on addr in the
+// background.
+func ServeMetrics(addr string, s *sim.Simulation) error {
+	ln, err := listenLocal(addr)
+	if err != nil {
+		return err
+	}
+	m := &Metrics{scrapes: make(chan chan []byte)}
+	s.Watch(m)
+	s.Systems().Add("metrics", sim.StageInput, m)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", m.serve)
+	metricsLog.Info("serving", "url", "http://"+ln.Addr().String()+"/metrics")
+	go func() {
+		metricsLog.Error("stopped serving", "err", http.Serve(ln, mux))
+	}()
+	return nil
+}
+
+// Observe counts a tick that took took and moved moved particles.
+func (m *Metrics) Observe(took time.Duration, moved int) {
+	i := 0
+	for i < len(TICKBUCKETS) && took > TICKBUCKETS[i] {
+		i++
+	}
+	m.buckets[i]++
+	m.sum += took
+	m.count++
+	m.moved = moved
+}
+
+// Run answers the scrapes waiting for this tick.
+func (m *Metrics) Run(s *sim.Simulation) {
+	for {
+		select {
+		case reply := <-m.scrapes:
+			reply <- m.Encode(s)
+		default:
+			return
+		}
+	}
+}
+
+func (m *Metrics) serve(w http.ResponseWriter, r *http.Request) {
+	reply := make(chan []byte, 1)
+	select {
+	case m.scrapes <- reply:
+	case <-r.Context().Done():
+		return
+	}
+	select {
+	case b := <-reply:
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(b)
+	case <-r.Context().Done():
+	}
+}
+
+// Encode writes the metrics of s in the Prometheus text format.
+func (m *Metrics) Encode(s *sim.Simulation) []byte {
+	var b []byte
+	metric := func(name, kind, help string) {
+		b = fmt.Appendf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+	seconds := func(d time.Duration) string {
+		return strconv.FormatFloat(d.Seconds(), 'g', -1, 64)
+	}
+
+	metric("sandbox_tick_seconds", "histogram", "Time each tick took to simulate.")
+	var below uint64
+	for i, bound := range TICKBUCKETS {
+		below += m.buckets[i]
+		b = fmt.Appendf(b, "sandbox_tick_seconds_bucket{le=%q} %d\n", seconds(bound), below)
+	}
+	b = fmt.Appendf(b, "sandbox_tick_seconds_bucket{le=\"+Inf\"} %d\n", m.count)
+	b = fmt.Appendf(b, "sandbox_tick_seconds_sum %s\n", seconds(m.sum))
+	b = fmt.Appendf(b, "sandbox_tick_seconds_count %d\n", m.count)
+
+	falling, _ := ecs.Query[sim.Falling](s.World())
+	metric("sandbox_entities", "gauge", "Particles in the world.")
+	b = fmt.Appendf(b, "sandbox_entities %d\n", s.World().EntityCount())
+	metric("sandbox_falling", "gauge", "Particles in motion.")
+	b = fmt.Appendf(b, "sandbox_falling %d\n", len(falling))
+	metric("sandbox_moved", "gauge", "Particles whose position changed in the last tick.")
+	b = fmt.Appendf(b, "sandbox_moved %d\n", m.moved)
+
+	// Every material that makes particles is listed, so a series does not
+	// vanish while none of it is left.
+	var counts [math.MaxUint8 + 1]int
+	_, ms := ecs.Query[sim.Material](s.World())
+	for _, mat := range ms {
+		counts[mat]++
+	}
+	metric("sandbox_particles", "gauge", "Particles of each material.")
+	for mat := sim.Material(1); int(mat) < len(sim.Elements); mat++ {
+		if mat.IsStatic() {
+			continue
+		}
+		b = fmt.Appendf(b, "sandbox_particles{material=%q} %d\n", mat.String(), counts[mat])
+	}
+
+	metric("sandbox_dropped_events_total", "counter", "Input events dropped because the simulation fell behind.")
+	b = fmt.Appendf(b, "sandbox_dropped_events_total %d\n", droppedEvents.Load())
+	return b
+}
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/mobile/event/key"
+	"golang.org/x/mobile/event/mouse"
+	"golang.org/x/net/websocket"
+
+	"github.com/jdavasligil/sandbox/input"
+	"github.com/jdavasligil/sandbox/render"
+	"github.com/jdavasligil/sandbox/sim"
+)
+
+const (
+	PRESENCERATE = 20      // cursor updates per second sent to players
+	SERVEADDR    = ":7000" // where `sandbox serve` hosts unless -host is given, on every interface
+)
+
+// A shared sandbox is run by one host, the only peer with a simulation.
+// Players join it over a WebSocket at /play, where they are sent the
+// StreamHello and frames of a Stream, with a Welcome after the hello:
+//
+//	{"id": 1}
+//
+// and a JSON text message whenever the cursors move:
+//
+//	{"cursors": [{"id": 0, "x": 10, "y": 20, "r": 5, "material": 1}, ...]}
+//
+// The host's cursor has id 0. Spectators watch at /stream instead, where
+// the Welcome has no id: {"id": 0, "spectator": true}. They are sent the
+// same frames and cursors, but may not draw, and what they send is
+// ignored. The host also serves a page at / for watching in a browser.
+//
+// Players send back their input as binary messages of PEERMSGSIZE bytes,
+// each a little endian peerMessage holding a mouse event, or the Material
+// or Tool to paint with. The host drops a player sending anything else.
+// Each player has a brush of its own, but
+// strokes land in the one undo history of the host. Their input is not
+// recorded by -record.
+//
+// A host may limit how fast each player spawns: every press of the mouse
+// and every tick of holding the brush takes one spawn, and a player may
+// save up a second's worth. Input past the limit is dropped.
+
+// Welcome tells a player the id of its cursor.
+type Welcome struct {
+	ID        int  `json:"id"`
+	Spectator bool `json:"spectator,omitempty"` // may only watch
+}
+
+type presenceNote struct {
+	Cursors []sim.Presence `json:"cursors"`
+}
+
+// Host runs the players' input on the simulation and streams it to them.
+type Host struct {
+	stream *Stream
+	input  chan peerInput
+	ids    atomic.Int64 // the id of the last player to join
+	rate   float64      // spawns per second allowed each player, or 0
+
+	// Owned by the simulation goroutine.
+	peers []*Peer // by id
+	next  time.Time
+	sent  []sim.Presence // the cursors last sent
+	moved []sim.Presence // the cursors of the players who have moved theirs
+}
+
+// Peer is a player joined to the host.
+type Peer struct {
+	id     int
+	player sim.Player
+	moved  bool    // has sent a mouse event
+	spawns float64 // left to spend under the rate limit
+}
+
+type peerInput struct {
+	id    int
+	event any // an input event, or peerJoined or peerLeft
+}
+
+type (
+	peerJoined struct{}
+	peerLeft   struct{}
+)
+
+// peerMessage is the wire form of an input event of a player.
+type peerMessage struct {
+	Kind      uint8 // peerMouse, peerMaterial or peerTool
+	Value     uint8 // the Material or Tool
+	Direction mouse.Direction
+	Button    mouse.Button
+	Modifiers key.Modifiers
+	X, Y      float32
+}
+
+// PEERMSGSIZE is the size of a peerMessage on the wire.
+const PEERMSGSIZE = 19
+
+const (
+	peerMouse = iota + 1
+	peerMaterial
+	peerTool
+)
+
+// EncodePeerInput returns the message sending e, a mouse event, Material
+// or Tool, to the host.
+func EncodePeerInput(e any) []byte {
+	var m peerMessage
+	switch e := e.(type) {
+	case mouse.Event:
+		m = peerMessage{Kind: peerMouse, Direction: e.Direction, Button: e.Button, Modifiers: e.Modifiers, X: e.X, Y: e.Y}
+	case sim.Material:
+		m = peerMessage{Kind: peerMaterial, Value: uint8(e)}
+	case sim.Tool:
+		m = peerMessage{Kind: peerTool, Value: uint8(e)}
+	}
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, m)
+	return b.Bytes()
+}
+
+// DecodePeerInput returns the event a player sent as data.
+func DecodePeerInput(data []byte) (any, error) {
+	if len(data) != PEERMSGSIZE {
+		return nil, fmt.Errorf("input message of %d bytes, want %d", len(data), PEERMSGSIZE)
+	}
+	var m peerMessage
+	binary.Read(bytes.NewReader(data), binary.LittleEndian, &m)
+	switch m.Kind {
+	case peerMouse:
+		if m.Direction > mouse.DirStep {
+			return nil, fmt.Errorf("unknown mouse direction %d", m.Direction)
+		}
+		if math.IsNaN(float64(m.X)) || math.IsInf(float64(m.X), 0) || math.IsNaN(float64(m.Y)) || math.IsInf(float64(m.Y), 0) {
+			return nil, fmt.Errorf("mouse event at (%v, %v)", m.X, m.Y)
+		}
+		return mouse.Event{X: m.X, Y: m.Y, Button: m.Button, Modifiers: m.Modifiers, Direction: m.Direction}, nil
+	case peerMaterial:
+		return sim.Material(m.Value), nil
+	case peerTool:
+		return sim.Tool(m.Value), nil
+	}
+	return nil, fmt.Errorf("unknown input message kind %d", m.Kind)
+}
+
+// ServeHost schedules a Host on sim and lets players join it on addr in the
+// background. Unlike the debugging servers it listens on addr exactly as
+// given, so an address without a host, such as ":7000", accepts players on
+// every interface. Each player may spawn rate times a second, or without
+// limit if rate is 0. Frames use the colors of palette.
+func ServeHost(addr string, s *sim.Simulation, palette render.Palette, rate float64) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	h := &Host{stream: NewStream(palette), input: make(chan peerInput, 64), rate: rate}
+	s.Systems().Add("host", sim.StageInput, h)
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /play", websocket.Server{Handler: h.serve, Handshake: sameOrigin})
+	mux.Handle("GET /stream", websocket.Server{Handler: h.watch, Handshake: sameOrigin})
+	mux.HandleFunc("GET /{$}", ServeViewer)
+	hostLog.Info("hosting", "url", "ws://"+ln.Addr().String()+"/play")
+	go func() {
+		hostLog.Error("stopped serving", "err", http.Serve(ln, mux))
+	}()
+	return nil
+}
+
+// serve runs one player until it leaves.
+func (h *Host) serve(ws *websocket.Conn) {
+	id := int(h.ids.Add(1))
+	h.input <- peerInput{id, peerJoined{}}
+	defer func() { h.input <- peerInput{id, peerLeft{}} }()
+	h.stream.Watch(ws, Welcome{ID: id}, func(ws *websocket.Conn) {
+		ws.MaxPayloadBytes = PEERMSGSIZE
+		for {
+			var data []byte
+			err := websocket.Message.Receive(ws, &data)
+			if err == io.EOF {
+				return
+			}
+			var e any
+			if err == nil {
+				e, err = DecodePeerInput(data)
+			}
+			if err != nil {
+				hostLog.Warn("player dropped", "player", id, "err", err)
+				return
+			}
+			switch e := e.(type) {
+			case mouse.Event:
+			case sim.Material:
+				if !slices.Contains(sim.Materials, e) {
+					continue
+				}
+			case sim.Tool:
+				// Picking and selecting would act on the host's state.
+				if e >= sim.ToolPick {
+					continue
+				}
+			default:
+				continue
+			}
+			h.input <- peerInput{id, e}
+		}
+	})
+}
+
+// watch streams to one spectator until it leaves.
+func (h *Host) watch(ws *websocket.Conn) {
+	hostLog.Info("spectator joined", "addr", ws.Request().RemoteAddr)
+	h.stream.Watch(ws, Welcome{Spectator: true}, nil)
+	hostLog.Info("spectator left", "addr", ws.Request().RemoteAddr)
+}
+
+// Run applies the players' input, paints their brushes and sends out the
+// frame and cursors when they are due.
+func (h *Host) Run(s *sim.Simulation) {
+	for pending := true; pending; {
+		select {
+		case in := <-h.input:
+			h.apply(s, in)
+		default:
+			pending = false
+		}
+	}
+	for _, p := range h.peers {
+		p.spawns = min(p.spawns+h.rate/float64(sim.SIMRATE), max(h.rate, 1))
+		s.PaintAs(&p.player, func() bool { return h.spend(p) })
+	}
+
+	h.moved = h.moved[:0]
+	for _, p := range h.peers {
+		if p.moved {
+			h.moved = append(h.moved, p.player.Presence(p.id))
+		}
+	}
+	s.SetPeers(h.moved)
+	h.stream.Run(s)
+	if now := time.Now(); !now.Before(h.next) {
+		h.next = now.Add(time.Second / PRESENCERATE)
+		cursors := h.moved
+		if local, ok := s.Cursor(); ok {
+			cursors = append([]sim.Presence{local}, cursors...)
+		}
+		if !slices.Equal(cursors, h.sent) {
+			h.sent = append(h.sent[:0], cursors...)
+			h.stream.Notify(presenceNote{cursors})
+		}
+	}
+}
+
+func (h *Host) apply(s *sim.Simulation, in peerInput) {
+	i := slices.IndexFunc(h.peers, func(p *Peer) bool { return p.id == in.id })
+	switch e := in.event.(type) {
+	case peerJoined:
+		h.peers = append(h.peers, &Peer{
+			id:     in.id,
+			player: sim.NewPlayer(),
+			spawns: max(h.rate, 1),
+		})
+		hostLog.Info("player joined", "player", in.id)
+	case peerLeft:
+		if i < 0 {
+			return
+		}
+		// Finish the stroke it left holding.
+		s.Release(&h.peers[i].player)
+		h.peers = slices.Delete(h.peers, i, i+1)
+		hostLog.Info("player left", "player", in.id)
+	default:
+		if i < 0 {
+			return
+		}
+		p := h.peers[i]
+		if m, ok := e.(mouse.Event); ok {
+			p.moved = true
+			if m.Direction == mouse.DirPress && !m.Button.IsWheel() && !h.spend(p) {
+				return
+			}
+		}
+		s.As(&p.player, func() { s.Handle(e) })
+	}
+}
+
+// spend takes one spawn from p, reporting false if it has none left.
+func (h *Host) spend(p *Peer) bool {
+	if h.rate <= 0 {
+		return true
+	}
+	if p.spawns < 1 {
+		return false
+	}
+	p.spawns--
+	return true
+}
+
+// Remote is a shared sandbox joined as a player or spectator.
+type Remote struct {
+	ws        *websocket.Conn
+	Hello     StreamHello
+	ID        int
+	Spectator bool
+
+	mu      sync.Mutex
+	grid    sim.MaterialGrid
+	cursors []sim.Presence // of the other players
+	frames  int            // received since the last count
+}
+
+// hostMessage is a message from the host, a frame if binary.
+type hostMessage struct {
+	data   []byte
+	binary bool
+}
+
+var hostCodec = websocket.Codec{
+	Unmarshal: func(data []byte, payloadType byte, v any) error {
+		*v.(*hostMessage) = hostMessage{data, payloadType == websocket.BinaryFrame}
+		return nil
+	},
+}
+
+// Join connects to the host serving addr, such as ws://example.com:7000/play
+// to play or ws://example.com:7000/stream to spectate. Configure the grid with the size in its Hello before calling Mirror.
+func Join(addr string) (*Remote, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	origin := *u
+	origin.Scheme, origin.Path = "http", "/"
+	if u.Scheme == "wss" {
+		origin.Scheme = "https"
+	}
+	ws, err := websocket.Dial(addr, "", origin.String())
+	if err != nil {
+		return nil, err
+	}
+	rm := &Remote{ws: ws}
+	var welcome Welcome
+	for _, v := range []any{&rm.Hello, &welcome} {
+		if err := websocket.JSON.Receive(ws, v); err != nil {
+			ws.Close()
+			return nil, err
+		}
+	}
+	rm.ID, rm.Spectator = welcome.ID, welcome.Spectator
+	if rm.Hello.Width <= 0 || rm.Hello.Height <= 0 {
+		ws.Close()
+		return nil, fmt.Errorf("host sent a %dx%d grid", rm.Hello.Width, rm.Hello.Height)
+	}
+	return rm, nil
+}
+
+// Mirror shows the host's grid and the other cursors to the renderer r
+// through shared, and sends the host the input of r unless rm is a
+// spectator. Actions other than choosing the material are not shared and
+// do nothing.
+func (rm *Remote) Mirror(r Renderer, shared *render.Shared) {
+	rm.grid = sim.NewMaterialGrid()
+	update := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			var m hostMessage
+			if err := hostCodec.Receive(rm.ws, &m); err != nil {
+				joinLog.Error("lost the host", "err", err)
+				return
+			}
+			rm.mu.Lock()
+			if m.binary {
+				_, err := DecodeFrame(m.data, &rm.grid)
+				if err != nil {
+					joinLog.Warn("bad frame", "err", err)
+				}
+				rm.frames++
+			} else {
+				var note presenceNote
+				if err := json.Unmarshal(m.data, &note); err == nil {
+					rm.cursors = slices.DeleteFunc(note.Cursors, func(p sim.Presence) bool { return p.ID == rm.ID })
+				}
+			}
+			rm.mu.Unlock()
+			select {
+			case update <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	send := func(e any) {
+		if rm.Spectator {
+			return
+		}
+		if err := websocket.Message.Send(rm.ws, EncodePeerInput(e)); err != nil {
+			joinLog.Error("cannot send", "err", err)
+		}
+	}
+	player := sim.NewPlayer()
+	pub := render.NewPublisher(shared)
+	field := sim.NewField()
+	counted := time.NewTicker(time.Second)
+	fps := 0
+	changed := true
+	for {
+		var ready <-chan time.Time
+		if changed {
+			ready = shared.Ready
+		}
+		select {
+		case e := <-r.Input():
+			switch e := e.(type) {
+			case mouse.Event:
+				player.Track(e)
+				send(e)
+			case sim.Material:
+				player.Select(e)
+				send(e)
+			case sim.Tool:
+				player.Use(e)
+				send(e)
+			case input.Action:
+				if e != input.ActionNextMaterial && e != input.ActionPrevMaterial {
+					continue
+				}
+				step := 1
+				if e == input.ActionPrevMaterial {
+					step = -1
+				}
+				player.Select(player.Material().Step(step))
+				send(player.Material())
+			}
+			changed = true
+		case <-update:
+			changed = true
+		case <-counted.C:
+			rm.mu.Lock()
+			fps, rm.frames = rm.frames, 0
+			rm.mu.Unlock()
+		case <-done:
+			// Keep showing the last frame until the window is closed.
+			done = nil
+		case <-ready:
+			changed = false
+			rm.mu.Lock()
+			f := pub.Next(&rm.grid, &field)
+			f.Peers = append(f.Peers[:0], rm.cursors...)
+			rm.mu.Unlock()
+			f.Motion = f.Motion[:0]
+			f.Alpha = 1
+			f.Stats = sim.Stats{TPS: fps}
+			f.Status = player.Status()
+			pub.Publish(f)
+			r.Present()
+		}
+	}
+}
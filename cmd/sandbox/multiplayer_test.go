@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/mobile/event/key"
+	"golang.org/x/mobile/event/mouse"
+	"golang.org/x/net/websocket"
+
+	"github.com/jdavasligil/sandbox/sim"
+)
+
+func TestPeerInput(t *testing.T) {
+	if n := binary.Size(peerMessage{}); n != PEERMSGSIZE {
+		t.Fatalf("peerMessage is %d bytes, PEERMSGSIZE is %d", n, PEERMSGSIZE)
+	}
+	for _, e := range []any{
+		mouse.Event{X: 12.5, Y: -3, Button: mouse.ButtonRight, Modifiers: key.ModShift, Direction: mouse.DirPress},
+		mouse.Event{Button: mouse.ButtonWheelDown, Direction: mouse.DirStep},
+		sim.Water,
+		sim.ToolLine,
+	} {
+		got, err := DecodePeerInput(EncodePeerInput(e))
+		if err != nil || got != e {
+			t.Errorf("%#v round trips to %#v, %v", e, got, err)
+		}
+	}
+
+	bad := func(m peerMessage) []byte {
+		var b strings.Builder
+		binary.Write(&b, binary.LittleEndian, m)
+		return []byte(b.String())
+	}
+	for name, data := range map[string][]byte{
+		"empty":         nil,
+		"short":         EncodePeerInput(sim.Sand)[:PEERMSGSIZE-1],
+		"long":          append(EncodePeerInput(sim.Sand), 0),
+		"unknown kind":  bad(peerMessage{Kind: 9}),
+		"no kind":       bad(peerMessage{}),
+		"bad direction": bad(peerMessage{Kind: peerMouse, Direction: 9}),
+		"nan":           bad(peerMessage{Kind: peerMouse, X: float32(math.NaN())}),
+		"inf":           bad(peerMessage{Kind: peerMouse, Y: float32(math.Inf(1))}),
+	} {
+		if e, err := DecodePeerInput(data); err == nil {
+			t.Errorf("%s: decoded %#v", name, e)
+		}
+	}
+}
+
+func TestSameOrigin(t *testing.T) {
+	srv := httptest.NewServer(websocket.Server{
+		Handler:   func(ws *websocket.Conn) { ws.Close() },
+		Handshake: sameOrigin,
+	})
+	defer srv.Close()
+	addr := "ws" + strings.TrimPrefix(srv.URL, "http")
+	if ws, err := websocket.Dial(addr, "", srv.URL+"/"); err != nil {
+		t.Errorf("same origin refused: %v", err)
+	} else {
+		ws.Close()
+	}
+	if ws, err := websocket.Dial(addr, "", "http://example.com/"); err == nil {
+		ws.Close()
+		t.Error("accepted a connection from another origin")
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	_ "net/http/pprof"
+)
+
+// ServePprof serves the net/http/pprof handlers on addr in the background.
+func ServePprof(addr string) error {
+	ln, err := listenLocal(addr)
+	if err != nil {
+		return err
+	}
+	pprofLog.Info("serving", "url", "http://"+ln.Addr().String()+"/debug/pprof/")
+	go func() {
+		pprofLog.Error("stopped serving", "err", http.Serve(ln, nil))
+	}()
+	return nil
+}
+
+// listenLocal listens on the TCP address addr for the pprof, metrics and API
+// servers. An address without a host, such as ":6060" or "6060", binds to
+// localhost so nothing is exposed to the network by accident. The game
+// server binds its address as given instead.
+func listenLocal(addr string) (net.Listener, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = "", addr
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	return net.Listen("tcp", net.JoinHostPort(host, port))
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"sync/atomic"
+
+	"github.com/jdavasligil/sandbox/input"
+	"github.com/jdavasligil/sandbox/render"
+)
+
+// Renderer is a frontend showing the simulation. Simulate fills frames in
+// a Shared and calls Present as each one is published; the renderer draws
+// the newest one when it is ready, then hands its token back to shared.
+// Input carries the mouse events, Actions and commands the frontend turns
+// its input into.
+type Renderer interface {
+	Present()
+	Input() <-chan any
+}
+
+// droppedEvents counts the input a frontend dropped because the simulation
+// had not taken what it was sent before.
+var droppedEvents atomic.Uint64
+
+// sendEvent sends e to the simulation on ch, dropping it if ch is full.
+func sendEvent(ch chan<- any, e any) {
+	select {
+	case ch <- e:
+	default:
+		droppedEvents.Add(1)
+	}
+}
+
+// WindowOptions are the settings of a frontend.
+type WindowOptions struct {
+	Draw        render.DrawOptions
+	Themes      []render.Palette // cycled through by ViewTheme
+	Theme       int              // index of Draw.Palette in Themes
+	Keymap      input.Keymap
+	RestoreHint string           // shown while an autosave is on offer
+	PresetHint  string           // shown while the world holds no particles
+	ReadPad     func() input.Pad // polls the gamepad, if there is one
+	FFmpeg      string           // binary used to record video
+}
@@ -0,0 +1,427 @@
+//go:build !js
+
+package main
+
+import (
+	"image"
+	"math"
+	"slices"
+	"time"
+
+	"golang.org/x/exp/shiny/driver"
+	"golang.org/x/exp/shiny/screen"
+	"golang.org/x/mobile/event/key"
+	"golang.org/x/mobile/event/lifecycle"
+	"golang.org/x/mobile/event/mouse"
+	"golang.org/x/mobile/event/paint"
+	"golang.org/x/mobile/event/size"
+
+	"github.com/jdavasligil/sandbox/grid"
+	"github.com/jdavasligil/sandbox/input"
+	"github.com/jdavasligil/sandbox/render"
+	"github.com/jdavasligil/sandbox/sim"
+)
+
+// RunWindow runs the frontend of the platform, used unless -tui is given.
+var RunWindow = RunShiny
+
+// Shiny is the Renderer of a shiny window.
+type Shiny struct {
+	win    screen.Window
+	events chan any
+}
+
+func (r *Shiny) Present() {
+	r.win.Send(paint.Event{})
+}
+
+func (r *Shiny) Input() <-chan any {
+	return r.events
+}
+
+// RunShiny opens a window, calls run with its Renderer on a goroutine of
+// its own and draws the frames published to shared until the window is
+// closed.
+func RunShiny(cfg WindowOptions, shared *render.Shared, run func(Renderer)) {
+	driver.Main(func(s screen.Screen) {
+		eventChan := make(chan any, EVENTBUF)
+		shading := render.NewShading()
+		opts := cfg.Draw
+		themes, theme := cfg.Themes, cfg.Theme
+
+		winOpts := &screen.NewWindowOptions{
+			Width:  grid.WIDTH,
+			Height: grid.HEIGHT,
+			Title:  "Sandbox",
+		}
+
+		w, err := s.NewWindow(winOpts)
+		if err != nil {
+			fatal(uiLog, "cannot open the window", "err", err)
+		}
+		defer w.Release()
+
+		bsize := image.Point{grid.WIDTH, grid.HEIGHT}
+
+		buf, err := s.NewBuffer(bsize)
+		if err != nil {
+			fatal(uiLog, "cannot open the window", "err", err)
+		}
+		defer buf.Release()
+
+		// The grid is drawn into buf a pixel a cell. On a high density
+		// display it is scaled up dpr times into hi, whose text is then
+		// drawn at the resolution of the display; otherwise hi is buf.
+		dpr, hi := 1, buf
+		tex, err := s.NewTexture(bsize)
+		if err != nil {
+			fatal(uiLog, "cannot open the window", "err", err)
+		}
+		defer func() {
+			tex.Release()
+			if hi != buf {
+				hi.Release()
+			}
+		}()
+		tex.Fill(tex.Bounds(), opts.Palette.Background, screen.Src)
+
+		go run(&Shiny{win: w, events: eventChan})
+		if cfg.ReadPad != nil {
+			go input.RunGamepad(cfg.ReadPad, w.Send)
+		}
+
+		var sz size.Event
+		var overlay image.Rectangle // drawn over the grid last frame
+		var gifRec render.GIFRecorder
+		var video *render.VideoRecorder
+		defer func() {
+			// Finish a recording left running at exit.
+			if video != nil {
+				video.Stop()
+			}
+		}()
+		front := shared.Published()
+		full := true // repaint the whole grid next frame
+		var all, grown, covered, drawn grid.Tiles
+		var moved, restore grid.Tiles // tiles DrawMotion drew on last frame, and all to repaint
+		var hud render.HUDCache
+		var perf render.PerfGraph
+		var cursor image.Point
+		hover := false
+		frames, fps := 0, 0
+		fpsStart := time.Now()
+		for {
+			switch e := w.NextEvent().(type) {
+			case lifecycle.Event:
+				if e.To == lifecycle.StageDead {
+					return
+				}
+			case key.Event:
+				if e.Direction != key.DirPress {
+					continue
+				}
+				cmd, ok := cfg.Keymap[input.ChordOf(e)]
+				if !ok {
+					continue
+				}
+				view, ok := cmd.(input.View)
+				if !ok {
+					sendEvent(eventChan, cmd)
+					continue
+				}
+				switch view {
+				case input.ViewQuit:
+					return
+				case input.ViewVelocity:
+					if opts.Mode == render.ModeVelocity {
+						opts.Mode = render.ModeNormal
+					} else {
+						opts.Mode = render.ModeVelocity
+					}
+				case input.ViewTrails:
+					opts.Trails = !opts.Trails
+				case input.ViewTheme:
+					theme = (theme + 1) % len(themes)
+					opts.Palette = themes[theme]
+				case input.ViewHUD:
+					opts.HUD = !opts.HUD
+				case input.ViewStats:
+					opts.Panel = !opts.Panel
+				case input.ViewPerf:
+					opts.Perf = !opts.Perf
+				case input.ViewScreenshot:
+					// Encode off the event loop; the copy keeps drawing free.
+					img := render.Snapshot(hi.RGBA())
+					go func() {
+						path, err := render.SaveScreenshot(render.SCREENSHOTDIR, img)
+						if err != nil {
+							captureLog.Error("screenshot failed", "err", err)
+							return
+						}
+						captureLog.Info("saved screenshot", "path", path)
+					}()
+					continue
+				case input.ViewRecordGIF:
+					if !gifRec.Active() {
+						gifRec.Start()
+						break
+					}
+					go saveGIF(gifRec.Stop())
+				case input.ViewRecordVideo:
+					if video == nil {
+						video, err = render.StartVideo(cfg.FFmpeg, bsize)
+						if err != nil {
+							captureLog.Error("cannot record video", "err", err)
+						}
+						break
+					}
+					go func(v *render.VideoRecorder) {
+						if err := v.Stop(); err != nil {
+							captureLog.Error("video failed", "err", err)
+							return
+						}
+						captureLog.Info("saved video", "path", v.Path)
+					}(video)
+					video = nil
+				}
+				full = true
+				w.Send(paint.Event{})
+			case mouse.Event:
+				e.X, e.Y = ToGrid(Viewport(sz), e.X, e.Y)
+				cursor = image.Point{int(e.X), int(e.Y)}
+				hover = cursor.In(front.Grid.Bounds()) && !cursor.In(render.ToolbarBounds())
+				if m, ok := render.ToolbarHit(cursor); ok && e.Direction == mouse.DirPress {
+					sendEvent(eventChan, m)
+					continue
+				}
+				sendEvent(eventChan, e)
+			case input.PadEvent:
+				cursor = image.Point{int(e.X), int(e.Y)}
+				hover = true
+				sendEvent(eventChan, e.Event)
+			case input.Action:
+				sendEvent(eventChan, e)
+			case paint.Event:
+				if e.External {
+					continue
+				}
+				drawStart := time.Now()
+				frames++
+				if time.Since(fpsStart) >= time.Second {
+					fps = frames
+					frames = 0
+					fpsStart = time.Now()
+				}
+
+				var dirty grid.Tiles
+				if f := shared.Published(); f != front {
+					front = f
+					dirty = f.Dirty
+				}
+				g := &front.Grid
+				stats, status := front.Stats, front.Status
+				if full || opts.Trails {
+					// Repaint everything when asked; fading also touches
+					// every pixel still holding a trail.
+					all = grid.AllTiles(all)
+					dirty = all
+					full = false
+				}
+				if len(dirty) > 0 {
+					// Depth changes reach MAXDEPTH cells, at most a
+					// tile, past the edits.
+					grown = dirty.Grow(grown)
+					dirty = grown
+					shading.Compute(g, dirty)
+				}
+				// Restore the grid beneath last frame's overlays and
+				// moving particles.
+				covered = grid.TilesOf(overlay, covered)
+				restore = covered.Union(moved, restore)
+				drawn = dirty.Union(restore, drawn)
+				for _, i := range drawn {
+					render.DrawGrid(g, &shading, &front.Field, opts, buf.RGBA(), grid.TileRect(i))
+				}
+				moved = moved[:0]
+				if !opts.Trails {
+					// Trails already smear motion across frames.
+					moved = render.DrawMotion(front, &shading, opts, buf.RGBA(), moved)
+				}
+				upload := drawn.Bounds().Union(moved.Bounds())
+				if gifRec.Active() && !gifRec.Capture(buf.RGBA()) {
+					go saveGIF(gifRec.Stop())
+				}
+				if video != nil {
+					video.Submit(buf.RGBA())
+				}
+				overlay = image.Rectangle{}
+				if hover {
+					for _, t := range status.Symmetry.Transforms() {
+						p := t(sim.Position{X: float32(cursor.X), Y: float32(cursor.Y)})
+						overlay = overlay.Union(render.DrawCircle(buf.RGBA(), int(p.X), int(p.Y), status.Radius, opts.Palette.Cursor))
+					}
+				}
+				for _, p := range front.Peers {
+					overlay = overlay.Union(render.DrawCircle(buf.RGBA(), p.X, p.Y, p.R, opts.Palette.Accent))
+				}
+				for _, em := range front.Taps {
+					overlay = overlay.Union(render.DrawEmitter(buf.RGBA(), em, opts.Palette.Accent))
+				}
+				for _, pt := range front.Portals {
+					overlay = overlay.Union(render.DrawPortal(buf.RGBA(), pt, opts.Palette.Accent))
+				}
+				for _, r := range front.Goals {
+					overlay = overlay.Union(render.DrawStroke(buf.RGBA(), sim.ToolRect, r.Min, r.Max.Sub(image.Point{1, 1}), opts.Palette.Accent))
+				}
+				if !status.Selection.Empty() {
+					sel := status.Selection
+					overlay = overlay.Union(render.DrawStroke(buf.RGBA(), sim.ToolSelect, sel.Min, sel.Max.Sub(image.Point{1, 1}), opts.Palette.Accent))
+				}
+				if status.Stroke != sim.ToolBrush {
+					overlay = overlay.Union(render.DrawStroke(buf.RGBA(), status.Stroke, status.Anchor, cursor, opts.Palette.Cursor))
+				}
+				overlay = overlay.Union(render.DrawToolbar(buf.RGBA(), status.Material, opts.Palette))
+				upload = upload.Union(overlay)
+				if dpr > 1 {
+					scaleUp(hi.RGBA(), buf.RGBA(), upload, dpr)
+				}
+				upload = scaleRect(upload, dpr)
+				text := hi.RGBA()
+				var lettered image.Rectangle // text drawn over the grid, in hi
+				ui := render.UISCALE * dpr
+				if opts.HUD {
+					// Extra lines must not write into the cache.
+					lines := slices.Clip(hud.Lines(fps, stats, status))
+					if gifRec.Active() {
+						lines = append(lines, "REC GIF")
+					}
+					if video != nil {
+						lines = append(lines, "REC VIDEO")
+					}
+					if status.Restore {
+						lines = append(lines, cfg.RestoreHint)
+					}
+					if stats.Particles == 0 && cfg.PresetHint != "" {
+						lines = append(lines, cfg.PresetHint)
+					}
+					lettered = lettered.Union(render.DrawHUD(text, lines, opts.Palette, ui))
+				}
+				if opts.Panel {
+					lettered = lettered.Union(render.DrawPanel(text, front.Panel, opts.Palette, ui))
+				}
+				if opts.Perf {
+					lettered = lettered.Union(render.DrawPerf(text, &perf, opts.Palette, ui))
+				}
+				if banner := render.Banner(status.Outcome); banner != "" {
+					lettered = lettered.Union(render.DrawBanner(text, banner, opts.Palette, ui))
+				}
+				// The grid cells under the text are repainted next frame
+				// like those under the overlays.
+				overlay = overlay.Union(unscaleRect(lettered, dpr))
+				upload = upload.Union(lettered)
+				if !upload.Empty() {
+					tex.Upload(upload.Min, hi, upload)
+				}
+				vp := Viewport(sz)
+				w.Fill(sz.Bounds(), opts.Palette.Background, screen.Src)
+				w.Scale(vp, tex, tex.Bounds(), screen.Src, nil)
+				perf.Add(front.Took, time.Since(drawStart))
+				w.Publish()
+				select {
+				case shared.Ready <- time.Now():
+				default:
+				}
+			case size.Event:
+				sz = e
+				if r := DevicePixelRatio(e); r != dpr {
+					dpr = r
+					if hi != buf {
+						hi.Release()
+					}
+					hi = buf
+					if dpr > 1 {
+						if hi, err = s.NewBuffer(bsize.Mul(dpr)); err != nil {
+							fatal(uiLog, "cannot resize the window", "err", err)
+						}
+					}
+					tex.Release()
+					if tex, err = s.NewTexture(hi.Size()); err != nil {
+						fatal(uiLog, "cannot resize the window", "err", err)
+					}
+					tex.Fill(tex.Bounds(), opts.Palette.Background, screen.Src)
+					full = true
+				}
+			case error:
+				uiLog.Error("window error", "err", e)
+			default:
+			}
+		}
+	})
+}
+
+// Viewport returns the window region the grid texture is drawn into. The
+// grid is scaled by the largest whole factor that fits so pixels stay crisp
+// on high density displays, shrinking to fit if the window is smaller than
+// the grid. Either way it keeps its aspect ratio and is centered.
+func Viewport(sz size.Event) image.Rectangle {
+	win := sz.Bounds()
+	if win.Empty() {
+		return image.Rect(0, 0, grid.WIDTH, grid.HEIGHT)
+	}
+	scale := float32(min(win.Dx()/grid.WIDTH, win.Dy()/grid.HEIGHT))
+	if scale < 1 {
+		scale = min(float32(win.Dx())/float32(grid.WIDTH), float32(win.Dy())/float32(grid.HEIGHT))
+	}
+	w := int(float32(grid.WIDTH) * scale)
+	h := int(float32(grid.HEIGHT) * scale)
+	x := (win.Dx() - w) / 2
+	y := (win.Dy() - h) / 2
+	return image.Rect(x, y, x+w, y+h)
+}
+
+// DevicePixelRatio returns how many pixels of the display sz describes
+// there are to a pixel of a 96 dpi one, to the nearest whole number.
+func DevicePixelRatio(sz size.Event) int {
+	const base = 96.0 / 72 // pixels per point at 96 dpi
+	return max(int(math.Round(float64(sz.PixelsPerPt/base))), 1)
+}
+
+// scaleUp copies region r of src into dst k times larger.
+func scaleUp(dst, src *image.RGBA, r image.Rectangle, k int) {
+	r = r.Intersect(src.Bounds())
+	for y := r.Min.Y * k; y < r.Max.Y*k; y++ {
+		for x := r.Min.X * k; x < r.Max.X*k; x++ {
+			dst.SetRGBA(x, y, src.RGBAAt(x/k, y/k))
+		}
+	}
+}
+
+// scaleRect returns r k times larger, and unscaleRect the smallest
+// rectangle k times smaller that covers it.
+func scaleRect(r image.Rectangle, k int) image.Rectangle {
+	return image.Rectangle{r.Min.Mul(k), r.Max.Mul(k)}
+}
+
+func unscaleRect(r image.Rectangle, k int) image.Rectangle {
+	if r.Empty() {
+		return image.Rectangle{}
+	}
+	return image.Rect(r.Min.X/k, r.Min.Y/k, (r.Max.X+k-1)/k, (r.Max.Y+k-1)/k)
+}
+
+// ToGrid converts window pixel coordinates to grid coordinates.
+func ToGrid(vp image.Rectangle, x, y float32) (float32, float32) {
+	gx := (x - float32(vp.Min.X)) * float32(grid.WIDTH) / float32(vp.Dx())
+	gy := (y - float32(vp.Min.Y)) * float32(grid.HEIGHT) / float32(vp.Dy())
+	return gx, gy
+}
+
+// saveGIF saves a finished recording, logging the outcome.
+func saveGIF(frames []*image.RGBA) {
+	path, err := render.SaveGIF(render.GIFDIR, frames)
+	if err != nil {
+		captureLog.Error("gif failed", "err", err)
+		return
+	}
+	captureLog.Info("saved gif", "path", path)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"time"
+
+	"github.com/jdavasligil/sandbox/render"
+	"github.com/jdavasligil/sandbox/sim"
+)
+
+// Between returns how far t lies from t0 to t1, clamped to [0, 1].
+func Between(t, t0, t1 time.Time) float32 {
+	if !t1.After(t0) {
+		return 1
+	}
+	return min(max(float32(t.Sub(t0))/float32(t1.Sub(t0)), 0), 1)
+}
+
+func Simulate(r Renderer, shared *render.Shared, s *sim.Simulation, replay *sim.ReplayReader, recorder *sim.ReplayWriter) {
+	events := r.Input()
+	speed := s.Speed()
+	clock := NewClock(time.Duration(float64(sim.SIMTICK) / speed))
+	var drawTick <-chan time.Time
+	if sim.DRAWTICK > 0 {
+		drawTick = time.NewTicker(sim.DRAWTICK).C
+	}
+	frameDue := false
+	// due is when the frame to draw was asked for, and ticked when the
+	// last two ticks ended.
+	var due time.Time
+	var ticked [2]time.Time
+	pub := render.NewPublisher(shared)
+	profileTicker := time.NewTicker(time.Second)
+	var autosaveTick <-chan time.Time
+	if *autosavePeriod > 0 {
+		autosaveTick = time.NewTicker(*autosavePeriod).C
+	}
+	var timings []sim.SystemTiming
+	var materials []sim.MaterialStat
+	var slowest time.Duration
+	var panel []string
+	ticks, dropped := 0, 0
+	tps, lost := 0, 0 // ticks run and dropped over the last second
+	for {
+		// Handle Events
+		for pending := true; pending; {
+			select {
+			case event := <-events:
+				if replay != nil && !replay.Done() {
+					// Live input would break the replay.
+					continue
+				}
+				if recorder != nil {
+					recorder.Record(s.Tick(), event)
+				}
+				s.Handle(event)
+			default:
+				pending = false
+			}
+		}
+		if replay != nil && !replay.Done() {
+			if err := replay.Feed(s, recorder); err != nil {
+				replayLog.Error("replay stopped", "err", err)
+				replay = nil
+			}
+		}
+		if s.Speed() != speed {
+			speed = s.Speed()
+			clock.Reset(time.Duration(float64(sim.SIMTICK) / speed))
+		}
+
+		// Spawn Sand & Simulate Physics
+		start := time.Now()
+		s.Step()
+		ticked = [2]time.Time{ticked[1], time.Now()}
+		slowest = max(slowest, ticked[1].Sub(start))
+
+		// Draw Call
+		select {
+		case due = <-drawTick:
+			frameDue = true
+		default:
+		}
+		if frameDue || drawTick == nil {
+			select {
+			case idle := <-shared.Ready:
+				frameDue = false
+				if drawTick == nil {
+					due = idle
+				}
+				f := pub.NextFrom(s)
+				// Frames fall at even times between ticks, so showing each
+				// as far along the last tick as it was asked for paces
+				// motion evenly even when the rates beat.
+				f.Alpha = Between(due, ticked[0], ticked[1])
+				f.Stats.TPS, f.Stats.Dropped = tps, lost
+				f.Panel = append(f.Panel[:0], panel...)
+				f.Took, slowest = slowest, 0
+				pub.Publish(f)
+				r.Present()
+			default:
+			}
+		}
+
+		// Report Memory Usage
+		select {
+		case <-profileTicker.C:
+			tps, lost = ticks, dropped
+			ticks, dropped = 0, 0
+			var total uintptr
+			materials, total = s.MaterialStats(materials)
+			timings = s.Systems().Timings(timings)
+			panel = render.PanelLines(materials, total, s.Resting(), timings)
+			simLog.Debug("second", "particles", s.World().EntityCount(), "resting", s.Resting(), "bytes", total, "dropped", lost)
+			for _, t := range timings {
+				simLog.Debug("system", "name", t.Name, "took", t.Took)
+			}
+			s.Sweep()
+			if recorder != nil {
+				if err := recorder.Flush(); err != nil {
+					replayLog.Error("recording stopped", "err", err)
+					recorder = nil
+				}
+			}
+		default:
+		}
+
+		// Autosave
+		select {
+		case <-autosaveTick:
+			s.Autosave(sim.AUTOSAVEDIR)
+		default:
+		}
+
+		// Block until update time has elapsed.
+		dropped += clock.Wait()
+		ticks++
+	}
+}
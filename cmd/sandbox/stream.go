@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	_ "embed"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/jdavasligil/sandbox/grid"
+	"github.com/jdavasligil/sandbox/render"
+	"github.com/jdavasligil/sandbox/sim"
+)
+
+const (
+	STREAMRATE   = 30 // frames per second sent to viewers
+	STREAMBUFFER = 4  // frames queued for a viewer before it falls behind
+)
+
+// Frame kinds, the first byte of each frame sent by a Stream.
+const (
+	STREAMKEY   byte = 'K' // the whole grid, starting from empty
+	STREAMDELTA byte = 'D' // the cells changed since the previous frame
+)
+
+//go:embed web/viewer.html
+var viewerPage []byte
+
+// Stream sends the material grid to WebSocket viewers a few times a second.
+// A viewer is first sent a JSON text message of the grid size and the
+// color of each material:
+//
+//	{"width": 800, "height": 800, "colors": ["#050505", ...]}
+//
+// and then binary frames, each compressed on its own with raw DEFLATE.
+// A frame holds its kind and the tick as a uvarint, then runs of cells in
+// row major order: a uvarint of cells to skip, a uvarint n, and n bytes of
+// the materials that follow. Key frames are sent to new viewers and to
+// viewers that fell behind; everyone else is sent deltas.
+type Stream struct {
+	colors []string
+	last   []sim.Material // the grid as of the last frame
+	next   time.Time      // when the next frame is due
+
+	raw bytes.Buffer
+	zw  *flate.Writer
+
+	mu      sync.Mutex
+	viewers map[*viewer]bool
+}
+
+type viewer struct {
+	frames chan []byte
+	notes  chan []byte // JSON text messages sent in between
+	key    bool        // needs a key frame next
+}
+
+// NewStream returns a Stream drawing materials in the colors of palette.
+func NewStream(palette render.Palette) *Stream {
+	st := &Stream{
+		colors:  make([]string, len(sim.Elements)),
+		last:    make([]sim.Material, grid.WIDTH*grid.HEIGHT),
+		viewers: make(map[*viewer]bool),
+	}
+	for m := range sim.Elements {
+		c := palette.Color(sim.Material(m))
+		st.colors[m] = fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	st.zw, _ = flate.NewWriter(io.Discard, flate.BestSpeed)
+	return st
+}
+
+// Run sends a frame of the grid to the viewers once one is due.
+func (st *Stream) Run(s *sim.Simulation) {
+	now := time.Now()
+	if now.Before(st.next) {
+		return
+	}
+	st.next = now.Add(time.Second / STREAMRATE)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if len(st.viewers) == 0 {
+		return
+	}
+	delta := st.encode(STREAMDELTA, s.Tick(), st.last, s.Grid().Cells())
+	copy(st.last, s.Grid().Cells())
+	var key []byte
+	for v := range st.viewers {
+		frame := delta
+		if v.key {
+			if key == nil {
+				key = st.encode(STREAMKEY, s.Tick(), nil, st.last)
+			}
+			frame = key
+		}
+		select {
+		case v.frames <- frame:
+			v.key = false
+		default:
+			// Its copy of the grid is lost along with the frame.
+			v.key = true
+		}
+	}
+}
+
+// Notify sends v as a JSON text message to every viewer that keeps up.
+func (st *Stream) Notify(v any) {
+	note, err := json.Marshal(v)
+	if err != nil {
+		streamLog.Error("cannot encode", "err", err)
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for w := range st.viewers {
+		select {
+		case w.notes <- note:
+		default:
+		}
+	}
+}
+
+// encode returns a compressed frame of the cells of grid that differ from
+// prev, or of every cell that is not empty if prev is nil.
+func (st *Stream) encode(kind byte, tick uint64, prev, g []sim.Material) []byte {
+	st.raw.Reset()
+	st.raw.WriteByte(kind)
+	st.raw.Write(binary.AppendUvarint(nil, tick))
+	changed := func(i int) bool {
+		if prev == nil {
+			return g[i] != sim.Empty
+		}
+		return g[i] != prev[i]
+	}
+	var varint [binary.MaxVarintLen64]byte
+	skip := 0
+	for i := 0; i < len(g); {
+		if !changed(i) {
+			skip++
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(g) && changed(j) {
+			j++
+		}
+		st.raw.Write(varint[:binary.PutUvarint(varint[:], uint64(skip))])
+		st.raw.Write(varint[:binary.PutUvarint(varint[:], uint64(j-i))])
+		for _, m := range g[i:j] {
+			st.raw.WriteByte(byte(m))
+		}
+		skip, i = 0, j
+	}
+
+	var out bytes.Buffer
+	st.zw.Reset(&out)
+	st.zw.Write(st.raw.Bytes())
+	st.zw.Close()
+	return out.Bytes()
+}
+
+// StreamHello is the first message sent to a viewer.
+type StreamHello struct {
+	Width  int      `json:"width"`
+	Height int      `json:"height"`
+	Colors []string `json:"colors"`
+}
+
+// maxFrame is the most a frame of a grid of n cells decompresses to: its
+// kind and tick, and at worst a run for every cell.
+func maxFrame(n int) int {
+	return 1 + binary.MaxVarintLen64 + n*(2*binary.MaxVarintLen32+1)
+}
+
+// DecodeFrame applies a frame encoded by a Stream to grid and returns the
+// tick it shows.
+func DecodeFrame(frame []byte, g *sim.MaterialGrid) (uint64, error) {
+	limit := maxFrame(len(g.Cells()))
+	raw, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(frame)), int64(limit)+1))
+	if err != nil {
+		return 0, err
+	}
+	if len(raw) > limit {
+		return 0, fmt.Errorf("frame is larger than %d bytes", limit)
+	}
+	r := bytes.NewReader(raw)
+	kind, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	tick, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, err
+	}
+	if kind == STREAMKEY {
+		for i, m := range g.Cells() {
+			if m != sim.Empty {
+				g.Clear(i%grid.WIDTH, i/grid.WIDTH)
+			}
+		}
+	}
+	at := 0
+	for r.Len() > 0 {
+		skip, err := binary.ReadUvarint(r)
+		if err != nil {
+			return tick, err
+		}
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return tick, err
+		}
+		if skip > uint64(len(g.Cells())-at) {
+			return tick, fmt.Errorf("frame overruns the grid")
+		}
+		at += int(skip)
+		if n > uint64(r.Len()) || n > uint64(len(g.Cells())-at) {
+			return tick, fmt.Errorf("frame overruns the grid")
+		}
+		for ; n > 0; n-- {
+			m, _ := r.ReadByte()
+			if int(m) >= len(sim.Elements) {
+				return tick, fmt.Errorf("frame holds unknown material %d", m)
+			}
+			g.Set(at%grid.WIDTH, at/grid.WIDTH, sim.Material(m))
+			at++
+		}
+	}
+	return tick, nil
+}
+
+// sameOrigin is the handshake of every WebSocket served. It accepts only
+// the pages the server served itself and clients that name the server as
+// their origin, as Join does, so a page on another site cannot connect
+// through the browser of someone visiting it.
+func sameOrigin(config *websocket.Config, req *http.Request) error {
+	origin, err := websocket.Origin(config, req)
+	if err != nil {
+		return err
+	}
+	if origin == nil || origin.Host != req.Host {
+		return fmt.Errorf("origin %v is not %s", origin, req.Host)
+	}
+	config.Origin = origin
+	return nil
+}
+
+// serve streams frames to one viewer until it goes away.
+func (st *Stream) serve(ws *websocket.Conn) {
+	st.Watch(ws, nil, nil)
+}
+
+// Watch streams frames to ws until read returns or a send fails. After the
+// StreamHello, greet is sent as JSON if it is not nil. read receives what
+// the viewer sends from ws; if it is nil that is discarded.
+func (st *Stream) Watch(ws *websocket.Conn, greet any, read func(ws *websocket.Conn)) {
+	defer ws.Close()
+	if err := websocket.JSON.Send(ws, StreamHello{grid.WIDTH, grid.HEIGHT, st.colors}); err != nil {
+		return
+	}
+	if greet != nil {
+		if err := websocket.JSON.Send(ws, greet); err != nil {
+			return
+		}
+	}
+	if read == nil {
+		read = func(ws *websocket.Conn) { io.Copy(io.Discard, ws) }
+	}
+	v := &viewer{
+		frames: make(chan []byte, STREAMBUFFER),
+		notes:  make(chan []byte, STREAMBUFFER),
+		key:    true,
+	}
+	st.mu.Lock()
+	st.viewers[v] = true
+	st.mu.Unlock()
+	defer func() {
+		st.mu.Lock()
+		delete(st.viewers, v)
+		st.mu.Unlock()
+	}()
+
+	// A finished read means the viewer left.
+	gone := make(chan struct{})
+	go func() {
+		read(ws)
+		close(gone)
+	}()
+	for {
+		select {
+		case frame := <-v.frames:
+			if err := websocket.Message.Send(ws, frame); err != nil {
+				streamLog.Warn("viewer dropped", "err", err)
+				return
+			}
+		case note := <-v.notes:
+			if err := websocket.Message.Send(ws, string(note)); err != nil {
+				streamLog.Warn("viewer dropped", "err", err)
+				return
+			}
+		case <-gone:
+			return
+		}
+	}
+}
+
+// ServeViewer serves the page that watches the stream.
+func ServeViewer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(viewerPage)
+}
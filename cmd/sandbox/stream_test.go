@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"slices"
+	"testing"
+
+	"github.com/jdavasligil/sandbox/grid"
+	"github.com/jdavasligil/sandbox/render"
+	"github.com/jdavasligil/sandbox/sim"
+)
+
+// smallWorld configures a 200x150 world for the rest of the test.
+func smallWorld(t *testing.T) {
+	cfg := sim.DefaultConfig()
+	cfg.Width, cfg.Height = 200, 150
+	sim.Configure(cfg)
+	t.Cleanup(func() { sim.Configure(sim.DefaultConfig()) })
+}
+
+// TestStreamFrames decodes a key frame and then deltas, checking the copy
+// of the grid follows the simulation.
+func TestStreamFrames(t *testing.T) {
+	smallWorld(t)
+	s := sim.NewSimulation(nil)
+	for x := 0; x < grid.WIDTH; x++ {
+		s.SpawnCell(x, grid.HEIGHT-1, sim.Wall, sim.Velocity{})
+	}
+	s.SpawnDisc(grid.WIDTH/2, 20, 10, sim.Sand, sim.Velocity{})
+	st := NewStream(render.Themes[0])
+	grid := sim.NewMaterialGrid()
+	grid.Set(0, 0, sim.Water) // a key frame starts from empty
+
+	frame := st.encode(STREAMKEY, s.Tick(), nil, s.Grid().Cells())
+	copy(st.last, s.Grid().Cells())
+	for i := range 4 {
+		tick, err := DecodeFrame(frame, &grid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tick != s.Tick() {
+			t.Fatalf("frame shows tick %d, want %d", tick, s.Tick())
+		}
+		if !slices.Equal(grid.Cells(), s.Grid().Cells()) {
+			t.Fatalf("grid differs after frame %d", i)
+		}
+		for range 10 {
+			s.Step()
+		}
+		frame = st.encode(STREAMDELTA, s.Tick(), st.last, s.Grid().Cells())
+		copy(st.last, s.Grid().Cells())
+	}
+}
+
+// TestDecodeFrameRejects decodes frames no Stream would send.
+func TestDecodeFrameRejects(t *testing.T) {
+	smallWorld(t)
+	run := func(skip, n uint64, cells ...byte) []byte {
+		raw := []byte{STREAMDELTA, 0}
+		raw = binary.AppendUvarint(raw, skip)
+		raw = binary.AppendUvarint(raw, n)
+		return append(raw, cells...)
+	}
+	for _, tc := range []struct {
+		name string
+		raw  []byte
+	}{
+		{"skip past the end", run(uint64(grid.WIDTH*grid.HEIGHT), 1, byte(sim.Sand))},
+		{"skip that overflows", run(1<<63, 1, byte(sim.Sand))},
+		{"largest skip", run(1<<64-1, 1, byte(sim.Sand))},
+		{"run past the end", run(uint64(grid.WIDTH*grid.HEIGHT-1), 2, byte(sim.Sand), byte(sim.Sand))},
+		{"run longer than the frame", run(0, 3, byte(sim.Sand))},
+		{"unknown material", run(0, 1, byte(len(sim.Elements)))},
+		{"decompresses too far", make([]byte, maxFrame(grid.WIDTH*grid.HEIGHT)+1)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			zw, _ := flate.NewWriter(&buf, flate.BestCompression)
+			zw.Write(tc.raw)
+			zw.Close()
+			grid := sim.NewMaterialGrid()
+			if _, err := DecodeFrame(buf.Bytes(), &grid); err == nil {
+				t.Fatal("decoded")
+			}
+		})
+	}
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"golang.org/x/mobile/event/key"
+	"golang.org/x/mobile/event/mouse"
+
+	"github.com/jdavasligil/sandbox/grid"
+	"github.com/jdavasligil/sandbox/input"
+	"github.com/jdavasligil/sandbox/render"
+	"github.com/jdavasligil/sandbox/sim"
+)
+
+const TUILOG = 64 // log lines kept while the terminal is taken, printed on exit
+
+// TUI is the Renderer of a terminal. Each character cell shows two grid
+// blocks, one above the other, as an upper half block in the colors of the
+// two.
+type TUI struct {
+	paint  chan struct{}
+	events chan any
+}
+
+func (r *TUI) Present() {
+	select {
+	case r.paint <- struct{}{}:
+	default:
+	}
+}
+
+func (r *TUI) Input() <-chan any {
+	return r.events
+}
+
+// RunTUI takes over the terminal, calls run with its Renderer on a
+// goroutine of its own and draws the frames published to shared until
+// ViewQuit. The world is shrunk by a whole factor to fit, averaging the
+// colors of each block, and drawn in the 256 colors of xterm. Log output
+// is held back until the terminal is given back.
+func RunTUI(cfg WindowOptions, shared *render.Shared, run func(Renderer)) {
+	scr, err := tcell.NewScreen()
+	if err != nil {
+		fatal(uiLog, "cannot open the terminal", "err", err)
+	}
+	if err := scr.Init(); err != nil {
+		fatal(uiLog, "cannot open the terminal", "err", err)
+	}
+	logs := &logTail{}
+	out := sim.SetLogOutput(logs)
+	defer func() {
+		scr.Fini()
+		sim.SetLogOutput(out)
+		os.Stderr.WriteString(logs.String())
+	}()
+	scr.EnableMouse()
+	scr.HideCursor()
+
+	r := &TUI{paint: make(chan struct{}, 1), events: make(chan any, EVENTBUF)}
+	go run(r)
+	polled := make(chan tcell.Event)
+	go func() {
+		for {
+			e := scr.PollEvent()
+			if e == nil {
+				return
+			}
+			polled <- e
+		}
+	}()
+
+	shading := render.NewShading()
+	opts := cfg.Draw
+	themes, theme := cfg.Themes, cfg.Theme
+	buf := image.NewRGBA(image.Rect(0, 0, grid.WIDTH, grid.HEIGHT))
+	front := shared.Published()
+	full := true
+	var all, grown grid.Tiles
+	var hud render.HUDCache
+	var perf render.PerfGraph
+	var buttons tcell.ButtonMask // held since the last mouse event
+	var cursor image.Point
+	hover := false
+	frames, fps := 0, 0
+	fpsStart := time.Now()
+	for {
+		select {
+		case e := <-polled:
+			switch e := e.(type) {
+			case *tcell.EventKey:
+				cmd, ok := cfg.Keymap[TUIChord(e)]
+				if !ok {
+					continue
+				}
+				view, ok := cmd.(input.View)
+				if !ok {
+					sendEvent(r.events, cmd)
+					continue
+				}
+				switch view {
+				case input.ViewQuit:
+					return
+				case input.ViewVelocity:
+					if opts.Mode == render.ModeVelocity {
+						opts.Mode = render.ModeNormal
+					} else {
+						opts.Mode = render.ModeVelocity
+					}
+				case input.ViewTrails:
+					opts.Trails = !opts.Trails
+				case input.ViewTheme:
+					theme = (theme + 1) % len(themes)
+					opts.Palette = themes[theme]
+				case input.ViewHUD:
+					opts.HUD = !opts.HUD
+				case input.ViewStats:
+					opts.Panel = !opts.Panel
+				case input.ViewPerf:
+					opts.Perf = !opts.Perf
+				case input.ViewScreenshot:
+					img := render.Snapshot(buf)
+					go func() {
+						path, err := render.SaveScreenshot(render.SCREENSHOTDIR, img)
+						if err != nil {
+							captureLog.Error("screenshot failed", "err", err)
+							return
+						}
+						captureLog.Info("saved screenshot", "path", path)
+					}()
+				default:
+					uiLog.Warn("not supported in the terminal", "command", view)
+				}
+				full = true
+				r.Present()
+			case *tcell.EventMouse:
+				scale := tuiScale(scr.Size())
+				cx, cy := e.Position()
+				cursor = image.Point{cx*scale + scale/2, 2*cy*scale + scale}
+				hover = cursor.In(buf.Bounds())
+				for _, m := range MouseEvents(e.Buttons(), buttons, cursor) {
+					sendEvent(r.events, m)
+				}
+				buttons = e.Buttons() &^ (tcell.WheelUp | tcell.WheelDown)
+			case *tcell.EventResize:
+				scr.Sync()
+				full = true
+				r.Present()
+			}
+		case <-r.paint:
+			drawStart := time.Now()
+			frames++
+			if time.Since(fpsStart) >= time.Second {
+				fps = frames
+				frames = 0
+				fpsStart = time.Now()
+			}
+			var dirty grid.Tiles
+			if f := shared.Published(); f != front {
+				front = f
+				dirty = f.Dirty
+			}
+			if full || opts.Trails {
+				all = grid.AllTiles(all)
+				dirty = all
+				full = false
+			}
+			if len(dirty) > 0 {
+				grown = dirty.Grow(grown)
+				shading.Compute(&front.Grid, grown)
+				for _, i := range grown {
+					render.DrawGrid(&front.Grid, &shading, &front.Field, opts, buf, grid.TileRect(i))
+				}
+			}
+			scale := tuiScale(scr.Size())
+			DrawTerminal(scr, buf, scale)
+			for _, p := range front.Peers {
+				// A mark over the cell, keeping the color of its lower half.
+				x, y := p.X/scale, p.Y/scale/2
+				_, _, style, _ := scr.GetContent(x, y)
+				scr.SetContent(x, y, '+', nil, style.Foreground(Xterm256(opts.Palette.Accent)))
+			}
+			for _, em := range front.Taps {
+				x, y := em.X/scale, em.Y/scale/2
+				_, _, style, _ := scr.GetContent(x, y)
+				scr.SetContent(x, y, 'v', nil, style.Foreground(Xterm256(opts.Palette.Accent)))
+			}
+			for _, pt := range front.Portals {
+				for _, c := range []image.Point{pt.A, pt.B} {
+					x, y := c.X/scale, c.Y/scale/2
+					_, _, style, _ := scr.GetContent(x, y)
+					scr.SetContent(x, y, 'o', nil, style.Foreground(Xterm256(opts.Palette.Accent)))
+				}
+			}
+			if hover {
+				scr.ShowCursor(cursor.X/scale, cursor.Y/scale/2)
+			} else {
+				scr.HideCursor()
+			}
+			if opts.HUD {
+				lines := slices.Clip(hud.Lines(fps, front.Stats, front.Status))
+				if front.Status.Restore {
+					lines = append(lines, cfg.RestoreHint)
+				}
+				if front.Stats.Particles == 0 && cfg.PresetHint != "" {
+					lines = append(lines, cfg.PresetHint)
+				}
+				style := tcell.StyleDefault.Foreground(Xterm256(opts.Palette.Particle)).Background(Xterm256(opts.Palette.Background))
+				for y, line := range lines {
+					for x, c := range line {
+						scr.SetContent(x, y, c, nil, style)
+					}
+				}
+			}
+			if opts.Panel {
+				_, h := scr.Size()
+				style := tcell.StyleDefault.Foreground(Xterm256(opts.Palette.Particle)).Background(Xterm256(opts.Palette.Background))
+				for y, line := range front.Panel {
+					for x, c := range line {
+						scr.SetContent(x, h-len(front.Panel)+y, c, nil, style)
+					}
+				}
+			}
+			if opts.Perf {
+				w, h := scr.Size()
+				style := tcell.StyleDefault.Foreground(Xterm256(opts.Palette.Particle)).Background(Xterm256(opts.Palette.Background))
+				lines := perf.Sparklines(w / 3)
+				for y, line := range lines {
+					for x, c := range []rune(line) {
+						scr.SetContent(w-len([]rune(line))+x, h-len(lines)+y, c, nil, style)
+					}
+				}
+			}
+			if banner := render.Banner(front.Status.Outcome); banner != "" {
+				w, h := scr.Size()
+				style := tcell.StyleDefault.Foreground(Xterm256(opts.Palette.Particle)).Background(Xterm256(opts.Palette.Accent))
+				for x, c := range banner {
+					scr.SetContent((w-len(banner))/2+x, h/2, c, nil, style)
+				}
+			}
+			scr.Show()
+			perf.Add(front.Took, time.Since(drawStart))
+			select {
+			case shared.Ready <- time.Now():
+			default:
+			}
+		}
+	}
+}
+
+// tuiScale returns the whole factor the grid is shrunk by to fit a
+// terminal of w by h characters.
+func tuiScale(w, h int) int {
+	w, h = max(w, 1), max(h, 1)
+	return max((grid.WIDTH+w-1)/w, (grid.HEIGHT+2*h-1)/(2*h), 1)
+}
+
+// DrawTerminal draws img onto scr shrunk by scale, two blocks to a
+// character.
+func DrawTerminal(scr tcell.Screen, img *image.RGBA, scale int) {
+	b := img.Bounds()
+	for cy := 0; 2*cy*scale < b.Dy(); cy++ {
+		for cx := 0; cx*scale < b.Dx(); cx++ {
+			x := cx * scale
+			top := averageRGBA(img, image.Rect(x, 2*cy*scale, x+scale, (2*cy+1)*scale))
+			bottom := averageRGBA(img, image.Rect(x, (2*cy+1)*scale, x+scale, (2*cy+2)*scale))
+			style := tcell.StyleDefault.Foreground(Xterm256(top)).Background(Xterm256(bottom))
+			scr.SetContent(cx, cy, '▀', nil, style)
+		}
+	}
+}
+
+// averageRGBA returns the mean color of img within r.
+func averageRGBA(img *image.RGBA, r image.Rectangle) color.RGBA {
+	r = r.Intersect(img.Bounds())
+	if r.Empty() {
+		return color.RGBA{A: 0xff}
+	}
+	var sr, sg, sb int
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		i := img.PixOffset(r.Min.X, y)
+		p := img.Pix[i : i+4*r.Dx()]
+		for j := 0; j < len(p); j += 4 {
+			sr += int(p[j])
+			sg += int(p[j+1])
+			sb += int(p[j+2])
+		}
+	}
+	n := r.Dx() * r.Dy()
+	return color.RGBA{uint8(sr / n), uint8(sg / n), uint8(sb / n), 0xff}
+}
+
+// cubeLevels are the channel values of the xterm 6x6x6 color cube.
+var cubeLevels = [6]int{0, 95, 135, 175, 215, 255}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// Xterm256 returns the closest of the 256 xterm colors to c, from the color
+// cube or the gray ramp.
+func Xterm256(c color.RGBA) tcell.Color {
+	nearest := func(v int) int {
+		best := 0
+		for i, l := range cubeLevels {
+			if abs(v-l) < abs(v-cubeLevels[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+	dist := func(r, g, b int) int {
+		dr, dg, db := int(c.R)-r, int(c.G)-g, int(c.B)-b
+		return dr*dr + dg*dg + db*db
+	}
+	ri, gi, bi := nearest(int(c.R)), nearest(int(c.G)), nearest(int(c.B))
+	cube := 16 + 36*ri + 6*gi + bi
+	d := dist(cubeLevels[ri], cubeLevels[gi], cubeLevels[bi])
+
+	gray := min(max((int(c.R)+int(c.G)+int(c.B))/3-8+5, 0)/10, 23)
+	v := 8 + 10*gray
+	if dist(v, v, v) < d {
+		return tcell.PaletteColor(232 + gray)
+	}
+	return tcell.PaletteColor(cube)
+}
+
+// MouseEvents returns the mouse events of a terminal pointer at p, in grid
+// coordinates, whose buttons went from was to now. Terminals report which
+// buttons are held rather than presses and releases, so those are inferred.
+func MouseEvents(now, was tcell.ButtonMask, p image.Point) []mouse.Event {
+	e := mouse.Event{X: float32(p.X), Y: float32(p.Y)}
+	var events []mouse.Event
+	for _, b := range []struct {
+		mask   tcell.ButtonMask
+		button mouse.Button
+	}{
+		{tcell.Button1, mouse.ButtonLeft},
+		{tcell.Button2, mouse.ButtonRight},
+		{tcell.Button3, mouse.ButtonMiddle},
+	} {
+		switch {
+		case now&b.mask != 0 && was&b.mask == 0:
+			e.Button, e.Direction = b.button, mouse.DirPress
+		case now&b.mask == 0 && was&b.mask != 0:
+			e.Button, e.Direction = b.button, mouse.DirRelease
+		default:
+			continue
+		}
+		events = append(events, e)
+	}
+	for _, w := range []struct {
+		mask   tcell.ButtonMask
+		button mouse.Button
+	}{
+		{tcell.WheelUp, mouse.ButtonWheelUp},
+		{tcell.WheelDown, mouse.ButtonWheelDown},
+	} {
+		if now&w.mask != 0 {
+			e.Button, e.Direction = w.button, mouse.DirStep
+			events = append(events, e)
+		}
+	}
+	if len(events) == 0 {
+		e.Button, e.Direction = mouse.ButtonNone, mouse.DirNone
+		events = append(events, e)
+	}
+	return events
+}
+
+// tuiKeys names the special keys of the terminal after their key.Code.
+var tuiKeys = map[tcell.Key]string{
+	tcell.KeyEscape:     "escape",
+	tcell.KeyEnter:      "returnenter",
+	tcell.KeyTab:        "tab",
+	tcell.KeyBackspace:  "deletebackspace",
+	tcell.KeyBackspace2: "deletebackspace",
+	tcell.KeyDelete:     "deleteforward",
+	tcell.KeyInsert:     "insert",
+	tcell.KeyHome:       "home",
+	tcell.KeyEnd:        "end",
+	tcell.KeyPgUp:       "pageup",
+	tcell.KeyPgDn:       "pagedown",
+	tcell.KeyLeft:       "leftarrow",
+	tcell.KeyRight:      "rightarrow",
+	tcell.KeyUp:         "uparrow",
+	tcell.KeyDown:       "downarrow",
+	tcell.KeyF1:         "f1",
+	tcell.KeyF2:         "f2",
+	tcell.KeyF3:         "f3",
+	tcell.KeyF4:         "f4",
+	tcell.KeyF5:         "f5",
+	tcell.KeyF6:         "f6",
+	tcell.KeyF7:         "f7",
+	tcell.KeyF8:         "f8",
+	tcell.KeyF9:         "f9",
+	tcell.KeyF10:        "f10",
+	tcell.KeyF11:        "f11",
+	tcell.KeyF12:        "f12",
+}
+
+// tuiRunes names the keys typing punctuation on a US layout. The second
+// half of the string needs shift to type the first.
+var tuiRunes = map[rune]string{
+	' ': "spacebar", '-': "hyphenminus", '=': "equalsign",
+	'[': "leftsquarebracket", ']': "rightsquarebracket", '\\': "backslash",
+	';': "semicolon", '\'': "apostrophe", '`': "graveaccent",
+	',': "comma", '.': "fullstop", '/': "slash",
+}
+
+const tuiShifted = "!@#$%^&*()_+{}|:\"~<>?"
+const tuiUnshifted = "1234567890-=[]\\;'`,./"
+
+// TUIChord returns the chord of a terminal key press.
+func TUIChord(e *tcell.EventKey) input.Chord {
+	var c input.Chord
+	mods := e.Modifiers()
+	if mods&tcell.ModShift != 0 {
+		c.Mods |= key.ModShift
+	}
+	if mods&tcell.ModCtrl != 0 {
+		c.Mods |= key.ModControl
+	}
+	if mods&tcell.ModAlt != 0 {
+		c.Mods |= key.ModAlt
+	}
+	if mods&tcell.ModMeta != 0 {
+		c.Mods |= key.ModMeta
+	}
+	if name, ok := tuiKeys[e.Key()]; ok {
+		c.Code = input.KeyCode(name)
+		return c
+	}
+	if e.Key() >= tcell.KeyCtrlA && e.Key() <= tcell.KeyCtrlZ {
+		c.Code = input.KeyCode(string(rune('a' + e.Key() - tcell.KeyCtrlA)))
+		c.Mods |= key.ModControl
+		return c
+	}
+	r := e.Rune()
+	if i := strings.IndexRune(tuiShifted, r); i >= 0 {
+		r = rune(tuiUnshifted[i])
+		c.Mods |= key.ModShift
+	} else if r >= 'A' && r <= 'Z' {
+		r += 'a' - 'A'
+		c.Mods |= key.ModShift
+	}
+	if name, ok := tuiRunes[r]; ok {
+		c.Code = input.KeyCode(name)
+	} else {
+		c.Code = input.KeyCode(string(r))
+	}
+	return c
+}
+
+// logTail keeps the last TUILOG lines written to it.
+type logTail struct {
+	lines [][]byte
+}
+
+func (t *logTail) Write(p []byte) (int, error) {
+	t.lines = append(t.lines, bytes.Clone(p))
+	if len(t.lines) > TUILOG {
+		t.lines = t.lines[1:]
+	}
+	return len(p), nil
+}
+
+func (t *logTail) String() string {
+	return string(bytes.Join(t.lines, nil))
+}
@@ -3,15 +3,24 @@ module github.com/jdavasligil/sandbox
 go 1.22.0
 
 require (
+	github.com/gdamore/tcell/v2 v2.7.4
 	github.com/jdavasligil/go-ecs v1.1.0
+	github.com/yuin/gopher-lua v1.1.1
 	golang.org/x/exp/shiny v0.0.0-20240416160154-fe59bbe5cc7f
+	golang.org/x/image v0.15.0
 	golang.org/x/mobile v0.0.0-20240404231514-09dbf07665ed
+	golang.org/x/net v0.24.0
 )
 
 require (
 	dmitri.shuralyov.com/gpu/mtl v0.0.0-20221208032759-85de2813cf6b // indirect
+	github.com/gdamore/encoding v1.0.0 // indirect
 	github.com/go-gl/glfw/v3.3/glfw v0.0.0-20231223183121-56fa3ac82ce7 // indirect
 	github.com/jezek/xgb v1.1.1 // indirect
-	golang.org/x/image v0.15.0 // indirect
+	github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
+	github.com/mattn/go-runewidth v0.0.15 // indirect
+	github.com/rivo/uniseg v0.4.3 // indirect
 	golang.org/x/sys v0.19.0 // indirect
+	golang.org/x/term v0.19.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
 )
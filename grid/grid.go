@@ -0,0 +1,85 @@
+// Package grid holds the size of the world and the bitsets and tiles laid
+// over it that the simulation and the renderers share.
+package grid
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// World size, set from sandbox.toml by sim.Configure.
+var (
+	WIDTH  = 800
+	HEIGHT = 800
+)
+
+// Grid records which cells are occupied by resting particles or walls, one
+// bit per cell. Each row starts on a new word, so cells 64 columns apart
+// never share one.
+type Grid struct {
+	sync.Mutex
+	data   []uint64
+	stride int // words per row
+}
+
+func NewGrid() Grid {
+	stride := (WIDTH + 63) / 64
+	return Grid{
+		data:   make([]uint64, stride*HEIGHT),
+		stride: stride,
+	}
+}
+
+func (g *Grid) IsSet(x, y int) bool {
+	return g.data[x>>6+g.stride*y]&(1<<(x&63)) != 0
+}
+
+func (g *Grid) Set(x, y int) {
+	g.data[x>>6+g.stride*y] |= 1 << (x & 63)
+}
+
+func (g *Grid) Clear(x, y int) {
+	g.data[x>>6+g.stride*y] &^= 1 << (x & 63)
+}
+
+func (g *Grid) Reset() {
+	clear(g.data)
+}
+
+// AnySet reports whether any cell of row y in [x0, x1) is set.
+func (g *Grid) AnySet(x0, x1, y int) bool {
+	if x0 >= x1 {
+		return false
+	}
+	row := g.data[g.stride*y:]
+	first, last := x0>>6, (x1-1)>>6
+	lo := ^uint64(0) << (x0 & 63)
+	hi := ^uint64(0) >> (63 - (x1-1)&63)
+	if first == last {
+		return row[first]&lo&hi != 0
+	}
+	if row[first]&lo != 0 || row[last]&hi != 0 {
+		return true
+	}
+	for _, w := range row[first+1 : last] {
+		if w != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Count returns the number of set cells.
+func (g *Grid) Count() int {
+	n := 0
+	for _, w := range g.data {
+		n += bits.OnesCount64(w)
+	}
+	return n
+}
+
+// Words returns the bits of the grid, a row of words at a time, for saving
+// and loading it whole.
+func (g *Grid) Words() []uint64 {
+	return g.data
+}
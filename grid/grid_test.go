@@ -0,0 +1,85 @@
+package grid
+
+import "testing"
+
+// gridEdges are columns at and around the word boundaries of a row of the
+// small world, which is 200 cells wide: its last word holds just 8 cells.
+var gridEdges = []int{0, 1, 62, 63, 64, 65, 127, 128, 191, 192, 198, 199}
+
+// smallWorld shrinks the world to 200x150 cells until t ends.
+func smallWorld(t *testing.T) {
+	w, h := WIDTH, HEIGHT
+	WIDTH, HEIGHT = 200, 150
+	t.Cleanup(func() { WIDTH, HEIGHT = w, h })
+}
+
+func TestGridAnySet(t *testing.T) {
+	smallWorld(t)
+	const y = 1
+	for _, set := range gridEdges {
+		g := NewGrid()
+		g.Set(set, y)
+		// Neighbouring rows must not leak into the row asked about.
+		g.Set(WIDTH-1, y-1)
+		g.Set(0, y+1)
+		for _, x0 := range append(gridEdges, WIDTH) {
+			for _, x1 := range append(gridEdges, WIDTH) {
+				want := x0 <= set && set < x1
+				if got := g.AnySet(x0, x1, y); got != want {
+					t.Errorf("cell %d set: AnySet(%d, %d) = %v, want %v", set, x0, x1, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestGridAnySetFullRow(t *testing.T) {
+	smallWorld(t)
+	g := NewGrid()
+	for x := range WIDTH {
+		g.Set(x, 0)
+	}
+	for _, x0 := range gridEdges {
+		for _, x1 := range append(gridEdges, WIDTH) {
+			if got := g.AnySet(x0, x1, 0); got != (x0 < x1) {
+				t.Errorf("full row: AnySet(%d, %d) = %v", x0, x1, got)
+			}
+		}
+	}
+	if g.AnySet(0, WIDTH, 1) {
+		t.Error("full row 0 shows in row 1")
+	}
+}
+
+func TestGridCount(t *testing.T) {
+	smallWorld(t)
+	g := NewGrid()
+	if n := g.Count(); n != 0 {
+		t.Fatalf("new grid counts %d", n)
+	}
+	n := 0
+	for _, y := range []int{0, 1, HEIGHT - 1} {
+		for _, x := range gridEdges {
+			g.Set(x, y)
+			g.Set(x, y) // setting twice counts once
+			n++
+		}
+	}
+	if got := g.Count(); got != n {
+		t.Fatalf("Count = %d, want %d", got, n)
+	}
+	g.Clear(63, 0)
+	g.Clear(64, 0)
+	g.Clear(WIDTH-1, HEIGHT-1)
+	if got := g.Count(); got != n-3 {
+		t.Fatalf("Count after clearing 3 = %d, want %d", got, n-3)
+	}
+	for x := range WIDTH {
+		for y := range HEIGHT {
+			g.Set(x, y)
+		}
+	}
+	if got := g.Count(); got != WIDTH*HEIGHT {
+		t.Fatalf("full grid counts %d, want %d", got, WIDTH*HEIGHT)
+	}
+}
@@ -0,0 +1,122 @@
+package grid
+
+import (
+	"image"
+	"slices"
+)
+
+const TILE = 16 // side of a tile of the change list; at least MAXDEPTH
+
+// Tiles lists TILE sized squares of the world by index, in raster order.
+// It tracks which parts of the grid need copying, shading and drawing.
+//
+// Functions returning Tiles write them over dst, reusing its storage, which
+// must not be shared with their other arguments.
+type Tiles []int
+
+// TilesAcross returns the number of tiles in a row of the world.
+func TilesAcross() int {
+	return (WIDTH + TILE - 1) / TILE
+}
+
+// TilesDown returns the number of rows of tiles in the world.
+func TilesDown() int {
+	return (HEIGHT + TILE - 1) / TILE
+}
+
+// TileOf returns the index of the tile holding (x, y).
+func TileOf(x, y int) int {
+	return x/TILE + TilesAcross()*(y/TILE)
+}
+
+// TileRect returns the cells of tile i.
+func TileRect(i int) image.Rectangle {
+	w := TilesAcross()
+	x, y := i%w*TILE, i/w*TILE
+	return image.Rect(x, y, x+TILE, y+TILE).Intersect(image.Rect(0, 0, WIDTH, HEIGHT))
+}
+
+// AllTiles returns every tile of the world.
+func AllTiles(dst Tiles) Tiles {
+	t := dst[:0]
+	for i := range TilesAcross() * TilesDown() {
+		t = append(t, i)
+	}
+	return t
+}
+
+// TilesOf returns the tiles overlapping r.
+func TilesOf(r image.Rectangle, dst Tiles) Tiles {
+	t := dst[:0]
+	r = r.Intersect(image.Rect(0, 0, WIDTH, HEIGHT))
+	if r.Empty() {
+		return t
+	}
+	w := TilesAcross()
+	for ty := r.Min.Y / TILE; ty <= (r.Max.Y-1)/TILE; ty++ {
+		for tx := r.Min.X / TILE; tx <= (r.Max.X-1)/TILE; tx++ {
+			t = append(t, tx+w*ty)
+		}
+	}
+	return t
+}
+
+// Union returns the tiles in either t or o.
+func (t Tiles) Union(o, dst Tiles) Tiles {
+	u := dst[:0]
+	i, j := 0, 0
+	for i < len(t) || j < len(o) {
+		switch {
+		case j == len(o) || i < len(t) && t[i] < o[j]:
+			u = append(u, t[i])
+			i++
+		case i == len(t) || o[j] < t[i]:
+			u = append(u, o[j])
+			j++
+		default:
+			u = append(u, t[i])
+			i++
+			j++
+		}
+	}
+	return u
+}
+
+// Grow returns t along with every tile touching one of its tiles.
+func (t Tiles) Grow(dst Tiles) Tiles {
+	w, h := TilesAcross(), TilesDown()
+	if len(t) == w*h {
+		return append(dst[:0], t...)
+	}
+	g := dst[:0]
+	for _, i := range t {
+		tx, ty := i%w, i/w
+		for y := max(ty-1, 0); y <= min(ty+1, h-1); y++ {
+			for x := max(tx-1, 0); x <= min(tx+1, w-1); x++ {
+				g = append(g, x+w*y)
+			}
+		}
+	}
+	slices.Sort(g)
+	return slices.Compact(g)
+}
+
+// Bounds returns the smallest rectangle holding every tile of t.
+func (t Tiles) Bounds() image.Rectangle {
+	var r image.Rectangle
+	for _, i := range t {
+		r = r.Union(TileRect(i))
+	}
+	return r
+}
+
+// TilesIn lists the tiles marked in set.
+func TilesIn(set []bool, dst Tiles) Tiles {
+	t := dst[:0]
+	for i, ok := range set {
+		if ok {
+			t = append(t, i)
+		}
+	}
+	return t
+}
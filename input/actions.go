@@ -0,0 +1,94 @@
+package input
+
+// Action is a one-shot command sent from the UI to the simulation.
+type Action uint8
+
+const (
+	ActionUndo         Action = iota // revert the last stroke
+	ActionRedo                       // reapply the last undone stroke
+	ActionPause                      // freeze or resume physics
+	ActionStep                       // advance one tick while paused
+	ActionSlower                     // halve the simulation speed
+	ActionFaster                     // double the simulation speed
+	ActionClear                      // remove everything from the world
+	ActionNextMaterial               // select the following material
+	ActionPrevMaterial               // select the preceding material
+	ActionStamp                      // place the selected stamp at the cursor
+	ActionNextStamp                  // select the following stamp
+	ActionSymmetry                   // cycle the symmetry mode
+	ActionCopy                       // copy the selection to the clipboard
+	ActionCut                        // copy the selection, then erase it
+	ActionPaste                      // paste the clipboard at the cursor
+	ActionDelete                     // erase the selection
+	ActionSave                       // write the world to the save file
+	ActionLoad                       // restore the world from the save file
+	ActionRestore                    // load the autosave found at startup
+	ActionTap                        // start or stop a tap at the cursor
+	ActionPortal                     // open, link or remove a portal at the cursor
+	ActionMute                       // silence the sound or bring it back
+	ActionQuieter                    // lower the volume
+	ActionLouder                     // raise the volume
+	ActionNextTrack                  // skip to the next music track
+	ActionMusicQuieter               // lower the music volume
+	ActionMusicLouder                // raise the music volume
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionUndo:
+		return "undo"
+	case ActionRedo:
+		return "redo"
+	case ActionPause:
+		return "pause"
+	case ActionStep:
+		return "step"
+	case ActionSlower:
+		return "slower"
+	case ActionFaster:
+		return "faster"
+	case ActionClear:
+		return "clear"
+	case ActionNextMaterial:
+		return "next-material"
+	case ActionPrevMaterial:
+		return "prev-material"
+	case ActionStamp:
+		return "stamp"
+	case ActionNextStamp:
+		return "next-stamp"
+	case ActionSymmetry:
+		return "symmetry"
+	case ActionCopy:
+		return "copy"
+	case ActionCut:
+		return "cut"
+	case ActionPaste:
+		return "paste"
+	case ActionDelete:
+		return "delete"
+	case ActionSave:
+		return "save"
+	case ActionLoad:
+		return "load"
+	case ActionRestore:
+		return "restore"
+	case ActionTap:
+		return "tap"
+	case ActionPortal:
+		return "portal"
+	case ActionMute:
+		return "mute"
+	case ActionQuieter:
+		return "quieter"
+	case ActionLouder:
+		return "louder"
+	case ActionNextTrack:
+		return "next-track"
+	case ActionMusicQuieter:
+		return "music-quieter"
+	case ActionMusicLouder:
+		return "music-louder"
+	}
+	return "unknown"
+}
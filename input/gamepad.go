@@ -0,0 +1,80 @@
+package input
+
+import (
+	"time"
+
+	"golang.org/x/mobile/event/mouse"
+
+	"github.com/jdavasligil/sandbox/grid"
+)
+
+const (
+	PADRATE     = 60   // gamepad polls per second
+	PADSPEED    = 400  // cursor px/s at full stick deflection
+	PADDEADZONE = 0.15 // stick deflection ignored as drift
+)
+
+// Pad is the state of the gamepad controls used by the sandbox.
+type Pad struct {
+	X, Y  float32 // left stick, -1 to 1
+	Spawn bool    // right trigger
+	Erase bool    // left trigger
+	DPad  int     // d-pad horizontal: -1, 0 or 1
+}
+
+// PadEvent is a pointer event driven by the gamepad. Unlike window mouse
+// events it is already in grid coordinates.
+type PadEvent struct {
+	mouse.Event
+}
+
+// RunGamepad polls read for the pad state and turns it into input: the stick
+// moves a cursor, the triggers press the spawn and erase buttons, and the
+// d-pad cycles the material. It never returns.
+func RunGamepad(read func() Pad, send func(any)) {
+	cursor := PadEvent{mouse.Event{X: float32(grid.WIDTH / 2), Y: float32(grid.HEIGHT / 2)}}
+	var last Pad
+	for range time.Tick(time.Second / PADRATE) {
+		p := read()
+
+		moved := false
+		for _, d := range [2]struct {
+			v   float32
+			pos *float32
+			n   float32
+		}{{p.X, &cursor.X, float32(grid.WIDTH)}, {p.Y, &cursor.Y, float32(grid.HEIGHT)}} {
+			if d.v > PADDEADZONE || d.v < -PADDEADZONE {
+				*d.pos = max(min(*d.pos+d.v*PADSPEED/PADRATE, d.n-1), 0)
+				moved = true
+			}
+		}
+
+		button := mouse.ButtonNone
+		if p.Spawn {
+			button = mouse.ButtonLeft
+		} else if p.Erase {
+			button = mouse.ButtonRight
+		}
+		if button != cursor.Button {
+			if cursor.Button != mouse.ButtonNone {
+				cursor.Direction = mouse.DirRelease
+				send(cursor)
+			}
+			cursor.Button = button
+			if button != mouse.ButtonNone {
+				cursor.Direction = mouse.DirPress
+				send(cursor)
+			}
+		} else if moved {
+			cursor.Direction = mouse.DirNone
+			send(cursor)
+		}
+
+		if p.DPad != last.DPad && p.DPad > 0 {
+			send(ActionNextMaterial)
+		} else if p.DPad != last.DPad && p.DPad < 0 {
+			send(ActionPrevMaterial)
+		}
+		last = p
+	}
+}
@@ -0,0 +1,71 @@
+package input
+
+import (
+	"encoding/binary"
+	"os"
+	"sync"
+)
+
+// Event types and control numbers of the Linux joystick interface, laid out
+// as the kernel's xpad driver reports an Xbox-style controller.
+const (
+	jsButton = 0x01
+	jsAxis   = 0x02
+	jsInit   = 0x80
+
+	jsAxisX    = 0
+	jsAxisY    = 1
+	jsAxisLT   = 2
+	jsAxisRT   = 5
+	jsAxisHatX = 6
+	jsAxisMax  = 32767
+)
+
+// jsEvent mirrors struct js_event from linux/joystick.h.
+type jsEvent struct {
+	Time   uint32
+	Value  int16
+	Type   uint8
+	Number uint8
+}
+
+// OpenGamepad starts reading the joystick device at path, such as
+// /dev/input/js0, and returns a function reporting its latest state.
+func OpenGamepad(path string) (func() Pad, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	var mu sync.Mutex
+	var pad Pad
+	go func() {
+		defer f.Close()
+		var e jsEvent
+		for binary.Read(f, binary.NativeEndian, &e) == nil {
+			if e.Type&^jsInit != jsAxis {
+				continue
+			}
+			v := float32(e.Value) / jsAxisMax
+			mu.Lock()
+			switch e.Number {
+			case jsAxisX:
+				pad.X = v
+			case jsAxisY:
+				pad.Y = v
+			case jsAxisLT:
+				// Triggers rest at -1.
+				pad.Erase = v > 0
+			case jsAxisRT:
+				pad.Spawn = v > 0
+			case jsAxisHatX:
+				pad.DPad = int(max(min(e.Value, 1), -1))
+			}
+			mu.Unlock()
+		}
+	}()
+	return func() Pad {
+		mu.Lock()
+		defer mu.Unlock()
+		return pad
+	}, nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package input
+
+import (
+	"errors"
+)
+
+// OpenGamepad reports that gamepads are only supported on Linux.
+func OpenGamepad(path string) (func() Pad, error) {
+	return nil, errors.New("gamepad input is only supported on linux")
+}
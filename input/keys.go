@@ -0,0 +1,255 @@
+// Package input maps keys and gamepad buttons to the commands of the
+// sandbox, loading key bindings from JSON.
+package input
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"golang.org/x/mobile/event/key"
+)
+
+// View is a command handled by the window rather than the simulation.
+type View uint8
+
+const (
+	ViewQuit        View = iota // close the window
+	ViewVelocity                // toggle velocity colouring
+	ViewTrails                  // toggle motion trails
+	ViewTheme                   // cycle the colour theme
+	ViewHUD                     // toggle the HUD
+	ViewScreenshot              // save the current frame as a PNG
+	ViewRecordGIF               // start or stop recording an animated GIF
+	ViewRecordVideo             // start or stop streaming video to ffmpeg
+	ViewStats                   // toggle the panel of per-material stats
+	ViewPerf                    // toggle the graph of tick, draw and GC times
+)
+
+func (v View) String() string {
+	switch v {
+	case ViewQuit:
+		return "quit"
+	case ViewVelocity:
+		return "velocity"
+	case ViewTrails:
+		return "trails"
+	case ViewTheme:
+		return "theme"
+	case ViewHUD:
+		return "hud"
+	case ViewScreenshot:
+		return "screenshot"
+	case ViewRecordGIF:
+		return "record-gif"
+	case ViewRecordVideo:
+		return "record-video"
+	case ViewStats:
+		return "stats"
+	case ViewPerf:
+		return "perf"
+	}
+	return "unknown"
+}
+
+// MODMASK holds the modifiers that distinguish chords.
+const MODMASK = key.ModShift | key.ModControl | key.ModAlt | key.ModMeta
+
+// Chord is a key pressed while holding exactly Mods.
+type Chord struct {
+	Code key.Code
+	Mods key.Modifiers
+}
+
+// ChordOf returns the chord of a key event.
+func ChordOf(e key.Event) Chord {
+	return Chord{e.Code, e.Modifiers & MODMASK}
+}
+
+// Keymap maps chords to the command they trigger: an Action for the
+// simulation, a View for the window, or whatever other commands have been
+// added to DefaultKeys, such as the materials and tools of sim.
+type Keymap map[Chord]any
+
+// Binding is a bindable command and its default chords. A command is named
+// in config files by its String.
+type Binding struct {
+	Command any
+	Chords  []string
+}
+
+// DefaultKeys lists every bindable command with its default chords. Packages
+// defining commands of their own append them from an init function.
+var DefaultKeys = []Binding{
+	{ViewQuit, []string{"escape"}},
+	{ViewVelocity, []string{"v"}},
+	{ViewTrails, []string{"t"}},
+	{ViewTheme, []string{"p"}},
+	{ViewHUD, []string{"h"}},
+	{ViewScreenshot, []string{"f12"}},
+	{ViewRecordGIF, []string{"f9"}},
+	{ViewRecordVideo, []string{"f10"}},
+	{ViewStats, []string{"i"}},
+	{ViewPerf, []string{"k"}},
+	{ActionUndo, []string{"ctrl+z"}},
+	{ActionRedo, []string{"ctrl+shift+z", "ctrl+y"}},
+	{ActionPause, []string{"spacebar"}},
+	{ActionStep, []string{"fullstop"}},
+	{ActionSlower, []string{"hyphenminus"}},
+	{ActionFaster, []string{"equalsign"}},
+	{ActionClear, []string{"c"}},
+	{ActionPrevMaterial, []string{"leftsquarebracket"}},
+	{ActionNextMaterial, []string{"rightsquarebracket"}},
+	{ActionStamp, []string{"s"}},
+	{ActionNextStamp, []string{"shift+s"}},
+	{ActionSymmetry, []string{"m"}},
+	{ActionCopy, []string{"ctrl+c"}},
+	{ActionCut, []string{"ctrl+x"}},
+	{ActionPaste, []string{"ctrl+v"}},
+	{ActionDelete, []string{"deleteforward", "deletebackspace"}},
+	{ActionSave, []string{"ctrl+s"}},
+	{ActionLoad, []string{"ctrl+o"}},
+	{ActionRestore, []string{"ctrl+shift+o"}},
+	{ActionTap, []string{"a"}},
+	{ActionPortal, []string{"o"}},
+	{ActionMute, []string{"ctrl+m"}},
+	{ActionQuieter, []string{"ctrl+hyphenminus"}},
+	{ActionLouder, []string{"ctrl+equalsign"}},
+	{ActionNextTrack, []string{"ctrl+n"}},
+	{ActionMusicQuieter, []string{"ctrl+shift+hyphenminus"}},
+	{ActionMusicLouder, []string{"ctrl+shift+equalsign"}},
+}
+
+// keyNames maps lower case key names, such as "a" or "spacebar", to codes.
+var keyNames = func() map[string]key.Code {
+	names := make(map[string]key.Code)
+	for c := key.CodeUnknown; c <= key.CodeCompose; c++ {
+		if s := c.String(); !strings.HasPrefix(s, "Code(") {
+			names[strings.ToLower(strings.TrimPrefix(s, "Code"))] = c
+		}
+	}
+	return names
+}()
+
+// KeyCode returns the code of the key a chord names name, such as "a" or
+// "spacebar", or key.CodeUnknown if there is no such key.
+func KeyCode(name string) key.Code {
+	return keyNames[name]
+}
+
+func (c Chord) String() string {
+	var s string
+	for _, m := range []struct {
+		mod  key.Modifiers
+		name string
+	}{{key.ModControl, "ctrl"}, {key.ModShift, "shift"}, {key.ModAlt, "alt"}, {key.ModMeta, "meta"}} {
+		if c.Mods&m.mod != 0 {
+			s += m.name + "+"
+		}
+	}
+	return s + strings.ToLower(strings.TrimPrefix(c.Code.String(), "Code"))
+}
+
+// IsCommand reports whether name names a bindable command.
+func IsCommand(name string) bool {
+	return slices.ContainsFunc(DefaultKeys, func(b Binding) bool { return fmt.Sprint(b.Command) == name })
+}
+
+// Find returns a chord bound to cmd, if any.
+func (km Keymap) Find(cmd any) (Chord, bool) {
+	for c, v := range km {
+		if v == cmd {
+			return c, true
+		}
+	}
+	return Chord{}, false
+}
+
+// ParseChord parses a chord such as "ctrl+shift+z". Keys are named after
+// their key.Code constants without the prefix, ignoring case.
+func ParseChord(s string) (Chord, error) {
+	parts := strings.Split(strings.ToLower(s), "+")
+	var c Chord
+	for _, mod := range parts[:len(parts)-1] {
+		switch mod {
+		case "shift":
+			c.Mods |= key.ModShift
+		case "ctrl", "control":
+			c.Mods |= key.ModControl
+		case "alt":
+			c.Mods |= key.ModAlt
+		case "meta":
+			c.Mods |= key.ModMeta
+		default:
+			return c, fmt.Errorf("chord %q: unknown modifier %q", s, mod)
+		}
+	}
+	code, ok := keyNames[parts[len(parts)-1]]
+	if !ok {
+		return c, fmt.Errorf("chord %q: unknown key %q", s, parts[len(parts)-1])
+	}
+	c.Code = code
+	return c, nil
+}
+
+// LoadKeymap returns the default keymap with the bindings of the JSON file
+// at path applied, or the defaults alone if path is empty. The file maps
+// command names to lists of chords, replacing the defaults of each command
+// it names:
+//
+//	{"pause": ["p"], "theme": ["shift+p"], "undo": ["ctrl+z", "u"]}
+//
+// A chord claimed by the file is removed from any default that used it.
+func LoadKeymap(path string) (Keymap, error) {
+	bindings := make(map[string][]string)
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &bindings); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	commands := make(map[string]any)
+	for _, d := range DefaultKeys {
+		commands[fmt.Sprint(d.Command)] = d.Command
+	}
+	for name := range bindings {
+		if _, ok := commands[name]; !ok {
+			return nil, fmt.Errorf("%s: unknown command %q", path, name)
+		}
+	}
+
+	km := make(Keymap)
+	for _, d := range DefaultKeys {
+		if _, ok := bindings[fmt.Sprint(d.Command)]; ok {
+			continue
+		}
+		for _, s := range d.Chords {
+			c, err := ParseChord(s)
+			if err != nil {
+				return nil, err
+			}
+			km[c] = d.Command
+		}
+	}
+	user := make(map[Chord]string)
+	for name, chords := range bindings {
+		for _, s := range chords {
+			c, err := ParseChord(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			if other, ok := user[c]; ok && other != name {
+				return nil, fmt.Errorf("%s: %q is bound to both %q and %q", path, s, other, name)
+			}
+			user[c] = name
+			km[c] = commands[name]
+		}
+	}
+	return km, nil
+}
@@ -0,0 +1,115 @@
+package input
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/mobile/event/key"
+)
+
+func TestParseChord(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want Chord
+		ok   bool
+	}{
+		{"a", Chord{key.CodeA, 0}, true},
+		{"A", Chord{key.CodeA, 0}, true},
+		{"spacebar", Chord{key.CodeSpacebar, 0}, true},
+		{"f12", Chord{key.CodeF12, 0}, true},
+		{"ctrl+z", Chord{key.CodeZ, key.ModControl}, true},
+		{"control+z", Chord{key.CodeZ, key.ModControl}, true},
+		{"Ctrl+Shift+Z", Chord{key.CodeZ, key.ModControl | key.ModShift}, true},
+		{"shift+ctrl+z", Chord{key.CodeZ, key.ModControl | key.ModShift}, true},
+		{"alt+meta+hyphenminus", Chord{key.CodeHyphenMinus, key.ModAlt | key.ModMeta}, true},
+		{"", Chord{}, false},
+		{"ctrl+", Chord{}, false},
+		{"+z", Chord{}, false},
+		{"super+z", Chord{}, false},
+		{"z+ctrl", Chord{}, false},
+		{"nosuchkey", Chord{}, false},
+		{"codea", Chord{}, false},
+	} {
+		got, err := ParseChord(tc.in)
+		if (err == nil) != tc.ok {
+			t.Errorf("ParseChord(%q): err %v, want ok %v", tc.in, err, tc.ok)
+			continue
+		}
+		if tc.ok && got != tc.want {
+			t.Errorf("ParseChord(%q) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestChordStringRoundTrip(t *testing.T) {
+	for _, d := range DefaultKeys {
+		for _, s := range d.Chords {
+			c, err := ParseChord(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			back, err := ParseChord(c.String())
+			if err != nil || back != c {
+				t.Errorf("%q prints as %q, which parses to %v, %v", s, c.String(), back, err)
+			}
+		}
+	}
+}
+
+func TestLoadKeymap(t *testing.T) {
+	chord := func(s string) Chord {
+		c, err := ParseChord(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	for _, tc := range []struct {
+		name string
+		file string
+		want map[string]any // chords that must be bound, or unbound if nil
+		ok   bool
+	}{
+		{"defaults", "", map[string]any{"spacebar": ActionPause, "ctrl+z": ActionUndo, "ctrl+y": ActionRedo}, true},
+		{"rebind", `{"pause": ["p", "ctrl+p"]}`,
+			map[string]any{"p": ActionPause, "ctrl+p": ActionPause, "spacebar": nil}, true},
+		{"steal a default chord", `{"undo": ["c"]}`,
+			map[string]any{"c": ActionUndo, "ctrl+z": nil}, true},
+		{"unbind", `{"quit": []}`, map[string]any{"escape": nil}, true},
+		{"same chord twice for one command", `{"undo": ["u", "U"]}`, map[string]any{"u": ActionUndo}, true},
+		{"duplicate chord", `{"undo": ["u"], "redo": ["u"]}`, nil, false},
+		{"duplicate chord with modifiers", `{"undo": ["ctrl+shift+u"], "redo": ["shift+ctrl+u"]}`, nil, false},
+		{"unknown command", `{"explode": ["x"]}`, nil, false},
+		{"unknown key", `{"undo": ["ctrl+nosuchkey"]}`, nil, false},
+		{"unknown modifier", `{"undo": ["hyper+z"]}`, nil, false},
+		{"not json", `undo = z`, nil, false},
+		{"wrong shape", `{"undo": "z"}`, nil, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := ""
+			if tc.file != "" {
+				path = filepath.Join(t.TempDir(), "keys.json")
+				if err := os.WriteFile(path, []byte(tc.file), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			km, err := LoadKeymap(path)
+			if (err == nil) != tc.ok {
+				t.Fatalf("err %v, want ok %v", err, tc.ok)
+			}
+			for s, want := range tc.want {
+				got, bound := km[chord(s)]
+				switch {
+				case want == nil && bound:
+					t.Errorf("%s is bound to %v, want unbound", s, got)
+				case want != nil && got != want:
+					t.Errorf("%s is bound to %v, want %v", s, got, want)
+				}
+			}
+		})
+	}
+	if _, err := LoadKeymap(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("loaded a missing keymap")
+	}
+}
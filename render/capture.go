@@ -0,0 +1,62 @@
+package render
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jdavasligil/sandbox/grid"
+	"github.com/jdavasligil/sandbox/sim"
+)
+
+const SCREENSHOTDIR = "screenshots"
+
+// Snapshot returns a copy of img that stays valid while img is redrawn.
+func Snapshot(img *image.RGBA) *image.RGBA {
+	dst := image.NewRGBA(img.Bounds())
+	copy(dst.Pix, img.Pix)
+	return dst
+}
+
+// SaveScreenshot writes img to a timestamped PNG in dir and returns its path.
+func SaveScreenshot(dir string, img image.Image) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, time.Now().Format("sandbox-20060102-150405.000.png"))
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
+
+// DrawWorld draws the world of s as the renderer would, without the HUD
+// and cursor.
+func DrawWorld(s *sim.Simulation, opts DrawOptions) *image.RGBA {
+	shading := NewShading()
+	shading.Compute(s.Grid(), grid.AllTiles(nil))
+	img := image.NewRGBA(s.Grid().Bounds())
+	DrawGrid(s.Grid(), &shading, s.Field(), opts, img, img.Bounds())
+	return img
+}
+
+// WriteSnapshot writes the DrawWorld image of s to path as a PNG.
+func WriteSnapshot(path string, s *sim.Simulation, opts DrawOptions) error {
+	img := DrawWorld(s, opts)
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,262 @@
+// Package render draws the frames a simulation publishes: the world, the
+// HUD, the toolbar and the recordings made of them.
+package render
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"slices"
+
+	"github.com/jdavasligil/sandbox/grid"
+	"github.com/jdavasligil/sandbox/sim"
+)
+
+const (
+	MAXDEPTH  = 16   // depth at which shading saturates
+	MINSHADE  = 0.35 // brightness of the deepest particles
+	TRAILFADE = 0.8  // fraction of a trail kept each frame
+)
+
+// RenderMode selects how DrawGrid colors particles.
+type RenderMode uint8
+
+const (
+	ModeNormal RenderMode = iota
+	ModeVelocity
+)
+
+// DrawOptions collects the render settings toggled from the keyboard.
+type DrawOptions struct {
+	Mode RenderMode
+
+	// Trails fades empty cells toward the background instead of clearing
+	// them, leaving streaks behind moving particles.
+	Trails bool
+
+	// HUD draws the frame rate and simulation stats in the corner.
+	HUD bool
+
+	// Panel draws the particles and memory of each material in the
+	// bottom corner.
+	Panel bool
+
+	// Perf graphs the recent tick, draw and GC pause times in the other
+	// bottom corner.
+	Perf bool
+
+	// Background shows through empty cells. A nil background is drawn
+	// in the palette's background color.
+	Background *image.RGBA
+
+	Palette Palette
+}
+
+// DrawGrid paints the cells of g within r into img.
+func DrawGrid(g *sim.MaterialGrid, s *Shading, f *sim.Field, opts DrawOptions, img *image.RGBA, r image.Rectangle) {
+	for x := r.Min.X; x < r.Max.X; x++ {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			if !g.IsSet(x, y) {
+				bg := opts.BackgroundAt(x, y)
+				if opts.Trails {
+					img.SetRGBA(x, y, fade(img.RGBAAt(x, y), bg))
+				} else {
+					img.SetRGBA(x, y, bg)
+				}
+			} else if opts.Mode == ModeVelocity {
+				img.SetRGBA(x, y, VelocityColor(f.At(x, y)))
+			} else {
+				img.SetRGBA(x, y, s.Shade(opts.Palette.Color(g.At(x, y)), x, y))
+			}
+		}
+	}
+}
+
+// BackgroundAt returns the color showing through empty cell (x, y).
+func (opts *DrawOptions) BackgroundAt(x, y int) color.RGBA {
+	if opts.Background != nil {
+		return opts.Background.RGBAAt(x, y)
+	}
+	return opts.Palette.Background
+}
+
+// CellColor returns the color DrawGrid paints set cell (x, y) of g.
+func (opts *DrawOptions) CellColor(g *sim.MaterialGrid, s *Shading, f *sim.Field, x, y int) color.RGBA {
+	if opts.Mode == ModeVelocity {
+		return VelocityColor(f.At(x, y))
+	}
+	return s.Shade(opts.Palette.Color(g.At(x, y)), x, y)
+}
+
+// DrawMotion redraws the particles that moved over the tick of frame f
+// alpha of the way along their moves, so motion stays smooth when frames
+// and ticks do not line up. img must hold f's grid as DrawGrid paints it.
+// It writes over dst the tiles it drew on, which need repainting before
+// the next frame is drawn.
+func DrawMotion(f *Frame, s *Shading, opts DrawOptions, img *image.RGBA, dst grid.Tiles) grid.Tiles {
+	t := dst[:0]
+	g := &f.Grid
+	// Lift every particle off its cell before drawing any of them, as
+	// particles may move into cells others just left.
+	for _, m := range f.Motion {
+		x, y := int(m.To.X), int(m.To.Y)
+		if g.At(x, y) == m.M {
+			img.SetRGBA(x, y, opts.BackgroundAt(x, y))
+			t = append(t, grid.TileOf(x, y))
+		}
+	}
+	for _, m := range f.Motion {
+		x, y := int(m.To.X), int(m.To.Y)
+		if g.At(x, y) != m.M {
+			// Edited away since it moved.
+			continue
+		}
+		c := opts.CellColor(g, s, &f.Field, x, y)
+		px := int(m.From.X + (m.To.X-m.From.X)*f.Alpha)
+		py := int(m.From.Y + (m.To.Y-m.From.Y)*f.Alpha)
+		img.SetRGBA(px, py, c)
+		t = append(t, grid.TileOf(px, py))
+	}
+	slices.Sort(t)
+	return slices.Compact(t)
+}
+
+// fade moves c a step of TRAILFADE toward the background color bg.
+func fade(c, bg color.RGBA) color.RGBA {
+	mix := func(a, b uint8) uint8 {
+		return uint8(float32(b) + (float32(a)-float32(b))*TRAILFADE)
+	}
+	return color.RGBA{mix(c.R, bg.R), mix(c.G, bg.G), mix(c.B, bg.B), 0xff}
+}
+
+// VelocityColor maps the direction of v to hue and its speed to brightness.
+// Resting particles are drawn dim rather than black so piles stay visible.
+func VelocityColor(v sim.Velocity) color.RGBA {
+	speed := math.Hypot(float64(v.X), float64(v.Y))
+	h := math.Atan2(float64(v.Y), float64(v.X))/(2*math.Pi) + 0.5
+	val := 0.2 + 0.8*min(speed/float64(sim.MAXVEL), 1.0)
+	return hsv(h, 1.0, val)
+}
+
+// hsv converts a color with components in [0, 1] to RGBA.
+func hsv(h, s, v float64) color.RGBA {
+	i := math.Floor(h * 6)
+	f := h*6 - i
+	p := v * (1 - s)
+	q := v * (1 - f*s)
+	t := v * (1 - (1-f)*s)
+	var r, g, b float64
+	switch int(i) % 6 {
+	case 0:
+		r, g, b = v, t, p
+	case 1:
+		r, g, b = q, v, p
+	case 2:
+		r, g, b = p, v, t
+	case 3:
+		r, g, b = p, q, v
+	case 4:
+		r, g, b = t, p, v
+	default:
+		r, g, b = v, p, q
+	}
+	return color.RGBA{uint8(r * 0xff), uint8(g * 0xff), uint8(b * 0xff), 0xff}
+}
+
+// Shading holds the depth of every set cell, measured as the city block
+// distance to the nearest empty cell and saturating at MAXDEPTH. Cells
+// outside the grid count as set so piles darken against the walls too.
+type Shading struct {
+	depth []uint8
+}
+
+func NewShading() Shading {
+	return Shading{
+		depth: make([]uint8, grid.WIDTH*grid.HEIGHT),
+	}
+}
+
+// Compute runs a two pass distance transform over the cells of g within
+// the tiles t. Depths outside t are assumed to be up to date. Each pass
+// visits the cells in raster order across all of t, so tiles next to each
+// other see each other's new depths.
+func (s *Shading) Compute(g *sim.MaterialGrid, t grid.Tiles) {
+	w := grid.TilesAcross()
+	// Forward pass: nearest empty cell above or to the left.
+	for start := 0; start < len(t); {
+		end := start + 1
+		for end < len(t) && t[end]/w == t[start]/w {
+			end++
+		}
+		row := grid.TileRect(t[start])
+		for y := row.Min.Y; y < row.Max.Y; y++ {
+			for _, i := range t[start:end] {
+				r := grid.TileRect(i)
+				for x := r.Min.X; x < r.Max.X; x++ {
+					s.forward(g, x, y)
+				}
+			}
+		}
+		start = end
+	}
+	// Backward pass: nearest empty cell below or to the right.
+	for end := len(t); end > 0; {
+		start := end - 1
+		for start > 0 && t[start-1]/w == t[end-1]/w {
+			start--
+		}
+		row := grid.TileRect(t[start])
+		for y := row.Max.Y - 1; y >= row.Min.Y; y-- {
+			for j := end - 1; j >= start; j-- {
+				r := grid.TileRect(t[j])
+				for x := r.Max.X - 1; x >= r.Min.X; x-- {
+					s.backward(x, y)
+				}
+			}
+		}
+		end = start
+	}
+}
+
+func (s *Shading) forward(g *sim.MaterialGrid, x, y int) {
+	i := x + grid.WIDTH*y
+	if g.At(x, y) == sim.Empty {
+		s.depth[i] = 0
+		return
+	}
+	d := uint8(MAXDEPTH)
+	if x > 0 {
+		d = min(d, s.depth[i-1]+1)
+	}
+	if y > 0 {
+		d = min(d, s.depth[i-grid.WIDTH]+1)
+	}
+	s.depth[i] = d
+}
+
+func (s *Shading) backward(x, y int) {
+	i := x + grid.WIDTH*y
+	d := s.depth[i]
+	if d == 0 {
+		return
+	}
+	if x < grid.WIDTH-1 {
+		d = min(d, s.depth[i+1]+1)
+	}
+	if y < grid.HEIGHT-1 {
+		d = min(d, s.depth[i+grid.WIDTH]+1)
+	}
+	s.depth[i] = d
+}
+
+// Shade darkens c according to the depth of the cell at (x, y).
+func (s *Shading) Shade(c color.RGBA, x, y int) color.RGBA {
+	d := float32(s.depth[x+grid.WIDTH*y]-1) / (MAXDEPTH - 1)
+	k := 1.0 - d*(1.0-MINSHADE)
+	return color.RGBA{
+		uint8(float32(c.R) * k),
+		uint8(float32(c.G) * k),
+		uint8(float32(c.B) * k),
+		c.A,
+	}
+}
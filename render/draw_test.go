@@ -0,0 +1,43 @@
+package render
+
+import (
+	"image"
+	"testing"
+
+	"github.com/jdavasligil/sandbox/grid"
+	"github.com/jdavasligil/sandbox/sim"
+)
+
+func BenchmarkDrawGrid(b *testing.B) {
+	// Sand resting over the bottom half of the world, as physics leaves it.
+	g := sim.NewMaterialGrid()
+	for y := grid.HEIGHT / 2; y < grid.HEIGHT; y++ {
+		for x := 0; x < grid.WIDTH; x++ {
+			g.Set(x, y, sim.Sand)
+		}
+	}
+	field := sim.NewField()
+	shading := NewShading()
+	opts := DrawOptions{Palette: Themes[0]}
+	img := image.NewRGBA(g.Bounds())
+	b.Run("full", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			shading.Compute(&g, grid.AllTiles(nil))
+			DrawGrid(&g, &shading, &field, opts, img, g.Bounds())
+		}
+	})
+	b.Run("tiles=16", func(b *testing.B) {
+		var dirty grid.Tiles
+		for i := range 16 {
+			dirty = dirty.Union(grid.Tiles{grid.TileOf((i*97)%grid.WIDTH, grid.HEIGHT/2+(i*53)%(grid.HEIGHT/2))}, nil)
+		}
+		var grown grid.Tiles
+		for i := 0; i < b.N; i++ {
+			grown = dirty.Grow(grown)
+			shading.Compute(&g, grown)
+			for _, t := range grown {
+				DrawGrid(&g, &shading, &field, opts, img, grid.TileRect(t))
+			}
+		}
+	})
+}
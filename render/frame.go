@@ -0,0 +1,117 @@
+package render
+
+import (
+	"image"
+	"sync/atomic"
+	"time"
+
+	"github.com/jdavasligil/sandbox/grid"
+	"github.com/jdavasligil/sandbox/sim"
+)
+
+// Frame is a copy of the simulation state for the renderer to draw.
+type Frame struct {
+	Grid  sim.MaterialGrid
+	Field sim.Field
+
+	// Dirty lists the tiles changed since the frame published before it.
+	Dirty grid.Tiles
+
+	// Motion lists the particles moved by the frame's tick, which are
+	// drawn alpha of the way from where they started.
+	Motion []sim.Motion
+	Alpha  float32
+
+	Stats   sim.Stats
+	Status  sim.Status
+	Peers   []sim.Presence // cursors of the other players
+	Taps    []sim.Emitter
+	Portals []sim.Portal // including one opened but not yet linked
+	Goals   []image.Rectangle
+	Panel   []string      // PanelLines, refreshed once a second
+	Took    time.Duration // slowest tick since the frame published before
+}
+
+// Shared passes frames from the simulation to the renderer without locks.
+// The renderer draws the frame last published until the next one arrives,
+// while the simulation fills the other.
+type Shared struct {
+	frames [2]Frame
+	frame  atomic.Pointer[Frame] // the frame last published
+
+	// Ready holds a token while the renderer is idle. The simulation takes
+	// it before filling a frame, so it never touches the one being drawn
+	// and paint events never queue up. The token is the time the renderer
+	// became idle.
+	Ready chan time.Time
+}
+
+// Publisher fills the frames of a Shared in turn.
+type Publisher struct {
+	shared *Shared
+	back   int        // the frame filled next
+	last   grid.Tiles // the cells changed in the frame before it
+	stale  grid.Tiles
+}
+
+// NewPublisher returns a Publisher whose first frame is filled from scratch.
+func NewPublisher(shared *Shared) *Publisher {
+	return &Publisher{shared: shared, back: 1, last: grid.AllTiles(nil)}
+}
+
+// Next returns the frame to fill, brought up to date with grid and field
+// and holding the tiles of grid dirtied since the last. Only call it while
+// holding the ready token of the Shared.
+func (p *Publisher) Next(g *sim.MaterialGrid, field *sim.Field) *Frame {
+	f := &p.shared.frames[p.back]
+	// The renderer is done with the frame, and with its tiles.
+	dirty := g.TakeDirty(f.Dirty)
+	// Bring the frame up to date with the other one too.
+	p.stale = dirty.Union(p.last, p.stale)
+	for _, i := range p.stale {
+		f.Grid.CopyRect(g, grid.TileRect(i))
+		f.Field.CopyRect(field, grid.TileRect(i))
+	}
+	f.Dirty = dirty
+	return f
+}
+
+// NextFrom returns the frame to fill like Next, brought up to date with
+// the state of s. Its alpha, panel and slowest tick are left to the
+// caller, as are the ticks run and dropped in its stats.
+func (p *Publisher) NextFrom(s *sim.Simulation) *Frame {
+	f := p.Next(s.Grid(), s.Field())
+	f.Motion = append(f.Motion[:0], s.Motion()...)
+	f.Stats = s.Stats()
+	f.Status = s.Status()
+	f.Peers = append(f.Peers[:0], s.Peers()...)
+	f.Taps = append(f.Taps[:0], s.Taps()...)
+	f.Portals = s.Portals(f.Portals[:0])
+	f.Goals = s.GoalRects(f.Goals[:0])
+	return f
+}
+
+// Publish hands the frame returned by Next to the renderer.
+func (p *Publisher) Publish(f *Frame) {
+	p.shared.frame.Store(f)
+	p.back, p.last = 1-p.back, f.Dirty
+}
+
+// Published returns the frame last published, for the renderer to draw.
+func (s *Shared) Published() *Frame {
+	return s.frame.Load()
+}
+
+func NewShared() *Shared {
+	s := &Shared{Ready: make(chan time.Time, 1)}
+	for i := range s.frames {
+		s.frames[i] = Frame{
+			Grid:   sim.NewMaterialGrid(),
+			Field:  sim.NewField(),
+			Status: sim.Status{Radius: sim.BRUSHRADIUS, Material: sim.Sand},
+		}
+	}
+	s.frame.Store(&s.frames[0])
+	s.Ready <- time.Time{}
+	return s
+}
@@ -0,0 +1,133 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	GIFRATE   = 15  // frames per second recorded
+	GIFSCALE  = 2   // grid px per GIF px
+	GIFFRAMES = 600 // most frames kept by one recording
+	GIFDIR    = "recordings"
+)
+
+// GIFRecorder samples displayed frames at GIFRATE while recording.
+type GIFRecorder struct {
+	frames []*image.RGBA
+	last   time.Time
+}
+
+func (r *GIFRecorder) Active() bool {
+	return r.frames != nil
+}
+
+func (r *GIFRecorder) Start() {
+	r.frames = make([]*image.RGBA, 0, GIFFRAMES)
+	r.last = time.Time{}
+}
+
+// Capture keeps a downscaled copy of img if a frame is due. It reports false
+// once the recording is full and should be stopped.
+func (r *GIFRecorder) Capture(img *image.RGBA) bool {
+	if len(r.frames) >= GIFFRAMES {
+		return false
+	}
+	if time.Since(r.last) < time.Second/GIFRATE {
+		return true
+	}
+	r.last = time.Now()
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx()/GIFSCALE, b.Dy()/GIFSCALE))
+	for y := 0; y < dst.Rect.Dy(); y++ {
+		for x := 0; x < dst.Rect.Dx(); x++ {
+			dst.SetRGBA(x, y, img.RGBAAt(b.Min.X+x*GIFSCALE, b.Min.Y+y*GIFSCALE))
+		}
+	}
+	r.frames = append(r.frames, dst)
+	return true
+}
+
+// Stop ends the recording and returns its frames.
+func (r *GIFRecorder) Stop() []*image.RGBA {
+	frames := r.frames
+	r.frames = nil
+	return frames
+}
+
+// Quantize picks a palette of at most 256 colors for frames by popularity,
+// counting colors with their channels reduced to 5 bits.
+func Quantize(frames []*image.RGBA) color.Palette {
+	counts := make(map[color.RGBA]int)
+	for _, f := range frames {
+		for i := 0; i < len(f.Pix); i += 4 {
+			c := color.RGBA{f.Pix[i] &^ 7, f.Pix[i+1] &^ 7, f.Pix[i+2] &^ 7, 0xff}
+			counts[c]++
+		}
+	}
+	colors := make([]color.RGBA, 0, len(counts))
+	for c := range counts {
+		colors = append(colors, c)
+	}
+	rgb := func(c color.RGBA) uint32 {
+		return uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B)
+	}
+	// Ties are broken by value so the palette is deterministic.
+	sort.Slice(colors, func(i, j int) bool {
+		if counts[colors[i]] != counts[colors[j]] {
+			return counts[colors[i]] > counts[colors[j]]
+		}
+		return rgb(colors[i]) < rgb(colors[j])
+	})
+	p := make(color.Palette, 0, 256)
+	for _, c := range colors[:min(len(colors), 256)] {
+		// Center the bucket.
+		p = append(p, color.RGBA{c.R | 4, c.G | 4, c.B | 4, 0xff})
+	}
+	return p
+}
+
+// EncodeGIF writes frames as a looping animated GIF sharing one palette.
+func EncodeGIF(w io.Writer, frames []*image.RGBA) error {
+	p := Quantize(frames)
+	index := make(map[color.RGBA]uint8)
+	anim := gif.GIF{}
+	for _, f := range frames {
+		dst := image.NewPaletted(f.Bounds(), p)
+		for i, j := 0, 0; i < len(f.Pix); i, j = i+4, j+1 {
+			c := color.RGBA{f.Pix[i], f.Pix[i+1], f.Pix[i+2], 0xff}
+			k, ok := index[c]
+			if !ok {
+				k = uint8(p.Index(c))
+				index[c] = k
+			}
+			dst.Pix[j] = k
+		}
+		anim.Image = append(anim.Image, dst)
+		anim.Delay = append(anim.Delay, 100/GIFRATE)
+	}
+	return gif.EncodeAll(w, &anim)
+}
+
+// SaveGIF encodes frames to a timestamped GIF in dir and returns its path.
+func SaveGIF(dir string, frames []*image.RGBA) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, time.Now().Format("sandbox-20060102-150405.gif"))
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err := EncodeGIF(f, frames); err != nil {
+		f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
@@ -0,0 +1,120 @@
+package render
+
+import (
+	"flag"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jdavasligil/sandbox/sim"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden images in testdata/golden")
+
+// GOLDENTICKS is how long each golden scene runs before it is drawn, long
+// enough for its sand and water to settle.
+const GOLDENTICKS = 600
+
+// smallWorld configures a 200x150 world for the rest of the test.
+func smallWorld(t *testing.T) {
+	cfg := sim.DefaultConfig()
+	cfg.Width, cfg.Height = 200, 150
+	sim.Configure(cfg)
+	t.Cleanup(func() { sim.Configure(sim.DefaultConfig()) })
+}
+
+// TestGolden runs each scene in testdata/golden on a small world and
+// compares its drawing with the PNG of the same name. Run
+//
+//	go test -run TestGolden -update
+//
+// to accept a change that moves particles on purpose.
+func TestGolden(t *testing.T) {
+	scenes, err := filepath.Glob("testdata/golden/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scenes) == 0 {
+		t.Fatal("no golden scenes")
+	}
+	stamps, err := sim.LoadStamps("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	smallWorld(t)
+
+	for _, path := range scenes {
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		t.Run(name, func(t *testing.T) {
+			sc, err := sim.LoadScene(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := sim.NewSimulation(stamps)
+			if err := s.ApplyScene(sc); err != nil {
+				t.Fatal(err)
+			}
+			for range GOLDENTICKS {
+				s.Step()
+			}
+			got := DrawWorld(s, DrawOptions{Palette: Themes[0]})
+
+			golden := strings.TrimSuffix(path, ".json") + ".png"
+			if *update {
+				if err := writePNG(golden, got); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := readPNG(golden)
+			if err != nil {
+				t.Fatalf("%v; run with -update to create it", err)
+			}
+			if want.Bounds() != got.Bounds() {
+				t.Fatalf("drew %v, golden is %v", got.Bounds(), want.Bounds())
+			}
+			diff, first := 0, image.Point{}
+			for y := got.Rect.Min.Y; y < got.Rect.Max.Y; y++ {
+				for x := got.Rect.Min.X; x < got.Rect.Max.X; x++ {
+					r0, g0, b0, a0 := want.At(x, y).RGBA()
+					r1, g1, b1, a1 := got.At(x, y).RGBA()
+					if r0 != r1 || g0 != g1 || b0 != b1 || a0 != a1 {
+						if diff == 0 {
+							first = image.Point{x, y}
+						}
+						diff++
+					}
+				}
+			}
+			if diff > 0 {
+				out := filepath.Join(t.TempDir(), name+".png")
+				writePNG(out, got)
+				t.Errorf("%d pixels differ from %s, first at %v; see %s", diff, golden, first, out)
+			}
+		})
+	}
+}
+
+func readPNG(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return png.Decode(f)
+}
+
+func writePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
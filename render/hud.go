@@ -0,0 +1,263 @@
+package render
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+
+	"github.com/jdavasligil/sandbox/sim"
+)
+
+const HUDPAD = 4 // px between the HUD text and its box
+
+// UISCALE is how many times larger than its font the HUD and toolbar are
+// drawn, from 1 to 3. Set from the uiscale of sandbox.toml. Frontends pass
+// it, or a multiple of it on screens with more pixels, as the scale of the
+// HUD, panel, graph and banner.
+var UISCALE = 1
+
+// METERWIDTH is how many characters the particle meter of the HUD spans.
+const METERWIDTH = 20
+
+// DrawHUD draws one line per string in the top left corner of img, scale
+// times larger than its font, and returns the region it covered.
+func DrawHUD(img *image.RGBA, lines []string, p Palette, scale int) image.Rectangle {
+	return drawLines(img, lines, p, scale, false)
+}
+
+// DrawPanel draws one line per string in the bottom left corner of img,
+// scale times larger than its font, and returns the region it covered.
+func DrawPanel(img *image.RGBA, lines []string, p Palette, scale int) image.Rectangle {
+	return drawLines(img, lines, p, scale, true)
+}
+
+func drawLines(img *image.RGBA, lines []string, p Palette, scale int, bottom bool) image.Rectangle {
+	face := basicfont.Face7x13
+	width := 0
+	for _, line := range lines {
+		width = max(width, font.MeasureString(face, line).Ceil())
+	}
+	size := image.Point{width + 2*HUDPAD, len(lines)*face.Height + 2*HUDPAD}
+	var at image.Point
+	if bottom {
+		at.Y = img.Bounds().Dy() - size.Y*scale
+	}
+	layer, done := uiLayer(img, at, size, scale)
+	box := layer.Bounds()
+	draw.Draw(layer, box, image.NewUniform(p.Accent), image.Point{}, draw.Src)
+
+	d := font.Drawer{
+		Dst:  layer,
+		Src:  image.NewUniform(p.Particle),
+		Face: face,
+	}
+	for i, line := range lines {
+		d.Dot = fixed.P(box.Min.X+HUDPAD, box.Min.Y+HUDPAD+i*face.Height+face.Ascent)
+		d.DrawString(line)
+	}
+	return done()
+}
+
+// uiLayer returns an image to draw a UI element of size into at 1x, its
+// corner at min, and a func that copies it into img scale times larger and
+// returns the region it covered there. At 1x it is img itself.
+func uiLayer(img *image.RGBA, min, size image.Point, scale int) (*image.RGBA, func() image.Rectangle) {
+	box := image.Rectangle{min, min.Add(size)}
+	if scale == 1 {
+		return img.SubImage(box).(*image.RGBA), func() image.Rectangle { return box.Intersect(img.Bounds()) }
+	}
+	layer := image.NewRGBA(box)
+	return layer, func() image.Rectangle {
+		r := image.Rectangle{min, min.Add(size.Mul(scale))}.Intersect(img.Bounds())
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				img.SetRGBA(x, y, layer.RGBAAt(min.X+(x-min.X)/scale, min.Y+(y-min.Y)/scale))
+			}
+		}
+		return r
+	}
+}
+
+// PanelLines formats the particles of each material, the memory the world
+// takes in all, the cells at rest and the time each system took for
+// DrawPanel.
+func PanelLines(ms []sim.MaterialStat, total uintptr, resting int, timings []sim.SystemTiming) []string {
+	lines := []string{fmt.Sprintf("%-12s %8s %9s", "MATERIAL", "COUNT", "MEMORY")}
+	count := 0
+	for _, m := range ms {
+		lines = append(lines, fmt.Sprintf("%-12s %8d %6d KiB", m.Material, m.Count, m.Bytes>>10))
+		count += m.Count
+	}
+	lines = append(lines,
+		fmt.Sprintf("%-12s %8d %6d KiB", "total", count, total>>10),
+		fmt.Sprintf("%-12s %8d cells", "resting", resting),
+		fmt.Sprintf("%-12s %12s", "SYSTEM", "EACH SECOND"),
+	)
+	for _, t := range timings {
+		lines = append(lines, fmt.Sprintf("%-12s %9.3f ms", t.Name, t.Took.Seconds()*1000))
+	}
+	return lines
+}
+
+// HUDCache keeps the lines last formatted by HUDLines, so that frames
+// showing the same stats reuse them.
+type HUDCache struct {
+	fps    int
+	stats  sim.Stats
+	status sim.Status
+	lines  []string
+}
+
+// Lines returns HUDLines(fps, s, st), formatting it only if it changed.
+func (c *HUDCache) Lines(fps int, s sim.Stats, st sim.Status) []string {
+	if c.lines == nil || fps != c.fps || s != c.stats || st != c.status {
+		c.fps, c.stats, c.status = fps, s, st
+		c.lines = HUDLines(fps, s, st)
+	}
+	return c.lines
+}
+
+// HUDLines formats the frame rate and simulation stats for DrawHUD.
+func HUDLines(fps int, s sim.Stats, st sim.Status) []string {
+	lines := []string{
+		fmt.Sprintf("FPS  %d", fps),
+		fmt.Sprintf("TPS  %d/%d (%gx)", s.TPS, s.Target, st.Speed),
+		fmt.Sprintf("SAND %d (%d falling, %d settled)", s.Particles, s.Falling, s.Particles-s.Falling),
+	}
+	if s.Budget > 0 {
+		full := min(s.Particles*METERWIDTH/s.Budget, METERWIDTH)
+		lines = append(lines, fmt.Sprintf("CAP  [%s%s] %d%% of %d",
+			strings.Repeat("#", full), strings.Repeat(".", METERWIDTH-full), min(s.Particles*100/s.Budget, 100), s.Budget))
+	}
+	lines = append(lines, fmt.Sprintf("%s %s r=%d", st.Material, st.Tool, st.Radius))
+	if s.Dropped > 0 {
+		lines = append(lines, fmt.Sprintf("SLOW %d ticks dropped", s.Dropped))
+	}
+	if st.Symmetry != sim.SymmetryOff {
+		lines = append(lines, "SYMMETRY "+st.Symmetry.String())
+	}
+	if st.Stamp != "" {
+		lines = append(lines, "STAMP "+st.Stamp)
+	}
+	if st.Goal != "" {
+		lines = append(lines, st.Goal)
+	}
+	if st.Paused {
+		lines = append(lines, "PAUSED")
+	}
+	return lines
+}
+
+// Banner returns the text announcing outcome o, or "" if there is none.
+func Banner(o sim.Outcome) string {
+	switch o {
+	case sim.OutcomeWon:
+		return "CHALLENGE COMPLETE"
+	case sim.OutcomeLost:
+		return "CHALLENGE FAILED"
+	}
+	return ""
+}
+
+// DrawBanner draws text in a box across the middle of img, scale times
+// larger than its font, and returns the region it covered.
+func DrawBanner(img *image.RGBA, text string, p Palette, scale int) image.Rectangle {
+	face := basicfont.Face7x13
+	size := image.Point{font.MeasureString(face, text).Ceil() + 4*HUDPAD, face.Height + 4*HUDPAD}
+	c := img.Bounds().Size().Div(2)
+	layer, done := uiLayer(img, c.Sub(size.Mul(scale).Div(2)), size, scale)
+	r := layer.Bounds()
+	draw.Draw(layer, r, image.NewUniform(p.Accent), image.Point{}, draw.Src)
+	d := font.Drawer{
+		Dst:  layer,
+		Src:  image.NewUniform(p.Particle),
+		Face: face,
+		Dot:  fixed.P(r.Min.X+2*HUDPAD, r.Min.Y+2*HUDPAD+face.Ascent),
+	}
+	d.DrawString(text)
+	return done()
+}
+
+// DrawCircle outlines a circle of radius r centered on (cx, cy) and returns
+// the region it covered.
+func DrawCircle(img *image.RGBA, cx, cy, r int, c color.RGBA) image.Rectangle {
+	plot := func(x, y int) {
+		if (image.Point{x, y}).In(img.Bounds()) {
+			img.SetRGBA(x, y, c)
+		}
+	}
+	// Midpoint circle algorithm, plotting all eight octants at once.
+	x, y := r, 0
+	err := 1 - r
+	for x >= y {
+		plot(cx+x, cy+y)
+		plot(cx+y, cy+x)
+		plot(cx-y, cy+x)
+		plot(cx-x, cy+y)
+		plot(cx-x, cy-y)
+		plot(cx-y, cy-x)
+		plot(cx+y, cy-x)
+		plot(cx+x, cy-y)
+		y++
+		if err < 0 {
+			err += 2*y + 1
+		} else {
+			x--
+			err += 2*(y-x) + 1
+		}
+	}
+	return image.Rect(cx-r, cy-r, cx+r+1, cy+r+1).Intersect(img.Bounds())
+}
+
+// DrawEmitter outlines a square around the nozzle of em and returns the
+// region it covered.
+func DrawEmitter(img *image.RGBA, em sim.Emitter, c color.RGBA) image.Rectangle {
+	d := image.Point{em.R + 1, em.R + 1}
+	p := image.Point{em.X, em.Y}
+	return DrawStroke(img, sim.ToolRect, p.Sub(d), p.Add(d), c)
+}
+
+// DrawPortal outlines both ends of pt, the second inside a smaller ring so
+// the pair reads as linked, and returns the region it covered.
+func DrawPortal(img *image.RGBA, pt sim.Portal, c color.RGBA) image.Rectangle {
+	r := DrawCircle(img, pt.A.X, pt.A.Y, pt.R, c)
+	r = r.Union(DrawCircle(img, pt.B.X, pt.B.Y, pt.R, c))
+	return r.Union(DrawCircle(img, pt.B.X, pt.B.Y, max(pt.R-2, 1), c))
+}
+
+// DrawStroke outlines the shape a drag from a to b would fill and returns
+// the region it covered.
+func DrawStroke(img *image.RGBA, t sim.Tool, a, b image.Point, c color.RGBA) image.Rectangle {
+	plot := func(x, y int) {
+		if (image.Point{x, y}).In(img.Bounds()) {
+			img.SetRGBA(x, y, c)
+		}
+	}
+	r := sim.Span(a, b)
+	switch t {
+	case sim.ToolLine:
+		sim.Line(a.X, a.Y, b.X, b.Y, plot)
+	case sim.ToolRect, sim.ToolSelect:
+		outline(img, r.Intersect(img.Bounds()), c)
+	case sim.ToolEllipse:
+		rx := float64(r.Dx()) / 2
+		ry := float64(r.Dy()) / 2
+		cx := float64(r.Min.X) + rx
+		cy := float64(r.Min.Y) + ry
+		steps := int(4 * (rx + ry))
+		for i := 0; i <= steps; i++ {
+			t := 2 * math.Pi * float64(i) / float64(steps)
+			plot(int(cx+(rx-0.5)*math.Cos(t)), int(cy+(ry-0.5)*math.Sin(t)))
+		}
+	default:
+		return image.Rectangle{}
+	}
+	return r.Intersect(img.Bounds())
+}
@@ -0,0 +1,222 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"os"
+
+	"github.com/jdavasligil/sandbox/sim"
+)
+
+// Palette names the colors used to draw the sandbox.
+type Palette struct {
+	Name       string
+	Background color.RGBA
+	Particle   color.RGBA // sand and HUD text
+	Water      color.RGBA
+	Wall       color.RGBA
+	Accent     color.RGBA
+	Cursor     color.RGBA
+
+	// Materials are the colors of other materials by name, drawn instead
+	// of their own.
+	Materials map[string]color.RGBA
+}
+
+// Color returns the color a cell of material m is drawn in.
+func (p Palette) Color(m sim.Material) color.RGBA {
+	switch m {
+	case sim.Sand:
+		return p.Particle
+	case sim.Water:
+		return p.Water
+	case sim.Wall:
+		return p.Wall
+	case sim.Empty:
+		return p.Background
+	}
+	if c, ok := p.Materials[sim.Elements[m].Name]; ok {
+		return c
+	}
+	return sim.Elements[m].Color
+}
+
+// Themes lists the built-in palettes in the order P cycles through them.
+var Themes = []Palette{
+	{
+		Name:       "classic",
+		Background: color.RGBA{0x05, 0x05, 0x05, 0xff},
+		Particle:   color.RGBA{0xee, 0xee, 0xee, 0xff},
+		Water:      color.RGBA{0x20, 0x60, 0xe0, 0xff},
+		Wall:       color.RGBA{0x70, 0x70, 0x78, 0xff},
+		Accent:     color.RGBA{0x00, 0x00, 0x1f, 0xff},
+		Cursor:     color.RGBA{0x40, 0x80, 0xff, 0xff},
+	},
+	{
+		Name:       "amber",
+		Background: color.RGBA{0x12, 0x08, 0x00, 0xff},
+		Particle:   color.RGBA{0xff, 0xb0, 0x00, 0xff},
+		Water:      color.RGBA{0xff, 0x70, 0x00, 0xff},
+		Wall:       color.RGBA{0x80, 0x48, 0x00, 0xff},
+		Accent:     color.RGBA{0x66, 0x33, 0x00, 0xff},
+		Cursor:     color.RGBA{0xff, 0xe0, 0x80, 0xff},
+	},
+	{
+		Name:       "pastel",
+		Background: color.RGBA{0xf4, 0xee, 0xf8, 0xff},
+		Particle:   color.RGBA{0xe8, 0xa8, 0xc0, 0xff},
+		Water:      color.RGBA{0xa8, 0xd0, 0xf0, 0xff},
+		Wall:       color.RGBA{0xb8, 0xb0, 0xc8, 0xff},
+		Accent:     color.RGBA{0x9c, 0xc8, 0xe8, 0xff},
+		Cursor:     color.RGBA{0x60, 0x60, 0x90, 0xff},
+	},
+
+	// Palettes for color vision deficiencies, with a color for every
+	// built-in material. Each keeps all of them and the background apart as
+	// seen with the deficiency it is named for: the red-green ones lean on
+	// blue, yellow and lightness, and tritanopia on red and teal.
+	{
+		Name:       "deuteranopia",
+		Background: color.RGBA{0x05, 0x05, 0x05, 0xff},
+		Particle:   color.RGBA{0xf2, 0xf4, 0x4e, 0xff},
+		Water:      color.RGBA{0x0f, 0x78, 0xc6, 0xff},
+		Wall:       color.RGBA{0x94, 0x7e, 0x83, 0xff},
+		Accent:     color.RGBA{0x00, 0x1a, 0x33, 0xff},
+		Cursor:     color.RGBA{0x56, 0xb4, 0xe9, 0xff},
+		Materials: map[string]color.RGBA{
+			"drain":          {0x53, 0x23, 0x3d, 0xff},
+			"platform":       {0xe3, 0x8e, 0x03, 0xff},
+			"fan-up":         {0x5a, 0xb2, 0xff, 0xff},
+			"fan-down":       {0x17, 0x4e, 0x7d, 0xff},
+			"fan-left":       {0x27, 0xe1, 0xfd, 0xff},
+			"fan-right":      {0x43, 0x94, 0xbb, 0xff},
+			"conveyor-left":  {0xb8, 0x50, 0x05, 0xff},
+			"conveyor-right": {0x8b, 0x11, 0x10, 0xff},
+			"sensor":         {0xf9, 0x79, 0x8e, 0xff},
+			"door":           {0x58, 0x2a, 0x1f, 0xff},
+			"wire":           {0xb5, 0x9b, 0x55, 0xff},
+			"live-wire":      {0xc2, 0xc0, 0xcd, 0xff},
+			"and-gate":       {0x43, 0x84, 0x49, 0xff},
+			"or-gate":        {0x0a, 0x1f, 0x6b, 0xff},
+			"not-gate":       {0xed, 0xf3, 0xca, 0xff},
+			"stone":          {0x1d, 0x6f, 0x79, 0xff},
+		},
+	},
+	{
+		Name:       "protanopia",
+		Background: color.RGBA{0x05, 0x05, 0x05, 0xff},
+		Particle:   color.RGBA{0xe8, 0xee, 0x7e, 0xff},
+		Water:      color.RGBA{0x3c, 0x6d, 0xea, 0xff},
+		Wall:       color.RGBA{0x6f, 0x6a, 0x5e, 0xff},
+		Accent:     color.RGBA{0x00, 0x1a, 0x33, 0xff},
+		Cursor:     color.RGBA{0x7c, 0xc4, 0xff, 0xff},
+		Materials: map[string]color.RGBA{
+			"drain":          {0x31, 0x18, 0x38, 0xff},
+			"platform":       {0xf3, 0xa6, 0x2f, 0xff},
+			"fan-up":         {0x7a, 0xde, 0xea, 0xff},
+			"fan-down":       {0x3b, 0x67, 0xaf, 0xff},
+			"fan-left":       {0x9f, 0xc2, 0xfd, 0xff},
+			"fan-right":      {0x18, 0x94, 0xb9, 0xff},
+			"conveyor-left":  {0xa0, 0x72, 0x3b, 0xff},
+			"conveyor-right": {0xcd, 0xa3, 0x51, 0xff},
+			"sensor":         {0xad, 0x92, 0xfc, 0xff},
+			"door":           {0x65, 0x1e, 0x91, 0xff},
+			"wire":           {0x55, 0x32, 0x03, 0xff},
+			"live-wire":      {0xbd, 0xf1, 0xd5, 0xff},
+			"and-gate":       {0x44, 0xa7, 0x7b, 0xff},
+			"or-gate":        {0x1b, 0x0e, 0x53, 0xff},
+			"not-gate":       {0xa9, 0x98, 0x9f, 0xff},
+			"stone":          {0x45, 0x5d, 0x76, 0xff},
+		},
+	},
+	{
+		Name:       "tritanopia",
+		Background: color.RGBA{0x05, 0x05, 0x05, 0xff},
+		Particle:   color.RGBA{0xe6, 0xfe, 0xee, 0xff},
+		Water:      color.RGBA{0x2c, 0x83, 0x87, 0xff},
+		Wall:       color.RGBA{0x62, 0x6f, 0x78, 0xff},
+		Accent:     color.RGBA{0x33, 0x00, 0x10, 0xff},
+		Cursor:     color.RGBA{0xff, 0x5a, 0x78, 0xff},
+		Materials: map[string]color.RGBA{
+			"drain":          {0x31, 0x03, 0x06, 0xff},
+			"platform":       {0xf8, 0x6e, 0x73, 0xff},
+			"fan-up":         {0xad, 0xfe, 0xc9, 0xff},
+			"fan-down":       {0x1f, 0xf9, 0xdf, 0xff},
+			"fan-left":       {0x1e, 0xbc, 0xa6, 0xff},
+			"fan-right":      {0x88, 0xaf, 0xac, 0xff},
+			"conveyor-left":  {0xfc, 0xb0, 0xd3, 0xff},
+			"conveyor-right": {0xc9, 0x71, 0xa7, 0xff},
+			"sensor":         {0xd5, 0x22, 0x26, 0xff},
+			"door":           {0xb1, 0x13, 0x52, 0xff},
+			"wire":           {0x75, 0x47, 0x1a, 0xff},
+			"live-wire":      {0xfd, 0xe1, 0xed, 0xff},
+			"and-gate":       {0x0a, 0x3f, 0x47, 0xff},
+			"or-gate":        {0xac, 0x22, 0x94, 0xff},
+			"not-gate":       {0xaf, 0xb3, 0x7e, 0xff},
+			"stone":          {0x8d, 0x75, 0x5c, 0xff},
+		},
+	},
+}
+
+// paletteFile is the on-disk form of a Palette with colors written as hex
+// strings such as "#eeeeee".
+type paletteFile struct {
+	Name       string `json:"name"`
+	Background string `json:"background"`
+	Particle   string `json:"particle"`
+	Water      string `json:"water"`
+	Wall       string `json:"wall"`
+	Accent     string `json:"accent"`
+	Cursor     string `json:"cursor"`
+
+	Materials map[string]string `json:"materials"`
+}
+
+// LoadPalette returns the built-in theme called name, or else reads a palette
+// from the JSON file at that path.
+func LoadPalette(name string) (Palette, error) {
+	for _, p := range Themes {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return Palette{}, err
+	}
+	var pf paletteFile
+	if err := json.Unmarshal(data, &pf); err != nil {
+		return Palette{}, fmt.Errorf("palette %s: %w", name, err)
+	}
+	p := Palette{Name: pf.Name}
+	if p.Name == "" {
+		p.Name = name
+	}
+	for _, c := range []struct {
+		dst *color.RGBA
+		hex string
+	}{
+		{&p.Background, pf.Background},
+		{&p.Particle, pf.Particle},
+		{&p.Water, pf.Water},
+		{&p.Wall, pf.Wall},
+		{&p.Accent, pf.Accent},
+		{&p.Cursor, pf.Cursor},
+	} {
+		if *c.dst, err = sim.ParseHex(c.hex); err != nil {
+			return Palette{}, fmt.Errorf("palette %s: %w", name, err)
+		}
+	}
+	for m, hex := range pf.Materials {
+		c, err := sim.ParseHex(hex)
+		if err != nil {
+			return Palette{}, fmt.Errorf("palette %s: %s: %w", name, m, err)
+		}
+		if p.Materials == nil {
+			p.Materials = make(map[string]color.RGBA)
+		}
+		p.Materials[m] = c
+	}
+	return p, nil
+}
@@ -0,0 +1,90 @@
+package render
+
+import (
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/jdavasligil/sandbox/sim"
+)
+
+// CVDTHEMES maps the colorblind themes to the matrices simulating their
+// deficiency on linear RGB, from Machado, Oliveira and Fernandes (2009) at
+// full severity.
+var CVDTHEMES = map[string][3][3]float64{
+	"protanopia": {
+		{0.152286, 1.052583, -0.204868},
+		{0.114503, 0.786281, 0.099216},
+		{-0.003882, -0.048116, 1.051998},
+	},
+	"deuteranopia": {
+		{0.367322, 0.860646, -0.227968},
+		{0.280085, 0.672501, 0.047413},
+		{-0.011820, 0.042940, 0.968881},
+	},
+	"tritanopia": {
+		{1.255528, -0.076749, -0.178779},
+		{-0.078411, 0.930809, 0.147602},
+		{0.004733, 0.691367, 0.303900},
+	},
+}
+
+// MINCONTRAST is the least CIE76 difference between any two colors of a
+// colorblind theme as its deficiency sees them.
+const MINCONTRAST = 20
+
+func TestColorblindThemes(t *testing.T) {
+	for name, cvd := range CVDTHEMES {
+		p, err := LoadPalette(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ms := []sim.Material{sim.Empty}
+		for m := range sim.Elements[1:] {
+			m := sim.Material(m + 1)
+			if _, ok := p.Materials[m.String()]; !ok && m != sim.Sand && m != sim.Water && m != sim.Wall {
+				t.Errorf("%s: no color for %s", name, m)
+			}
+			ms = append(ms, m)
+		}
+		for i, a := range ms {
+			for _, b := range ms[:i] {
+				if d := seenApart(cvd, p.Color(a), p.Color(b)); d < MINCONTRAST {
+					t.Errorf("%s: %s and %s are %.1f apart", name, a, b, d)
+				}
+			}
+		}
+	}
+}
+
+// seenApart returns the CIE76 difference between a and b as seen through
+// the simulation matrix sim.
+func seenApart(cvd [3][3]float64, a, b color.RGBA) float64 {
+	la, lb := seenLab(cvd, a), seenLab(cvd, b)
+	return math.Sqrt((la[0]-lb[0])*(la[0]-lb[0]) + (la[1]-lb[1])*(la[1]-lb[1]) + (la[2]-lb[2])*(la[2]-lb[2]))
+}
+
+func seenLab(cvd [3][3]float64, c color.RGBA) [3]float64 {
+	linear := func(v uint8) float64 {
+		f := float64(v) / 255
+		if f <= 0.04045 {
+			return f / 12.92
+		}
+		return math.Pow((f+0.055)/1.055, 2.4)
+	}
+	in := [3]float64{linear(c.R), linear(c.G), linear(c.B)}
+	var rgb [3]float64
+	for i, row := range cvd {
+		rgb[i] = max(0, min(1, row[0]*in[0]+row[1]*in[1]+row[2]*in[2]))
+	}
+	x := (0.4124*rgb[0] + 0.3576*rgb[1] + 0.1805*rgb[2]) / 0.95047
+	y := 0.2126*rgb[0] + 0.7152*rgb[1] + 0.0722*rgb[2]
+	z := (0.0193*rgb[0] + 0.1192*rgb[1] + 0.9505*rgb[2]) / 1.08883
+	f := func(t float64) float64 {
+		if t > 0.008856 {
+			return math.Cbrt(t)
+		}
+		return 7.787*t + 16.0/116
+	}
+	return [3]float64{116*f(y) - 16, 500 * (f(x) - f(y)), 200 * (f(y) - f(z))}
+}
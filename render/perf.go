@@ -0,0 +1,116 @@
+package render
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"runtime/debug"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	PERFSAMPLES = 120                   // frames the performance graph spans, one a column
+	PERFHEIGHT  = 48                    // px
+	PERFSPAN    = 32 * time.Millisecond // time the full height of the graph stands for
+)
+
+// PerfGraph keeps the timings of the latest frames for the performance
+// overlay: the slowest tick simulated since the frame before, the time the
+// frame took to draw, and the garbage collection pauses in between.
+type PerfGraph struct {
+	tick, draw, gc [PERFSAMPLES]time.Duration
+	next           int // where the next sample goes, wrapping around
+
+	stats   debug.GCStats
+	started bool
+}
+
+// Add records the timings of a frame, along with the pauses of the
+// collections since the last.
+func (g *PerfGraph) Add(tick, draw time.Duration) {
+	seen := g.stats.NumGC
+	debug.ReadGCStats(&g.stats)
+	var pause time.Duration
+	if g.started {
+		for _, p := range g.stats.Pause[:min(int(g.stats.NumGC-seen), len(g.stats.Pause))] {
+			pause += p
+		}
+	}
+	g.started = true
+	g.tick[g.next], g.draw[g.next], g.gc[g.next] = tick, draw, pause
+	g.next = (g.next + 1) % PERFSAMPLES
+}
+
+// perfSeries is one timing of a PerfGraph.
+type perfSeries struct {
+	name  string
+	took  *[PERFSAMPLES]time.Duration
+	color color.RGBA
+}
+
+// series returns the timings of g in the order they are drawn, with their
+// colors from p.
+func (g *PerfGraph) series(p Palette) []perfSeries {
+	return []perfSeries{{"GC", &g.gc, p.Cursor}, {"TICK", &g.tick, p.Water}, {"DRAW", &g.draw, p.Particle}}
+}
+
+// DrawPerf draws g as a graph scrolling left in the bottom right corner of
+// img, under a legend, and returns the region it covered. Each timing is a
+// line of its color, and GC pauses are bars up from the bottom. It is drawn
+// scale times larger than its font.
+func DrawPerf(img *image.RGBA, g *PerfGraph, p Palette, scale int) image.Rectangle {
+	face := basicfont.Face7x13
+	size := image.Point{PERFSAMPLES + 2*HUDPAD, face.Height + PERFHEIGHT + 3*HUDPAD}
+	layer, done := uiLayer(img, img.Bounds().Max.Sub(size.Mul(scale)), size, scale)
+	box := layer.Bounds()
+	draw.Draw(layer, box, image.NewUniform(p.Accent), image.Point{}, draw.Src)
+
+	d := font.Drawer{Dst: layer, Face: face, Dot: fixed.P(box.Min.X+HUDPAD, box.Min.Y+HUDPAD+face.Ascent)}
+	base := box.Max.Y - HUDPAD - 1
+	plot := func(x, y int, c color.RGBA) {
+		if (image.Point{x, y}).In(layer.Bounds()) {
+			layer.SetRGBA(x, y, c)
+		}
+	}
+	for k, s := range g.series(p) {
+		d.Src = image.NewUniform(s.color)
+		d.DrawString(s.name + " ")
+		for i := range PERFSAMPLES {
+			took := s.took[(g.next+i)%PERFSAMPLES]
+			h := int(min(took, PERFSPAN) * PERFHEIGHT / PERFSPAN)
+			x := box.Min.X + HUDPAD + i
+			if k == 0 {
+				for y := base; y > base-h; y-- {
+					plot(x, y, s.color)
+				}
+			} else {
+				plot(x, base-h, s.color)
+			}
+		}
+	}
+	return done()
+}
+
+// SPARKS are the blocks a sparkline is drawn with, lowest first.
+var SPARKS = []rune("▁▂▃▄▅▆▇█")
+
+// Sparklines returns a line per timing of g for the terminal, naming it and
+// charting its last width samples in blocks.
+func (g *PerfGraph) Sparklines(width int) []string {
+	width = min(width, PERFSAMPLES)
+	var lines []string
+	for _, s := range g.series(Palette{}) {
+		line := []rune(fmt.Sprintf("%-5s", s.name))
+		for i := PERFSAMPLES - width; i < PERFSAMPLES; i++ {
+			took := min(s.took[(g.next+i)%PERFSAMPLES], PERFSPAN)
+			line = append(line, SPARKS[int(took)*(len(SPARKS)-1)/int(PERFSPAN)])
+		}
+		lines = append(lines, string(line))
+	}
+	return lines
+}
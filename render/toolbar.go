@@ -0,0 +1,99 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/jdavasligil/sandbox/grid"
+	"github.com/jdavasligil/sandbox/sim"
+)
+
+const (
+	SWATCHSIZE = 24 // px at a UISCALE of 1
+	SWATCHPAD  = 4  // px between swatches at a UISCALE of 1
+)
+
+// Swatch returns the toolbar button for the ith entry of Materials. Buttons
+// run down the right edge of the grid, in as many columns leftwards as it
+// takes to keep them above its bottom edge.
+func Swatch(i int) image.Rectangle {
+	size, pad, rows := swatchLayout()
+	x := grid.WIDTH - (i/rows+1)*(size+pad)
+	y := pad + i%rows*(size+pad)
+	return image.Rect(x, y, x+size, y+size)
+}
+
+// swatchLayout returns the size of a swatch, the gap around it and how many
+// swatches a column holds. Swatches are SWATCHSIZE times UISCALE across
+// unless the grid cannot hold them all at that size, when they shrink until
+// it can.
+func swatchLayout() (size, pad, rows int) {
+	for size = SWATCHSIZE * UISCALE; ; size-- {
+		pad = max(size*SWATCHPAD/SWATCHSIZE, 1)
+		rows = (grid.HEIGHT - pad) / (size + pad)
+		if rows > 0 && (len(sim.Materials)+rows-1)/rows*(size+pad)+pad <= grid.WIDTH || size == 1 {
+			return size, pad, max(rows, 1)
+		}
+	}
+}
+
+// ToolbarBounds returns the region covered by the toolbar.
+func ToolbarBounds() image.Rectangle {
+	_, pad, _ := swatchLayout()
+	var r image.Rectangle
+	for i := range sim.Materials {
+		r = r.Union(Swatch(i))
+	}
+	return r.Inset(-pad)
+}
+
+// ToolbarHit returns the material whose swatch contains p.
+func ToolbarHit(p image.Point) (sim.Material, bool) {
+	for i, m := range sim.Materials {
+		if p.In(Swatch(i)) {
+			return m, true
+		}
+	}
+	return sim.Empty, false
+}
+
+// DrawToolbar draws a swatch per material, outlining the active one, and
+// returns the region it covered.
+func DrawToolbar(img *image.RGBA, active sim.Material, p Palette) image.Rectangle {
+	size, _, _ := swatchLayout()
+	line := max(size/SWATCHSIZE, 1) // px, UISCALE unless the swatches shrank
+	r := ToolbarBounds()
+	draw.Draw(img, r, image.NewUniform(p.Accent), image.Point{}, draw.Src)
+	for i, m := range sim.Materials {
+		s := Swatch(i)
+		if m == active {
+			for w := range line {
+				outline(img, s.Inset(-2*line+w), p.Cursor)
+			}
+		}
+		draw.Draw(img, s, image.NewUniform(p.Color(m)), image.Point{}, draw.Src)
+		if m == sim.Empty {
+			// Cross out the eraser so it reads against the background.
+			for d := 0; d < s.Dx(); d++ {
+				for w := range line {
+					img.SetRGBA(s.Min.X+d, s.Min.Y+min(d+w, s.Dy()-1), p.Particle)
+					img.SetRGBA(s.Max.X-1-d, s.Min.Y+min(d+w, s.Dy()-1), p.Particle)
+				}
+			}
+		}
+	}
+	return r
+}
+
+// outline draws a one pixel border just inside r.
+func outline(img *image.RGBA, r image.Rectangle, c color.RGBA) {
+	for x := r.Min.X; x < r.Max.X; x++ {
+		img.SetRGBA(x, r.Min.Y, c)
+		img.SetRGBA(x, r.Max.Y-1, c)
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		img.SetRGBA(r.Min.X, y, c)
+		img.SetRGBA(r.Max.X-1, y, c)
+	}
+}
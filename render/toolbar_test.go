@@ -0,0 +1,44 @@
+package render
+
+import (
+	"image"
+	"testing"
+
+	"github.com/jdavasligil/sandbox/grid"
+	"github.com/jdavasligil/sandbox/sim"
+)
+
+// TestToolbarFits lays out the toolbar on short and default grids at each
+// UISCALE and checks every swatch is on the grid, apart from the others and
+// found by ToolbarHit.
+func TestToolbarFits(t *testing.T) {
+	t.Cleanup(func() {
+		sim.Configure(sim.DefaultConfig())
+		UISCALE = 1
+	})
+	for _, size := range []image.Point{{800, 800}, {200, 150}, {640, 60}} {
+		cfg := sim.DefaultConfig()
+		cfg.Width, cfg.Height = size.X, size.Y
+		sim.Configure(cfg)
+		for UISCALE = 1; UISCALE <= 3; UISCALE++ {
+			world := image.Rect(0, 0, grid.WIDTH, grid.HEIGHT)
+			for i, m := range sim.Materials {
+				s := Swatch(i)
+				if !s.In(world) {
+					t.Errorf("%v at %dx: swatch %d at %v is off the grid", size, UISCALE, i, s)
+				}
+				if !s.In(ToolbarBounds()) {
+					t.Errorf("%v at %dx: swatch %d at %v is outside the toolbar %v", size, UISCALE, i, s, ToolbarBounds())
+				}
+				for j := range i {
+					if s.Overlaps(Swatch(j)) {
+						t.Errorf("%v at %dx: swatches %d and %d overlap", size, UISCALE, j, i)
+					}
+				}
+				if got, ok := ToolbarHit(s.Min.Add(s.Size().Div(2))); !ok || got != m {
+					t.Errorf("%v at %dx: swatch %d hits %v, want %v", size, UISCALE, i, got, m)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package render
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	VIDEORATE = 30 // frames per second written to the video
+	VIDEODIR  = GIFDIR
+	VIDEOEXT  = ".mp4" // container, chosen by ffmpeg from the extension
+)
+
+// VideoRecorder streams frames to an ffmpeg subprocess. Frames are written
+// at VIDEORATE whatever the display rate: the newest submitted frame is
+// repeated when drawing is slower and skipped frames are dropped when it is
+// faster.
+type VideoRecorder struct {
+	Path  string
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+
+	mu    sync.Mutex
+	frame *image.RGBA // newest submitted frame
+	stop  chan struct{}
+	done  chan error
+}
+
+// StartVideo starts ffmpeg writing a video of size frames to a timestamped
+// file in VIDEODIR.
+func StartVideo(ffmpeg string, size image.Point) (*VideoRecorder, error) {
+	if err := os.MkdirAll(VIDEODIR, 0o755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(VIDEODIR, time.Now().Format("sandbox-20060102-150405")+VIDEOEXT)
+	cmd := exec.Command(ffmpeg,
+		"-loglevel", "error",
+		"-f", "rawvideo", "-pix_fmt", "rgba",
+		"-s", fmt.Sprintf("%dx%d", size.X, size.Y),
+		"-r", fmt.Sprint(VIDEORATE),
+		"-i", "-",
+		"-pix_fmt", "yuv420p",
+		"-y", path,
+	)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	v := &VideoRecorder{
+		Path:  path,
+		cmd:   cmd,
+		stdin: stdin,
+		frame: image.NewRGBA(image.Rectangle{Max: size}),
+		stop:  make(chan struct{}),
+		done:  make(chan error, 1),
+	}
+	go v.run()
+	return v, nil
+}
+
+// Submit makes img the frame written from the next tick on.
+func (v *VideoRecorder) Submit(img *image.RGBA) {
+	v.mu.Lock()
+	copy(v.frame.Pix, img.Pix)
+	v.mu.Unlock()
+}
+
+func (v *VideoRecorder) run() {
+	out := make([]byte, len(v.frame.Pix))
+	ticker := time.NewTicker(time.Second / VIDEORATE)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-v.stop:
+			v.done <- nil
+			return
+		case <-ticker.C:
+			v.mu.Lock()
+			copy(out, v.frame.Pix)
+			v.mu.Unlock()
+			if _, err := v.stdin.Write(out); err != nil {
+				v.done <- err
+				return
+			}
+		}
+	}
+}
+
+// Stop finishes the video and waits for ffmpeg to exit.
+func (v *VideoRecorder) Stop() error {
+	close(v.stop)
+	err := <-v.done
+	if cerr := v.stdin.Close(); err == nil {
+		err = cerr
+	}
+	if werr := v.cmd.Wait(); err == nil {
+		err = werr
+	}
+	return err
+}
@@ -0,0 +1,67 @@
+package sim
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	AUTOSAVEDIR = "autosave"
+	AUTOSAVES   = 5 // newest autosaves kept
+)
+
+// WriteAutosave writes a save to a new timestamped slot in dir, then deletes
+// all but the newest AUTOSAVES slots. It returns the path written.
+func WriteAutosave(dir string, data []byte) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, time.Now().Format("autosave-20060102-150405.sav"))
+	// Write then rename so a crash never leaves a torn slot behind.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", err
+	}
+	slots := autosaves(dir)
+	for _, old := range slots[:max(len(slots)-AUTOSAVES, 0)] {
+		os.Remove(old)
+	}
+	return path, nil
+}
+
+// Autosave encodes the world of s now and writes it to a slot in dir in
+// the background.
+func (s *Simulation) Autosave(dir string) {
+	var b bytes.Buffer
+	if err := s.Save(&b); err != nil {
+		autosaveLog.Error("cannot save", "err", err)
+		return
+	}
+	go func() {
+		if _, err := WriteAutosave(dir, b.Bytes()); err != nil {
+			autosaveLog.Error("cannot write", "err", err)
+		}
+	}()
+}
+
+// NewestAutosave returns the most recent autosave in dir, if any.
+func NewestAutosave(dir string) (string, bool) {
+	slots := autosaves(dir)
+	if len(slots) == 0 {
+		return "", false
+	}
+	return slots[len(slots)-1], true
+}
+
+// autosaves lists the slots in dir from oldest to newest.
+func autosaves(dir string) []string {
+	slots, _ := filepath.Glob(filepath.Join(dir, "autosave-*.sav"))
+	sort.Strings(slots)
+	return slots
+}
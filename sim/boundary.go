@@ -0,0 +1,30 @@
+package sim
+
+import "github.com/jdavasligil/sandbox/grid"
+
+// PaintBoundary fills the disc of radius r centered on (h, k) with boundary
+// walls, or clears the boundaries there if place is false. Boundaries go
+// straight into the collision grid and are drawn as walls, but only this
+// tool removes them: erasers, cuts and undo pass them by. Cells holding
+// anything else are left alone, and boundaries are not part of the undo
+// history.
+func (s *Simulation) PaintBoundary(h, k, r int, place bool) {
+	for y := k - r; y < k+r; y++ {
+		for x := h - r; x < h+r; x++ {
+			if x < 0 || y < 0 || x >= grid.WIDTH || y >= grid.HEIGHT || (x-h)*(x-h)+(y-k)*(y-k) > r*r {
+				continue
+			}
+			switch {
+			case place && !s.grid.IsSet(x, y):
+				s.grid.Set(x, y, Wall)
+				s.col.Set(x, y)
+				s.boundary.Set(x, y)
+			case !place && s.boundary.IsSet(x, y):
+				s.grid.Clear(x, y)
+				s.col.Clear(x, y)
+				s.boundary.Clear(x, y)
+				s.chunks.Wake(x, y)
+			}
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package sim
+
+import "github.com/jdavasligil/go-ecs"
+
+// EventKind says what happened to a particle.
+type EventKind uint8
+
+const (
+	EventSpawned   EventKind = iota // added by a tool, emitter, paste or undo
+	EventSettled                    // came to rest
+	EventWoken                      // started falling again from rest
+	EventDestroyed                  // erased, or removed by undo
+	EventSensed                     // set off a sensor listening for its material
+	EVENTKINDS
+)
+
+// Event is something that happened to particle E of material M at (X, Y).
+type Event struct {
+	Kind EventKind
+	E    ecs.Entity
+	X, Y int
+	M    Material
+}
+
+// Bus passes the events of a tick to the functions subscribed to them.
+// Events are delivered at once, on the simulation goroutine, so
+// subscribers may read the world but must not change it. Clear and Load
+// replace the whole world without publishing anything.
+type Bus struct {
+	subs [EVENTKINDS][]func(Event)
+}
+
+// Subscribe calls fn with every event of kind published from now on.
+func (b *Bus) Subscribe(kind EventKind, fn func(Event)) {
+	b.subs[kind] = append(b.subs[kind], fn)
+}
+
+// Wants reports whether anything is subscribed to kind, so publishers can
+// skip the work of building events nobody hears.
+func (b *Bus) Wants(kind EventKind) bool {
+	return len(b.subs[kind]) > 0
+}
+
+// Publish delivers e to the subscribers of its kind.
+func (b *Bus) Publish(e Event) {
+	for _, fn := range b.subs[e.Kind] {
+		fn(e)
+	}
+}
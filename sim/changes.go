@@ -0,0 +1,73 @@
+package sim
+
+import (
+	"slices"
+
+	"github.com/jdavasligil/go-ecs"
+)
+
+// Changes tracks the entities whose component T was set or changed since it
+// was last reset, so a system can visit just those rather than every
+// entity that might have changed. It does not watch the world itself:
+// whatever writes a T marks the entity, along with the value it replaced.
+type Changes[T ecs.Component] struct {
+	ents []ecs.Entity
+	was  []T     // the T of each of ents when it was first marked
+	at   []int32 // index in ents plus one of each entity ID, or 0 if unmarked
+}
+
+// Mark records that the T of e changed from was. Should e already be
+// marked, the value it had first is kept.
+func (c *Changes[T]) Mark(e ecs.Entity, was T) {
+	id := int(e.ID())
+	if id >= len(c.at) {
+		// at is never shortened, so what it grows into is still zero.
+		c.at = slices.Grow(c.at, id+1-len(c.at))[:id+1]
+	}
+	if c.at[id] != 0 {
+		return
+	}
+	c.ents = append(c.ents, e)
+	c.was = append(c.was, was)
+	c.at[id] = int32(len(c.ents))
+}
+
+// Forget drops e, such as when it is destroyed, so that its ID is not
+// reported again under the entity that reuses it.
+func (c *Changes[T]) Forget(e ecs.Entity) {
+	id := int(e.ID())
+	if id >= len(c.at) || c.at[id] == 0 {
+		return
+	}
+	i := c.at[id] - 1
+	last := c.ents[len(c.ents)-1]
+	c.ents[i], c.was[i] = last, c.was[len(c.was)-1]
+	c.at[last.ID()] = i + 1
+	c.ents, c.was = c.ents[:len(c.ents)-1], c.was[:len(c.was)-1]
+	c.at[id] = 0
+}
+
+// Changed reports whether e is marked.
+func (c *Changes[T]) Changed(e ecs.Entity) bool {
+	id := int(e.ID())
+	return id < len(c.at) && c.at[id] != 0
+}
+
+// Ents returns the marked entities, in no particular order. The slice is
+// only good until the next change.
+func (c *Changes[T]) Ents() []ecs.Entity {
+	return c.ents
+}
+
+// Was returns what the T of each entity of Ents was when it was marked.
+func (c *Changes[T]) Was() []T {
+	return c.was
+}
+
+// Reset unmarks every entity.
+func (c *Changes[T]) Reset() {
+	for _, e := range c.ents {
+		c.at[e.ID()] = 0
+	}
+	c.ents, c.was = c.ents[:0], c.was[:0]
+}
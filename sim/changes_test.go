@@ -0,0 +1,60 @@
+package sim
+
+import (
+	"testing"
+
+	"github.com/jdavasligil/go-ecs"
+
+	"github.com/jdavasligil/sandbox/grid"
+)
+
+// TestMovedMatchesPositions checks after each tick that the particles
+// marked as moved are exactly those whose position changed, that each was
+// marked with where it started, and that the motion handed to rendering
+// holds those that changed cell. One world is small enough to move serially
+// and one large enough to move in bands.
+func TestMovedMatchesPositions(t *testing.T) {
+	smallWorld(t)
+	for _, n := range []int{500, 2 * PARALLELMIN} {
+		s := NewSimulation(nil)
+		s.Seed(1, 2)
+		for x := 0; x < grid.WIDTH; x++ {
+			s.SpawnCell(x, grid.HEIGHT-1, Wall, Velocity{})
+		}
+		for i := 0; s.world.EntityCount() < n; i++ {
+			s.SpawnCell((i*7919)%grid.WIDTH, (i/grid.WIDTH)%(grid.HEIGHT/2), Sand, Velocity{})
+		}
+		for tick := range 120 {
+			before := make(map[ecs.Entity]Position)
+			ents, ps := ecs.Query[Position](&s.world)
+			for i, e := range ents {
+				before[e] = ps[i]
+			}
+			s.Step()
+
+			marked := make(map[ecs.Entity]Position)
+			was := s.moved.Was()
+			for i, e := range s.moved.Ents() {
+				marked[e] = was[i]
+			}
+			cells := 0
+			ents, ps = ecs.Query[Position](&s.world)
+			for i, e := range ents {
+				from, ok := before[e]
+				if !ok {
+					t.Fatalf("%d particles, tick %d: particle %d appeared", n, tick, e)
+				}
+				w, moved := marked[e]
+				if moved != (ps[i] != from) || moved && w != from {
+					t.Fatalf("%d particles, tick %d: %d went from %v to %v, marked %v from %v", n, tick, e, from, ps[i], moved, w)
+				}
+				if int(from.X) != int(ps[i].X) || int(from.Y) != int(ps[i].Y) {
+					cells++
+				}
+			}
+			if len(s.motion) != cells {
+				t.Fatalf("%d particles, tick %d: %d motions for %d particles that changed cell", n, tick, len(s.motion), cells)
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package sim
+
+import (
+	"image"
+
+	"github.com/jdavasligil/go-ecs"
+
+	"github.com/jdavasligil/sandbox/grid"
+)
+
+const CHUNK = 64 // side of a square chunk, in cells
+
+// Chunks files resting particles by the chunk of the world they came to
+// rest in. A chunk sleeps until a support cell in or just below it is
+// cleared, so piles that nothing touches cost nothing per tick.
+type Chunks struct {
+	w, h    int            // chunks across and down
+	resting [][]ecs.Entity // particles that came to rest in each chunk
+	awake   []bool
+	woken   []int // awake chunks, in the order they woke
+}
+
+func NewChunks() Chunks {
+	w := (grid.WIDTH + CHUNK - 1) / CHUNK
+	h := (grid.HEIGHT + CHUNK - 1) / CHUNK
+	return Chunks{
+		w:       w,
+		h:       h,
+		resting: make([][]ecs.Entity, w*h),
+		awake:   make([]bool, w*h),
+	}
+}
+
+// Chunk returns the index of the chunk holding (x, y).
+func (c *Chunks) Chunk(x, y int) int {
+	return x/CHUNK + c.w*(y/CHUNK)
+}
+
+// Rest files particle e as resting at (x, y).
+func (c *Chunks) Rest(e ecs.Entity, x, y int) {
+	i := c.Chunk(x, y)
+	c.resting[i] = append(c.resting[i], e)
+}
+
+// Wake marks the chunks that rest on (x, y) for a support check. Besides
+// the particle above a cell, those beside it and diagonally above may slide
+// into it, and any of them may lie across a chunk boundary.
+func (c *Chunks) Wake(x, y int) {
+	for _, d := range [...]image.Point{{0, -1}, {-1, -1}, {1, -1}, {-1, 0}, {1, 0}} {
+		if p := (image.Point{x + d.X, y + d.Y}); p.X >= 0 && p.X < grid.WIDTH && p.Y >= 0 {
+			c.wake(c.Chunk(p.X, p.Y))
+		}
+	}
+}
+
+func (c *Chunks) wake(i int) {
+	if !c.awake[i] {
+		c.awake[i] = true
+		c.woken = append(c.woken, i)
+	}
+}
+
+// WakeAll marks every chunk for a support check.
+func (c *Chunks) WakeAll() {
+	for i := range c.awake {
+		c.wake(i)
+	}
+}
+
+func (c *Chunks) Reset() {
+	for i := range c.resting {
+		c.resting[i] = c.resting[i][:0]
+	}
+	clear(c.awake)
+	c.woken = c.woken[:0]
+}
+
+// Settle checks the resting particles of every awake chunk and sets those
+// no longer Supported falling again, then puts the chunks back to sleep.
+// Freeing a particle's cell wakes the chunks around it in turn, so
+// everything resting on a removed cell falls or slides together.
+func (s *Simulation) Settle() {
+	c := &s.chunks
+	all := Band{col: &s.col, lo: 0, hi: grid.WIDTH}
+	for len(c.woken) > 0 {
+		i := c.woken[0]
+		c.woken = c.woken[1:]
+		c.awake[i] = false
+		kept := c.resting[i][:0]
+		for _, e := range c.resting[i] {
+			p, ok := s.resting(e, i)
+			if !ok {
+				continue
+			}
+			x, y := int(p.X), int(p.Y)
+			if !Supported(&all, x, y) {
+				s.col.Clear(x, y)
+				c.Wake(x, y)
+				ecs.Add(&s.world, e, Falling{})
+				if s.bus.Wants(EventWoken) {
+					m, _ := ecs.Get[Material](&s.world, e)
+					s.bus.Publish(Event{EventWoken, e, x, y, m})
+				}
+				continue
+			}
+			kept = append(kept, e)
+		}
+		clear(c.resting[i][len(kept):])
+		c.resting[i] = kept
+	}
+}
+
+// resting returns the position of e if it is still a particle resting in
+// chunk i. Entries go stale when their particle is destroyed or starts to
+// fall, and the entity may since have been recycled for another particle.
+func (s *Simulation) resting(e ecs.Entity, i int) (Position, bool) {
+	p, ok := ecs.Get[Position](&s.world, e)
+	if !ok {
+		return p, false
+	}
+	if _, falling := ecs.Get[Falling](&s.world, e); falling {
+		return p, false
+	}
+	return p, s.chunks.Chunk(int(p.X), int(p.Y)) == i
+}
@@ -0,0 +1,153 @@
+package sim
+
+import (
+	"image"
+	"image/color"
+)
+
+// Logic is what a gate computes from its inputs.
+type Logic uint8
+
+const (
+	NoLogic Logic = iota
+	LogicAnd
+	LogicOr
+	LogicNot
+)
+
+// Wire carries power from sensors that are on and gates that fire to
+// everything touching it, across any length of touching wire cells at
+// once. Powered wire is drawn as LiveWire, which only the simulation
+// places. Doors open and wired emitters run while a live wire touches them.
+//
+// Gates read the wires touching them on the left, top and bottom and power
+// the wire on their right. They see their inputs as they were the tick
+// before, so each gate delays a signal by one tick and loops of gates
+// oscillate instead of locking up.
+var Wire, LiveWire, AndGate, OrGate, NotGate Material
+
+func registerCircuits() {
+	Wire = RegisterElement(Element{Name: "wire", Color: color.RGBA{0x8c, 0x4e, 0x2a, 0xff}, Static: true})
+	LiveWire = RegisterElement(Element{
+		Name:   "live-wire",
+		Color:  color.RGBA{0xf0, 0xd0, 0x40, 0xff},
+		Static: true,
+		Hidden: true,
+	})
+	gate := func(name string, l Logic, c color.RGBA) Material {
+		return RegisterElement(Element{Name: name, Color: c, Static: true, Logic: l})
+	}
+	AndGate = gate("and-gate", LogicAnd, color.RGBA{0x3a, 0x8c, 0x5a, 0xff})
+	OrGate = gate("or-gate", LogicOr, color.RGBA{0x3a, 0x6a, 0x8c, 0xff})
+	NotGate = gate("not-gate", LogicNot, color.RGBA{0x8c, 0x3a, 0x6a, 0xff})
+}
+
+// Conducts reports whether material m is wire, powered or not.
+func (m Material) Conducts() bool {
+	return m == Wire || m == LiveWire
+}
+
+// Unlit returns the material m is painted as, which differs from m for
+// powered wire.
+func (m Material) Unlit() Material {
+	if m == LiveWire {
+		return Wire
+	}
+	return m
+}
+
+// fires reports whether the gate at g powers its output.
+func (s *Simulation) fires(g image.Point) bool {
+	inputs, live := 0, 0
+	for _, d := range []image.Point{{-1, 0}, {0, -1}, {0, 1}} {
+		if q := g.Add(d); q.In(s.grid.Bounds()) && s.grid.At(q.X, q.Y).Conducts() {
+			inputs++
+			if s.grid.At(q.X, q.Y) == LiveWire {
+				live++
+			}
+		}
+	}
+	switch Elements[s.grid.At(g.X, g.Y)].Logic {
+	case LogicAnd:
+		return inputs > 0 && live == inputs
+	case LogicOr:
+		return live > 0
+	case LogicNot:
+		return live == 0
+	}
+	return false
+}
+
+// power relights the wires from the sensors that are on and the gates that
+// fire.
+func (s *Simulation) power() {
+	if s.staticStale {
+		s.relist()
+	}
+	seeds := s.surge[:0]
+	for _, sn := range s.sensors {
+		if !sn.on {
+			continue
+		}
+		r := sn.Rect.Inset(-1).Intersect(s.grid.Bounds())
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if s.grid.At(x, y).Conducts() {
+					seeds = append(seeds, image.Point{x, y})
+				}
+			}
+		}
+	}
+	for _, g := range s.gates {
+		if q := g.Add(image.Point{1, 0}); q.In(s.grid.Bounds()) && s.grid.At(q.X, q.Y).Conducts() && s.fires(g) {
+			seeds = append(seeds, q)
+		}
+	}
+
+	s.lit.Reset()
+	for len(seeds) > 0 {
+		q := seeds[len(seeds)-1]
+		seeds = seeds[:len(seeds)-1]
+		if s.lit.IsSet(q.X, q.Y) {
+			continue
+		}
+		s.lit.Set(q.X, q.Y)
+		for _, d := range []image.Point{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+			if n := q.Add(d); n.In(s.grid.Bounds()) && !s.lit.IsSet(n.X, n.Y) && s.grid.At(n.X, n.Y).Conducts() {
+				seeds = append(seeds, n)
+			}
+		}
+	}
+	s.surge = seeds
+
+	for _, w := range s.wires {
+		m := s.grid.At(w.X, w.Y)
+		if !m.Conducts() {
+			continue
+		}
+		want := Wire
+		if s.lit.IsSet(w.X, w.Y) {
+			want = LiveWire
+		}
+		if m != want {
+			s.grid.Set(w.X, w.Y, want)
+		}
+	}
+}
+
+// wiredAround reports whether any wire touches or lies within r, and if so
+// whether any of it is live.
+func (s *Simulation) wiredAround(r image.Rectangle) (wired, live bool) {
+	r = r.Inset(-1).Intersect(s.grid.Bounds())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if m := s.grid.At(x, y); m.Conducts() {
+				wired = true
+				if m == LiveWire {
+					return true, true
+				}
+			}
+		}
+	}
+	return wired, false
+}
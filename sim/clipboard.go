@@ -0,0 +1,72 @@
+package sim
+
+import (
+	"image"
+
+	"github.com/jdavasligil/go-ecs"
+)
+
+// Clipboard holds a copied region of the world. Positions are relative to
+// the top left corner of the region.
+type Clipboard struct {
+	Size      image.Point
+	Cells     []Cell     // static cells
+	Particles []Particle // particle snapshots; E is unused
+}
+
+// Copy returns the static cells and particles within r. Cells of hidden
+// materials belong to whatever placed them and are left behind.
+func (s *Simulation) Copy(r image.Rectangle) Clipboard {
+	r = r.Intersect(s.grid.Bounds())
+	cb := Clipboard{Size: r.Size()}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if m := s.grid.At(x, y).Unlit(); m.IsStatic() && !Elements[m].Hidden {
+				cb.Cells = append(cb.Cells, Cell{x - r.Min.X, y - r.Min.Y, m})
+			}
+		}
+	}
+	for _, e := range s.hash.Within(r, nil) {
+		p, _ := ecs.Get[Position](&s.world, e)
+		if !(image.Point{int(p.X), int(p.Y)}).In(r) {
+			continue
+		}
+		v, _ := ecs.Get[Velocity](&s.world, e)
+		m, _ := ecs.Get[Material](&s.world, e)
+		_, falling := ecs.Get[Falling](&s.world, e)
+		p.X -= float32(r.Min.X)
+		p.Y -= float32(r.Min.Y)
+		cb.Particles = append(cb.Particles, Particle{P: p, V: v, M: m, Falling: falling})
+	}
+	return cb
+}
+
+// Paste places cb centered on p as a single undo step. Cells that already
+// hold material are left as they are. Pasted particles start falling so
+// that any left without support settle again.
+func (s *Simulation) Paste(cb Clipboard, p image.Point) {
+	o := p.Sub(cb.Size.Div(2))
+	s.Record(func() {
+		for _, c := range cb.Cells {
+			s.SpawnCell(o.X+c.X, o.Y+c.Y, c.M, Velocity{})
+		}
+		for _, q := range cb.Particles {
+			q.P.X += float32(o.X)
+			q.P.Y += float32(o.Y)
+			q.Falling = true
+			if !(image.Point{int(q.P.X), int(q.P.Y)}).In(s.grid.Bounds()) {
+				continue
+			}
+			if e, ok := s.RestoreParticle(q); ok {
+				s.history.Added(e)
+			}
+		}
+	})
+}
+
+// Delete erases everything within r as a single undo step.
+func (s *Simulation) Delete(r image.Rectangle) {
+	s.Record(func() {
+		s.EraseRegion(r, func(x, y int) bool { return true })
+	})
+}
@@ -0,0 +1,89 @@
+package sim
+
+import "github.com/jdavasligil/go-ecs"
+
+// Commands queues the changes a system makes to the world while it walks
+// it, to be carried out in order by Flush once the system returns. Until
+// then queries see the world as the system found it: the slices being
+// walked are not grown or reordered under it, and a despawned entity is
+// not recycled for a new particle halfway through.
+type Commands struct {
+	queue  []command
+	doomed map[ecs.Entity]bool // entities queued to despawn
+}
+
+type commandOp uint8
+
+const (
+	commandSpawn   commandOp = iota // SpawnCell at x, y
+	commandDespawn                  // RemoveParticle e
+	commandRest                     // stop e falling
+)
+
+type command struct {
+	op   commandOp
+	e    ecs.Entity
+	x, y int
+	m    Material
+	v    Velocity
+}
+
+// Spawn queues SpawnCell(x, y, m, v).
+func (c *Commands) Spawn(x, y int, m Material, v Velocity) {
+	c.queue = append(c.queue, command{op: commandSpawn, x: x, y: y, m: m, v: v})
+}
+
+// SpawnDisc queues SpawnDisc(h, k, r, m, v), cell by cell.
+func (c *Commands) SpawnDisc(h, k, r int, m Material, v Velocity) {
+	r = min(r, MAXRADIUS)
+	for y := k - r; y < k+r; y++ {
+		for x := h - r; x < h+r; x++ {
+			if (x-h)*(x-h)+(y-k)*(y-k) <= r*r {
+				c.Spawn(x, y, m, v)
+			}
+		}
+	}
+}
+
+// Despawn queues particle e to be removed, reporting false if it already
+// is.
+func (c *Commands) Despawn(e ecs.Entity) bool {
+	if c.doomed[e] {
+		return false
+	}
+	if c.doomed == nil {
+		c.doomed = make(map[ecs.Entity]bool)
+	}
+	c.doomed[e] = true
+	c.queue = append(c.queue, command{op: commandDespawn, e: e})
+	return true
+}
+
+// Rest queues particle e to stop falling.
+func (c *Commands) Rest(e ecs.Entity) {
+	c.queue = append(c.queue, command{op: commandRest, e: e})
+}
+
+// Flush carries out the queued commands on s in the order they were made.
+// They come from systems rather than the player, so they stay out of any
+// stroke being drawn.
+func (c *Commands) Flush(s *Simulation) {
+	if len(c.queue) == 0 {
+		return
+	}
+	stroke := s.history.current
+	s.history.current = nil
+	for _, cmd := range c.queue {
+		switch cmd.op {
+		case commandSpawn:
+			s.SpawnCell(cmd.x, cmd.y, cmd.m, cmd.v)
+		case commandDespawn:
+			s.RemoveParticle(cmd.e)
+		case commandRest:
+			ecs.Remove[Falling](&s.world, cmd.e)
+		}
+	}
+	s.history.current = stroke
+	c.queue = c.queue[:0]
+	clear(c.doomed)
+}
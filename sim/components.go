@@ -0,0 +1,88 @@
+package sim
+
+import (
+	"image"
+
+	"github.com/jdavasligil/go-ecs"
+
+	"github.com/jdavasligil/sandbox/grid"
+)
+
+// ECS TYPES
+const (
+	PositionID ecs.ComponentID = iota
+	VelocityID
+	FallingID
+	MaterialID
+)
+
+type Position struct {
+	X, Y float32
+}
+
+func (p Position) ID() ecs.ComponentID {
+	return PositionID
+}
+
+type Velocity struct {
+	X, Y float32
+}
+
+func (v Velocity) ID() ecs.ComponentID {
+	return VelocityID
+}
+
+type Falling struct{}
+
+func (f Falling) ID() ecs.ComponentID {
+	return FallingID
+}
+
+func InitializeWorld(world *ecs.World) {
+	ecs.Initialize[Position](world)
+	ecs.Initialize[Velocity](world)
+	ecs.Initialize[Falling](world)
+	ecs.Initialize[Material](world)
+}
+
+// Field records the velocity of the particle occupying each cell. Resting
+// particles have zero velocity.
+type Field struct {
+	data []Velocity
+}
+
+func NewField() Field {
+	return Field{
+		data: make([]Velocity, grid.WIDTH*grid.HEIGHT),
+	}
+}
+
+func (f *Field) At(x, y int) Velocity {
+	return f.data[x+grid.WIDTH*y]
+}
+
+func (f *Field) Set(x, y int, v Velocity) {
+	f.data[x+grid.WIDTH*y] = v
+}
+
+func (f *Field) Reset() {
+	clear(f.data)
+}
+
+// CopyRect copies the velocities of src within r into f.
+func (f *Field) CopyRect(src *Field, r image.Rectangle) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		i := r.Min.X + grid.WIDTH*y
+		j := r.Max.X + grid.WIDTH*y
+		copy(f.data[i:j], src.data[i:j])
+	}
+}
+
+// Despawn removes a particle entity and all of its components.
+func Despawn(world *ecs.World, e ecs.Entity) {
+	ecs.Remove[Position](world, e)
+	ecs.Remove[Velocity](world, e)
+	ecs.Remove[Falling](world, e)
+	ecs.Remove[Material](world, e)
+	world.DestroyEntity(e)
+}
@@ -0,0 +1,136 @@
+package sim
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jdavasligil/sandbox/grid"
+)
+
+// Config holds the world size and physics constants read at startup.
+type Config struct {
+	Width     int
+	Height    int
+	SimRate   int     // ticks per second
+	FrameRate int     // frames per second, or 0 to pace by the display
+	Gravity   float32 // px/s/s
+	MaxSand   int     // particles the brush may fill the world with, or 0 for half the cells
+	MaxVel    float32 // px/s, or 0 for 4 px per tick
+	UIScale   int     // times larger the HUD and toolbar are drawn, from 1 to 3
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Width:     800,
+		Height:    800,
+		SimRate:   64,
+		FrameRate: 60,
+		Gravity:   490.0,
+		UIScale:   1,
+	}
+}
+
+// Check reports the first setting that cannot work.
+func (c Config) Check() error {
+	switch {
+	case c.Width <= 0 || c.Height <= 0:
+		return errors.New("width and height must be positive")
+	case c.SimRate <= 0:
+		return errors.New("simrate must be positive")
+	case c.FrameRate < 0:
+		return errors.New("fps must not be negative")
+	case c.MaxSand < 0 || c.MaxVel < 0:
+		return errors.New("maxsand and maxvel must not be negative")
+	case c.UIScale < 1 || c.UIScale > 3:
+		return errors.New("uiscale must be from 1 to 3")
+	}
+	return nil
+}
+
+// Configure sets the package settings from c.
+func Configure(c Config) {
+	grid.WIDTH = c.Width
+	grid.HEIGHT = c.Height
+	GRAVITY = c.Gravity
+	MAXSAND = c.MaxSand
+	if MAXSAND == 0 {
+		MAXSAND = grid.WIDTH * grid.HEIGHT / 2
+	}
+	SetRates(c.SimRate, c.FrameRate)
+	if c.MaxVel > 0 {
+		MAXVEL = c.MaxVel
+	}
+	symmetryTransforms = buildTransforms()
+}
+
+// LoadConfig returns the defaults overridden by the config file at path. A
+// missing file leaves the defaults alone.
+func LoadConfig(path string) (Config, error) {
+	c := DefaultConfig()
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, errors.ErrUnsupported) {
+		// A browser has no file system to read it from.
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	defer f.Close()
+	if err := ParseConfig(f, &c); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// ParseConfig reads settings into c from the flat subset of TOML used by
+// sandbox.toml: one "key = value" pair per line with integer or float values
+// and # comments. Keys are the lower case Config field names, with fps for
+// FrameRate.
+func ParseConfig(r io.Reader, c *Config) error {
+	ints := map[string]*int{
+		"width":   &c.Width,
+		"height":  &c.Height,
+		"simrate": &c.SimRate,
+		"fps":     &c.FrameRate,
+		"maxsand": &c.MaxSand,
+		"uiscale": &c.UIScale,
+	}
+	floats := map[string]*float32{
+		"gravity": &c.Gravity,
+		"maxvel":  &c.MaxVel,
+	}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("line %d: want key = value", n)
+		}
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if p, ok := ints[k]; ok {
+			i, err := strconv.Atoi(strings.ReplaceAll(v, "_", ""))
+			if err != nil {
+				return fmt.Errorf("line %d: %s: %w", n, k, err)
+			}
+			*p = i
+		} else if p, ok := floats[k]; ok {
+			f, err := strconv.ParseFloat(strings.ReplaceAll(v, "_", ""), 32)
+			if err != nil {
+				return fmt.Errorf("line %d: %s: %w", n, k, err)
+			}
+			*p = float32(f)
+		} else {
+			return fmt.Errorf("line %d: unknown key %q", n, k)
+		}
+	}
+	return sc.Err()
+}
@@ -0,0 +1,113 @@
+package sim
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   string
+		want func(*Config) // changes from the defaults, or nil on error
+		err  string        // part of the error
+	}{
+		{"empty", "", func(*Config) {}, ""},
+		{"blank lines and comments", "\n  \n# width = 5\n\t# fps = 1\n", func(*Config) {}, ""},
+		{"ints", "width = 320\nheight=240\nsimrate = 30\nfps = 0\nmaxsand = 1000\nuiscale = 2", func(c *Config) {
+			c.Width, c.Height, c.SimRate, c.FrameRate, c.MaxSand, c.UIScale = 320, 240, 30, 0, 1000, 2
+		}, ""},
+		{"floats", "gravity = 9.8\nmaxvel = 200", func(c *Config) {
+			c.Gravity, c.MaxVel = 9.8, 200
+		}, ""},
+		{"trailing comment", "width = 320 # px", func(c *Config) { c.Width = 320 }, ""},
+		{"underscores", "maxsand = 100_000\ngravity = 1_000.5", func(c *Config) {
+			c.MaxSand, c.Gravity = 100000, 1000.5
+		}, ""},
+		{"later line wins", "width = 1\nwidth = 2", func(c *Config) { c.Width = 2 }, ""},
+		{"negative", "fps = -1", func(c *Config) { c.FrameRate = -1 }, ""},
+		{"crlf", "width = 320\r\nheight = 240\r\n", func(c *Config) { c.Width, c.Height = 320, 240 }, ""},
+
+		{"no equals", "width 320", nil, "line 1: want key = value"},
+		{"section", "[world]\nwidth = 320", nil, "line 1: want key = value"},
+		{"unknown key", "# header\ndepth = 3", nil, `line 2: unknown key "depth"`},
+		{"keys are lower case", "Width = 320", nil, `unknown key "Width"`},
+		{"quoted key", `"width" = 320`, nil, "unknown key"},
+		{"quoted value", `width = "320"`, nil, "line 1: width"},
+		{"empty value", "width =", nil, "line 1: width"},
+		{"float for int", "width = 320.5", nil, "line 1: width"},
+		{"word for float", "gravity = down", nil, "line 1: gravity"},
+		{"error after good lines", "width = 320\nheight = 240\nfps = lots", nil, "line 3: fps"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := DefaultConfig()
+			err := ParseConfig(strings.NewReader(tc.in), &c)
+			if tc.want == nil {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("err %v, want one containing %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := DefaultConfig()
+			tc.want(&want)
+			if c != want {
+				t.Fatalf("got %+v, want %+v", c, want)
+			}
+		})
+	}
+}
+
+// TestShippedConfig checks the sandbox.toml at the root of the repository
+// parses and describes a world that can run.
+func TestShippedConfig(t *testing.T) {
+	f, err := os.Open("../sandbox.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	c := DefaultConfig()
+	if err := ParseConfig(f, &c); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Check(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigCheck(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		set  func(*Config)
+		ok   bool
+	}{
+		{"defaults", func(*Config) {}, true},
+		{"zero width", func(c *Config) { c.Width = 0 }, false},
+		{"negative height", func(c *Config) { c.Height = -1 }, false},
+		{"zero simrate", func(c *Config) { c.SimRate = 0 }, false},
+		{"display paced", func(c *Config) { c.FrameRate = 0 }, true},
+		{"negative fps", func(c *Config) { c.FrameRate = -1 }, false},
+		{"negative maxsand", func(c *Config) { c.MaxSand = -1 }, false},
+		{"negative maxvel", func(c *Config) { c.MaxVel = -1 }, false},
+		{"uiscale 3", func(c *Config) { c.UIScale = 3 }, true},
+		{"uiscale 0", func(c *Config) { c.UIScale = 0 }, false},
+		{"uiscale 4", func(c *Config) { c.UIScale = 4 }, false},
+	} {
+		c := DefaultConfig()
+		tc.set(&c)
+		if err := c.Check(); (err == nil) != tc.ok {
+			t.Errorf("%s: err %v, want ok %v", tc.name, err, tc.ok)
+		}
+	}
+}
+
+// smallWorld configures a 200x150 world for the rest of the test.
+func smallWorld(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Width, cfg.Height = 200, 150
+	Configure(cfg)
+	t.Cleanup(func() { Configure(DefaultConfig()) })
+}
@@ -0,0 +1,126 @@
+package sim
+
+import (
+	"cmp"
+	"image"
+	"image/color"
+	"slices"
+
+	"github.com/jdavasligil/go-ecs"
+
+	"github.com/jdavasligil/sandbox/grid"
+)
+
+const CONVEYORSPEED = 16 // cells a second conveyors move what rests on them
+
+// Conveyors are static materials that slide the particles resting on top
+// of them sideways, one cell at a time, without lifting them. A particle
+// slid off the end of a belt falls with the belt's speed.
+var ConveyorLeft, ConveyorRight Material
+
+func registerConveyors() {
+	belt := func(name string, d int, c color.RGBA) Material {
+		return RegisterElement(Element{Name: name, Color: c, Static: true, Conveys: d})
+	}
+	ConveyorLeft = belt("conveyor-left", -1, color.RGBA{0x6e, 0x6e, 0x30, 0xff})
+	ConveyorRight = belt("conveyor-right", 1, color.RGBA{0x5c, 0x5c, 0x24, 0xff})
+}
+
+// onBelt returns the way the conveyor under (x, y) runs, or 0 if there is
+// none.
+func (s *Simulation) onBelt(x, y int) int {
+	if y+1 >= grid.HEIGHT {
+		return 0
+	}
+	return Elements[s.grid.At(x, y+1)].Conveys
+}
+
+// ride files the particle of a settled event as riding a conveyor if it
+// came to rest on one.
+func (s *Simulation) ride(ev Event) {
+	if s.onBelt(ev.X, ev.Y) != 0 {
+		s.riding = append(s.riding, ev.E)
+	}
+}
+
+// conveyAt files the particle resting on (x, y) as riding if (x, y) is a
+// conveyor. Those that settle there later are filed by ride.
+func (s *Simulation) conveyAt(x, y int) {
+	if Elements[s.grid.At(x, y)].Conveys == 0 || y == 0 {
+		return
+	}
+	for _, e := range s.particlesAt(image.Rect(x, y-1, x+1, y)) {
+		if _, falling := ecs.Get[Falling](&s.world, e); !falling {
+			s.riding = append(s.riding, e)
+		}
+	}
+}
+
+// Convey slides the particles riding conveyors along, leading ones first so
+// that a row moves together. A particle that has left its belt is dropped.
+// One with a particle ahead of it waits its turn.
+func (s *Simulation) Convey() {
+	if len(s.riding) == 0 {
+		s.conveyed = 0
+		return
+	}
+	s.conveyed += CONVEYORSPEED * DELTA
+	for ; s.conveyed >= 1; s.conveyed-- {
+		type rider struct {
+			e  ecs.Entity
+			at image.Point
+			d  int
+		}
+		var riders []rider
+		for _, e := range s.riding {
+			p, ok := ecs.Get[Position](&s.world, e)
+			if !ok {
+				continue
+			}
+			if _, falling := ecs.Get[Falling](&s.world, e); falling {
+				continue
+			}
+			at := image.Point{int(p.X), int(p.Y)}
+			if d := s.onBelt(at.X, at.Y); d != 0 {
+				riders = append(riders, rider{e, at, d})
+			}
+		}
+		slices.SortFunc(riders, func(a, b rider) int {
+			return cmp.Or(cmp.Compare(b.at.X*b.d, a.at.X*a.d), cmp.Compare(a.e, b.e))
+		})
+		riders = slices.CompactFunc(riders, func(a, b rider) bool { return a.e == b.e })
+
+		s.riding = s.riding[:0]
+		for _, r := range riders {
+			to := r.at.Add(image.Point{r.d, 0})
+			switch {
+			case !to.In(s.grid.Bounds()) || s.grid.IsSet(to.X, to.Y):
+				s.riding = append(s.riding, r.e)
+			case Supported(&Band{col: &s.col, lo: 0, hi: grid.WIDTH}, to.X, to.Y):
+				s.slide(r.e, r.at, to)
+				s.riding = append(s.riding, r.e)
+			default:
+				s.displace(r.e, to, Velocity{float32(r.d) * CONVEYORSPEED, 0})
+			}
+		}
+	}
+}
+
+// slide moves particle e, resting at from, to the free and supported cell
+// to, where it stays at rest.
+func (s *Simulation) slide(e ecs.Entity, from, to image.Point) {
+	pos, _ := ecs.GetMut[Position](&s.world, e)
+	m, _ := ecs.Get[Material](&s.world, e)
+	s.grid.Clear(from.X, from.Y)
+	s.col.Clear(from.X, from.Y)
+	s.chunks.Wake(from.X, from.Y)
+	s.field.Set(from.X, from.Y, Velocity{})
+	s.hash.Move(e, from.X, from.Y, to.X, to.Y)
+	s.moved.Mark(e, *pos)
+	*pos = Position{float32(to.X), float32(to.Y)}
+	s.grid.Set(to.X, to.Y, m)
+	s.col.Set(to.X, to.Y)
+	if s.chunks.Chunk(from.X, from.Y) != s.chunks.Chunk(to.X, to.Y) {
+		s.chunks.Rest(e, to.X, to.Y)
+	}
+}
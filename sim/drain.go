@@ -0,0 +1,100 @@
+package sim
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/jdavasligil/go-ecs"
+)
+
+// Drain is a static material that swallows the particles coming to rest on
+// or beside it, so that contraptions fed by a tap can run forever.
+var Drain Material
+
+func registerDrain() {
+	Drain = RegisterElement(Element{
+		Name:   "drain",
+		Color:  color.RGBA{0x3a, 0x1c, 0x4a, 0xff},
+		Static: true,
+		Update: SystemFunc((*Simulation).Drain),
+	})
+}
+
+// sinking is a particle resting against a drain, waiting to be swallowed.
+type sinking struct {
+	e    ecs.Entity
+	x, y int
+}
+
+// touchesDrain reports whether a particle resting at (x, y) lies on or
+// beside a drain.
+func (s *Simulation) touchesDrain(x, y int) bool {
+	for _, d := range [...]image.Point{{-1, 0}, {1, 0}, {-1, 1}, {0, 1}, {1, 1}} {
+		p := image.Point{x + d.X, y + d.Y}
+		if p.In(s.grid.Bounds()) && s.grid.At(p.X, p.Y) == Drain {
+			return true
+		}
+	}
+	return false
+}
+
+// sink queues the particle of a settled event if it rests against a drain.
+func (s *Simulation) sink(ev Event) {
+	if s.touchesDrain(ev.X, ev.Y) {
+		s.sinking = append(s.sinking, sinking{ev.E, ev.X, ev.Y})
+	}
+}
+
+// drainAt queues the particles already resting against (x, y) if it is a
+// drain. Those that settle there later are queued by sink.
+func (s *Simulation) drainAt(x, y int) {
+	if s.grid.At(x, y) != Drain {
+		return
+	}
+	for _, e := range s.hash.Within(image.Rect(x-1, y-1, x+2, y+1), nil) {
+		if _, falling := ecs.Get[Falling](&s.world, e); falling {
+			continue
+		}
+		p, _ := ecs.Get[Position](&s.world, e)
+		if px, py := int(p.X), int(p.Y); px >= x-1 && px <= x+1 && py >= y-1 && py <= y && s.touchesDrain(px, py) {
+			s.sinking = append(s.sinking, sinking{e, px, py})
+		}
+	}
+}
+
+// Drain removes the particles queued against drains, oldest first, at up to
+// DrainRate a second. A queued particle that has since moved away, or whose
+// drain was erased, is dropped from the queue.
+func (s *Simulation) Drain() {
+	if len(s.sinking) == 0 {
+		return
+	}
+	n := len(s.sinking)
+	if s.DrainRate > 0 {
+		per := s.DrainRate / float64(SIMRATE)
+		s.drainCredit = min(s.drainCredit+per, max(per, 1))
+		n = int(s.drainCredit)
+	}
+	done := 0
+	for _, sk := range s.sinking {
+		if n == 0 {
+			break
+		}
+		done++
+		p, ok := ecs.Get[Position](&s.world, sk.e)
+		if !ok || int(p.X) != sk.x || int(p.Y) != sk.y || !s.touchesDrain(sk.x, sk.y) {
+			continue
+		}
+		if _, falling := ecs.Get[Falling](&s.world, sk.e); falling {
+			continue
+		}
+		if !s.commands.Despawn(sk.e) {
+			continue
+		}
+		n--
+		if s.DrainRate > 0 {
+			s.drainCredit--
+		}
+	}
+	s.sinking = append(s.sinking[:0], s.sinking[done:]...)
+}
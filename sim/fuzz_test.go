@@ -0,0 +1,119 @@
+package sim
+
+import (
+	"io"
+	"math/rand/v2"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/mobile/event/key"
+	"golang.org/x/mobile/event/mouse"
+
+	"github.com/jdavasligil/sandbox/grid"
+	"github.com/jdavasligil/sandbox/input"
+)
+
+const FUZZTICKS = 2000 // most ticks one fuzz input may run
+
+var fuzzButtons = []mouse.Button{
+	mouse.ButtonLeft, mouse.ButtonRight, mouse.ButtonMiddle, mouse.ButtonWheelUp, mouse.ButtonWheelDown,
+}
+
+// fuzzWorld returns a simulation on a small world that saves into a
+// temporary directory, and the commands bound to keys by default.
+func fuzzWorld(t *testing.T) (*Simulation, []any) {
+	smallWorld(t)
+	out := SetLogOutput(io.Discard)
+	t.Cleanup(func() { SetLogOutput(out) })
+
+	stamps, err := LoadStamps("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keymap, err := input.LoadKeymap("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cmds []any
+	for _, k := range input.DefaultKeys {
+		if _, ok := keymap.Find(k.Command); ok {
+			cmds = append(cmds, k.Command)
+		}
+	}
+	s := NewSimulation(stamps)
+	s.Seed(1, 2)
+	s.SavePath = filepath.Join(t.TempDir(), "fuzz.sav")
+	t.Cleanup(s.Close)
+	return s, cmds
+}
+
+// feed plays data on s as input, four bytes an event, checking the world
+// after every tick. The low three bits of the first byte pick a mouse
+// press, move, release or wheel step at the cell picked by the next two
+// bytes, reaching a little past every edge; a key; or a few ticks.
+func feed(t *testing.T, s *Simulation, cmds []any, data []byte) {
+	ticks := 0
+	for ; len(data) >= 4 && ticks < FUZZTICKS; data = data[4:] {
+		op, a, b := data[0], data[1], data[2]
+		n := 1
+		switch op & 7 {
+		case 0, 1, 2, 3:
+			e := mouse.Event{
+				X:         (float32(a) - 16) * float32(grid.WIDTH) / 224,
+				Y:         (float32(b) - 16) * float32(grid.HEIGHT) / 224,
+				Button:    fuzzButtons[int(op>>3)%len(fuzzButtons)],
+				Direction: [...]mouse.Direction{mouse.DirPress, mouse.DirNone, mouse.DirRelease, mouse.DirStep}[op&3],
+			}
+			if op&0x40 != 0 {
+				e.Modifiers |= key.ModShift
+			}
+			if op&0x80 != 0 {
+				e.Modifiers |= key.ModAlt
+			}
+			s.Handle(e)
+		case 4, 5:
+			cmd := cmds[int(a)%len(cmds)]
+			if _, ok := cmd.(input.View); !ok {
+				s.Handle(cmd)
+			}
+		default:
+			n = int(a%32) + 1
+		}
+		for range n {
+			s.Step()
+			if err := s.CheckInvariants(); err != nil {
+				t.Fatalf("tick %d: %v", s.tick, err)
+			}
+		}
+		ticks += n
+	}
+}
+
+func FuzzInput(f *testing.F) {
+	// A stroke across the world, a key, then time to settle.
+	f.Add([]byte{0, 10, 10, 0, 1, 200, 40, 0, 1, 240, 240, 0, 2, 240, 240, 0, 6, 31, 0, 0})
+	// Undo, redo and paste around a selection dragged off the edge.
+	f.Add([]byte{4, 19, 0, 0, 0, 0, 0, 0, 1, 255, 255, 0, 2, 255, 255, 0, 4, 28, 0, 0, 4, 27, 0, 0, 6, 31, 0, 0})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		s, cmds := fuzzWorld(t)
+		feed(t, s, cmds, data)
+	})
+}
+
+// TestSoak feeds long runs of random input to the simulation.
+func TestSoak(t *testing.T) {
+	runs, size := 8, 8000
+	if testing.Short() {
+		runs, size = 2, 2000
+	}
+	for seed := range uint64(runs) {
+		rng := rand.New(rand.NewPCG(seed, 0))
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = byte(rng.Uint32())
+		}
+		s, cmds := fuzzWorld(t)
+		feed(t, s, cmds, data)
+		s.Close()
+	}
+}
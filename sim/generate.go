@@ -0,0 +1,135 @@
+package sim
+
+import (
+	"fmt"
+	"image"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jdavasligil/sandbox/grid"
+)
+
+// Params are the numeric parameters given to a generator by name.
+type Params map[string]float64
+
+// Get returns the parameter called name, or def if it was not given, and
+// marks it read.
+func (p Params) Get(name string, def float64) float64 {
+	v, ok := p[name]
+	if !ok {
+		return def
+	}
+	delete(p, name)
+	return v
+}
+
+// Generator builds a scene for a world of the configured size from its
+// parameters and a seed, leaving in the parameters any it does not know.
+type Generator func(p Params, seed uint64) (Scene, error)
+
+// Generators are the generators -generate can name.
+var Generators = map[string]Generator{
+	"hourglass": Hourglass,
+	"terrain":   Terrain,
+}
+
+// Generate builds the scene spec asks for: the name of a generator,
+// optionally followed by a colon and comma separated name=value parameters,
+// such as "hourglass:neck=8,fill=0.5", from seed.
+func Generate(spec string, seed uint64) (Scene, error) {
+	name, args, _ := strings.Cut(spec, ":")
+	gen, ok := Generators[name]
+	if !ok {
+		return Scene{}, fmt.Errorf("unknown generator %q, want one of %s", name, strings.Join(keys(Generators), ", "))
+	}
+	p := Params{}
+	for _, arg := range strings.Split(args, ",") {
+		if arg == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(arg, "=")
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return Scene{}, fmt.Errorf("%s: parameter %q: %w", name, k, err)
+		}
+		p[k] = f
+	}
+	sc, err := gen(p, seed)
+	if err != nil {
+		return Scene{}, fmt.Errorf("%s: %w", name, err)
+	}
+	if len(p) > 0 {
+		return Scene{}, fmt.Errorf("%s: unknown parameters %s", name, strings.Join(keys(p), ", "))
+	}
+	return sc, nil
+}
+
+// GLASS is the radius of the walls of a generated hourglass.
+const GLASS = 2
+
+// Hourglass builds an hourglass of wall centered in the world, its top bulb
+// filled with sand falling through the neck. Each bulb is straight sided
+// for its outer third and tapers to the neck more steeply than the 45
+// degree slope sand comes to rest on, so the top bulb empties.
+//
+// Parameters are neck, the width of the gap in cells; bulb, the height of
+// each bulb in cells; and fill, the share of the top bulb filled, from 0 to
+// 1.
+func Hourglass(p Params, _ uint64) (Scene, error) {
+	neck := int(p.Get("neck", 6))
+	bulb := int(p.Get("bulb", float64(grid.HEIGHT*2/5)))
+	fill := p.Get("fill", 0.8)
+	if neck < 1 || bulb < 12 || fill < 0 || fill > 1 {
+		return Scene{}, fmt.Errorf("want neck of 1 or more, bulb of 12 or more and fill from 0 to 1")
+	}
+	taper := bulb * 2 / 3
+	waist := neck/2 + GLASS + 1 // half width of the neck, to the middle of its walls
+	half := waist + taper*2/5   // half width of the bulbs
+	c := image.Point{grid.WIDTH / 2, grid.HEIGHT / 2}
+	if 2*(bulb+GLASS) >= grid.HEIGHT || 2*(half+GLASS) >= grid.WIDTH {
+		return Scene{}, fmt.Errorf("neck %d and bulb %d do not fit a %dx%d world", neck, bulb, grid.WIDTH, grid.HEIGHT)
+	}
+
+	// The outline of the left side of the top bulb, which the rest mirrors.
+	side := []image.Point{{-half, -bulb}, {-half, -taper}, {-waist, 0}}
+	var sc Scene
+	wall := func(a, b image.Point) {
+		sc.Shapes = append(sc.Shapes, SceneShape{Shape: "line", Material: "wall",
+			X0: c.X + a.X, Y0: c.Y + a.Y, X1: c.X + b.X, Y1: c.Y + b.Y, R: GLASS})
+	}
+	for _, flip := range []image.Point{{1, 1}, {-1, 1}, {1, -1}, {-1, -1}} {
+		for i := 1; i < len(side); i++ {
+			wall(mul(side[i-1], flip), mul(side[i], flip))
+		}
+	}
+	wall(image.Point{-half, -bulb}, image.Point{half, -bulb})
+	wall(image.Point{-half, bulb}, image.Point{half, bulb})
+
+	// Sand lies in the bottom of the top bulb, row by row within its walls.
+	for dy := -int(fill * float64(bulb-GLASS-1)); dy < 0; dy++ {
+		in := half
+		if -dy < taper {
+			in = waist + (half-waist)*-dy/taper
+		}
+		in -= GLASS + 1
+		sc.Shapes = append(sc.Shapes, SceneShape{Shape: "rect", Material: "sand",
+			X0: c.X - in, Y0: c.Y + dy, X1: c.X + in, Y1: c.Y + dy})
+	}
+	return sc, nil
+}
+
+// keys returns the keys of m in order.
+func keys[V any](m map[string]V) []string {
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
+
+// mul scales p by f component by component.
+func mul(p, f image.Point) image.Point {
+	return image.Point{p.X * f.X, p.Y * f.Y}
+}
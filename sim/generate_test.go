@@ -0,0 +1,49 @@
+package sim
+
+import (
+	"testing"
+
+	"github.com/jdavasligil/go-ecs"
+
+	"github.com/jdavasligil/sandbox/grid"
+)
+
+// TestHourglassDrains runs generated hourglasses until their sand has come
+// to rest and checks all of it ended up in the bottom bulb.
+func TestHourglassDrains(t *testing.T) {
+	smallWorld(t)
+	for _, spec := range []string{"hourglass", "hourglass:fill=1", "hourglass:neck=1"} {
+		t.Run(spec, func(t *testing.T) {
+			sc, err := Generate(spec, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := NewSimulation(nil)
+			if err := s.ApplyScene(sc); err != nil {
+				t.Fatal(err)
+			}
+			for tick := 0; ; tick++ {
+				if tick == 60*SIMRATE {
+					t.Fatal("sand still falling after a minute")
+				}
+				s.Step()
+				if falling, _ := ecs.Query[Falling](&s.world); len(falling) == 0 && tick > 0 {
+					break
+				}
+			}
+			_, ps := ecs.Query[Position](&s.world)
+			if len(ps) == 0 {
+				t.Fatal("no sand")
+			}
+			top := 0
+			for _, p := range ps {
+				if int(p.Y) < grid.HEIGHT/2 {
+					top++
+				}
+			}
+			if top > 0 {
+				t.Errorf("%d of %d grains stuck in the top bulb", top, len(ps))
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package sim
+
+import (
+	"fmt"
+	"image"
+	"strings"
+
+	"github.com/jdavasligil/go-ecs"
+)
+
+// GoalKind says what a goal of a challenge asks for.
+type GoalKind uint8
+
+const (
+	GoalFill  GoalKind = iota // Count particles of Material inside Rect at once
+	GoalHold                  // the signal on Channel kept on for Ticks in a row
+	GoalAvoid                 // never more than Count particles of Material inside Rect
+)
+
+// Goal is one condition of a challenge.
+type Goal struct {
+	Kind     GoalKind
+	Rect     image.Rectangle
+	Material Material
+	Count    int
+	Channel  int
+	Ticks    int
+
+	have int  // particles inside Rect, or ticks held, as of the last check
+	met  bool // held long enough; fill goals are met only while full
+}
+
+// Outcome is how a challenge ended, if it has.
+type Outcome uint8
+
+const (
+	OutcomeNone Outcome = iota
+	OutcomeWon
+	OutcomeLost
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeWon:
+		return "won"
+	case OutcomeLost:
+		return "lost"
+	}
+	return "playing"
+}
+
+// Challenge is a scene played to its goals. It is won once every fill and
+// hold goal is met at the same time, or if it has avoid goals alone, once
+// Limit ticks pass without breaking them. It is lost when an avoid goal is
+// broken or Limit ticks pass first. Either way the simulation pauses to
+// show the outcome.
+type Challenge struct {
+	Goals   []Goal
+	Limit   uint64 // ticks allowed, or 0 for no limit
+	Outcome Outcome
+
+	start uint64 // tick the challenge began
+}
+
+// CheckGoals evaluates the goals of the challenge being played, if any.
+func (s *Simulation) CheckGoals() {
+	c := s.challenge
+	if c == nil || c.Outcome != OutcomeNone {
+		return
+	}
+	won, wanted := true, false
+	for i := range c.Goals {
+		g := &c.Goals[i]
+		switch g.Kind {
+		case GoalFill, GoalAvoid:
+			g.have = 0
+			for _, e := range s.particlesAt(g.Rect) {
+				if m, _ := ecs.Get[Material](&s.world, e); m == g.Material {
+					g.have++
+				}
+			}
+		case GoalHold:
+			if s.signals[g.Channel] {
+				g.have++
+			} else {
+				g.have = 0
+			}
+		}
+		switch g.Kind {
+		case GoalFill:
+			g.met = g.have >= g.Count
+		case GoalHold:
+			g.met = g.met || g.have >= g.Ticks
+		case GoalAvoid:
+			if g.have > g.Count {
+				s.endChallenge(OutcomeLost)
+				return
+			}
+			continue
+		}
+		wanted = true
+		won = won && g.met
+	}
+	over := c.Limit > 0 && s.tick-c.start >= c.Limit
+	switch {
+	case wanted && won, !wanted && over:
+		s.endChallenge(OutcomeWon)
+	case over:
+		s.endChallenge(OutcomeLost)
+	}
+}
+
+// endChallenge settles the outcome of the challenge and pauses to show it.
+func (s *Simulation) endChallenge(o Outcome) {
+	s.challenge.Outcome = o
+	s.paused = true
+	simLog.Info("challenge over", "outcome", o, "seconds", float64(s.tick-s.challenge.start)/float64(SIMRATE))
+}
+
+// GoalRects writes over dst the regions the goals of the challenge being
+// played look at.
+func (s *Simulation) GoalRects(dst []image.Rectangle) []image.Rectangle {
+	if s.challenge != nil {
+		for _, g := range s.challenge.Goals {
+			if g.Kind != GoalHold {
+				dst = append(dst, g.Rect)
+			}
+		}
+	}
+	return dst
+}
+
+// GoalLine sums up the progress of the challenge for the HUD, or returns ""
+// if none is being played.
+func (s *Simulation) GoalLine() string {
+	c := s.challenge
+	if c == nil {
+		return ""
+	}
+	var parts []string
+	for _, g := range c.Goals {
+		switch g.Kind {
+		case GoalFill:
+			parts = append(parts, fmt.Sprintf("%s %d/%d", g.Material, min(g.have, g.Count), g.Count))
+		case GoalHold:
+			if g.met {
+				parts = append(parts, "hold done")
+			} else {
+				parts = append(parts, fmt.Sprintf("hold %ds/%ds", g.have/SIMRATE, g.Ticks/SIMRATE))
+			}
+		case GoalAvoid:
+			parts = append(parts, fmt.Sprintf("no %s %d/%d", g.Material, g.have, g.Count))
+		}
+	}
+	if c.Limit > 0 && c.Outcome == OutcomeNone {
+		left := c.Limit - min(s.tick-c.start, c.Limit)
+		parts = append(parts, fmt.Sprintf("%ds left", (left+uint64(SIMRATE)-1)/uint64(SIMRATE)))
+	}
+	return "GOAL " + strings.Join(parts, ", ")
+}
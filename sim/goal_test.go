@@ -0,0 +1,30 @@
+package sim
+
+import "testing"
+
+// TestChallenge plays the golden challenge scene to a win, and the same
+// scene with its emitter taken away to a loss.
+func TestChallenge(t *testing.T) {
+	smallWorld(t)
+	sc, err := LoadScene("../render/testdata/golden/challenge.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	play := func(sc Scene) *Simulation {
+		sim := NewSimulation(nil)
+		if err := sim.ApplyScene(sc); err != nil {
+			t.Fatal(err)
+		}
+		for range int(sc.Limit)*SIMRATE + 1 {
+			sim.Step()
+		}
+		return sim
+	}
+	if sim := play(sc); sim.challenge.Outcome != OutcomeWon {
+		t.Errorf("got %v with the emitter, want won: %s", sim.challenge.Outcome, sim.GoalLine())
+	}
+	sc.Emitters = nil
+	if sim := play(sc); sim.challenge.Outcome != OutcomeLost {
+		t.Errorf("got %v without the emitter, want lost: %s", sim.challenge.Outcome, sim.GoalLine())
+	}
+}
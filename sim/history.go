@@ -0,0 +1,273 @@
+package sim
+
+import (
+	"github.com/jdavasligil/go-ecs"
+)
+
+const (
+	HISTORY       = 64      // strokes kept for undo
+	HISTORYSTROKE = 1 << 16 // changes a stroke may make and still be undone
+)
+
+// Cell is a static cell placed or cleared by a stroke.
+type Cell struct {
+	X, Y int
+	M    Material
+}
+
+// Particle is a snapshot of a removed particle entity.
+type Particle struct {
+	E       ecs.Entity
+	P       Position
+	V       Velocity
+	M       Material
+	Falling bool
+}
+
+// Edit holds the changes made by one stroke, from press to release.
+type Edit struct {
+	added   []ecs.Entity
+	removed []Particle
+	placed  []Cell
+	cleared []Cell
+
+	tooLarge bool // made more than HISTORYSTROKE changes, so not recorded
+}
+
+func (ed *Edit) size() int {
+	return len(ed.added) + len(ed.removed) + len(ed.placed) + len(ed.cleared)
+}
+
+func (ed *Edit) isEmpty() bool {
+	return ed.size() == 0
+}
+
+// History records the edit of each stroke in a bounded undo stack. Undoing
+// and redoing are the same operation: the edit is inverted in place, so what
+// it added is removed and what it removed is added back.
+type History struct {
+	undo []*Edit
+	redo []*Edit
+
+	// current is the edit being recorded, or nil between strokes.
+	current *Edit
+
+	// remap follows particles that were restored under a new entity so
+	// older edits still find them. Keys are the entities edits refer to.
+	remap map[ecs.Entity]ecs.Entity
+}
+
+func NewHistory() History {
+	return History{
+		remap: make(map[ecs.Entity]ecs.Entity),
+	}
+}
+
+// Begin starts recording a stroke.
+func (h *History) Begin() {
+	h.current = &Edit{}
+}
+
+// End finishes the stroke being recorded. A stroke that changed anything
+// becomes the newest undo step and discards the redo stack, unless it was
+// too large to undo.
+func (h *History) End() {
+	ed := h.current
+	h.current = nil
+	if ed == nil || ed.isEmpty() && !ed.tooLarge {
+		return
+	}
+	stale := h.remapped(h.redo)
+	h.redo = h.redo[:0]
+	if ed.tooLarge {
+		simLog.Warn("stroke too large to undo", "limit", HISTORYSTROKE)
+	} else {
+		h.undo = append(h.undo, ed)
+		if len(h.undo) > HISTORY {
+			stale = stale || h.remapped(h.undo[:1])
+			h.undo = h.undo[1:]
+		}
+	}
+	if stale {
+		h.prune()
+	}
+}
+
+// recording reports whether a change belongs in the edit being recorded.
+// Once a stroke makes HISTORYSTROKE changes its edit is let go, and the
+// rest of the stroke goes unrecorded.
+func (h *History) recording() bool {
+	ed := h.current
+	if ed == nil || ed.tooLarge {
+		return false
+	}
+	if ed.size() >= HISTORYSTROKE {
+		*ed = Edit{tooLarge: true}
+		return false
+	}
+	return true
+}
+
+// remapped reports whether any of eds refers to a restored particle.
+func (h *History) remapped(eds []*Edit) bool {
+	for _, ed := range eds {
+		for _, e := range ed.added {
+			if _, ok := h.remap[e]; ok {
+				return true
+			}
+		}
+		for _, p := range ed.removed {
+			if _, ok := h.remap[p.E]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// prune forgets the restored particles that no kept edit can reach. An
+// edit may reach one through the entities of others, so those are kept
+// as long as any edit leads to them.
+func (h *History) prune() {
+	keep := make(map[ecs.Entity]ecs.Entity)
+	follow := func(e ecs.Entity) {
+		for {
+			next, ok := h.remap[e]
+			if _, done := keep[e]; done || !ok {
+				return
+			}
+			keep[e] = next
+			e = next
+		}
+	}
+	for _, eds := range [][]*Edit{h.undo, h.redo} {
+		for _, ed := range eds {
+			for _, e := range ed.added {
+				follow(e)
+			}
+			for _, p := range ed.removed {
+				follow(p.E)
+			}
+		}
+	}
+	h.remap = keep
+}
+
+// Record runs fn as a single undo step, or as part of the stroke being
+// recorded if there is one.
+func (s *Simulation) Record(fn func()) {
+	if s.history.current != nil {
+		fn()
+		return
+	}
+	s.history.Begin()
+	fn()
+	s.history.End()
+}
+
+// Reset forgets every recorded stroke.
+func (h *History) Reset() {
+	*h = NewHistory()
+}
+
+func (h *History) Added(e ecs.Entity) {
+	if h.recording() {
+		h.current.added = append(h.current.added, e)
+	}
+}
+
+func (h *History) Removed(p Particle) {
+	if h.recording() {
+		h.current.removed = append(h.current.removed, p)
+	}
+}
+
+func (h *History) Placed(c Cell) {
+	if h.recording() {
+		h.current.placed = append(h.current.placed, c)
+	}
+}
+
+func (h *History) Cleared(c Cell) {
+	if h.recording() {
+		h.current.cleared = append(h.current.cleared, c)
+	}
+}
+
+// resolve returns the entity currently standing in for e.
+func (h *History) resolve(e ecs.Entity) ecs.Entity {
+	for {
+		next, ok := h.remap[e]
+		if !ok {
+			return e
+		}
+		e = next
+	}
+}
+
+// Undo reverts the newest stroke.
+func (s *Simulation) Undo() {
+	h := &s.history
+	if len(h.undo) == 0 {
+		return
+	}
+	ed := h.undo[len(h.undo)-1]
+	h.undo = h.undo[:len(h.undo)-1]
+	s.invert(ed)
+	h.redo = append(h.redo, ed)
+}
+
+// Redo reapplies the most recently undone stroke.
+func (s *Simulation) Redo() {
+	h := &s.history
+	if len(h.redo) == 0 {
+		return
+	}
+	ed := h.redo[len(h.redo)-1]
+	h.redo = h.redo[:len(h.redo)-1]
+	s.invert(ed)
+	h.undo = append(h.undo, ed)
+}
+
+// invert takes back the changes of ed and rewrites it as their opposite.
+// Particles that have since moved are removed wherever they are now.
+func (s *Simulation) invert(ed *Edit) {
+	h := &s.history
+	var removed []Particle
+	for _, key := range ed.added {
+		if p, ok := s.RemoveParticle(h.resolve(key)); ok {
+			p.E = key
+			removed = append(removed, p)
+		}
+	}
+	var added []ecs.Entity
+	for _, p := range ed.removed {
+		if e, ok := s.RestoreParticle(p); ok {
+			h.remap[p.E] = e
+			added = append(added, p.E)
+		}
+	}
+
+	var cleared []Cell
+	for _, c := range ed.placed {
+		if s.grid.At(c.X, c.Y).Unlit() == c.M && !s.boundary.IsSet(c.X, c.Y) {
+			s.grid.Clear(c.X, c.Y)
+			s.col.Clear(c.X, c.Y)
+			s.chunks.Wake(c.X, c.Y)
+			s.staticStale = s.staticStale || c.M.Listed()
+			cleared = append(cleared, c)
+		}
+	}
+	var placed []Cell
+	for _, c := range ed.cleared {
+		if !s.grid.IsSet(c.X, c.Y) {
+			s.grid.Set(c.X, c.Y, c.M)
+			s.col.Set(c.X, c.Y)
+			s.placed(c.X, c.Y)
+			placed = append(placed, c)
+		}
+	}
+
+	ed.added, ed.removed = added, removed
+	ed.placed, ed.cleared = placed, cleared
+}
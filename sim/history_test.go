@@ -0,0 +1,57 @@
+package sim
+
+import (
+	"io"
+	"testing"
+
+	"github.com/jdavasligil/sandbox/grid"
+)
+
+// TestHistoryRemapPruned undoes and redoes every stroke, so each one refers
+// to a restored particle, and checks that only the strokes still kept do.
+func TestHistoryRemapPruned(t *testing.T) {
+	smallWorld(t)
+	s := NewSimulation(nil)
+	for i := range 3 * HISTORY {
+		s.history.Begin()
+		s.SpawnCell(i%grid.WIDTH, i/grid.WIDTH, Sand, Velocity{})
+		s.history.End()
+		s.Undo()
+		s.Redo()
+	}
+	if n := len(s.history.remap); n > HISTORY {
+		t.Fatalf("%d restored particles remembered for %d strokes", n, HISTORY)
+	}
+	for range HISTORY {
+		s.Undo()
+	}
+	if n := s.world.EntityCount(); n != 2*HISTORY {
+		t.Fatalf("undoing every kept stroke left %d particles, want %d", n, 2*HISTORY)
+	}
+	if err := s.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHistoryStrokeTooLarge(t *testing.T) {
+	smallWorld(t)
+	out := SetLogOutput(io.Discard)
+	t.Cleanup(func() { SetLogOutput(out) })
+	s := NewSimulation(nil)
+
+	s.history.Begin()
+	s.SpawnCell(0, 0, Sand, Velocity{})
+	s.history.End()
+	s.Undo()
+	s.history.Begin()
+	for range HISTORYSTROKE + 1 {
+		s.history.Placed(Cell{0, 0, Wall})
+	}
+	if ed := s.history.current; ed.size() != 0 {
+		t.Fatalf("a stroke too large to undo still holds %d changes", ed.size())
+	}
+	s.history.End()
+	if len(s.history.undo)+len(s.history.redo) != 0 {
+		t.Fatalf("stroke too large to undo was kept: %d undo, %d redo", len(s.history.undo), len(s.history.redo))
+	}
+}
@@ -0,0 +1,91 @@
+package sim
+
+import (
+	"fmt"
+
+	"github.com/jdavasligil/go-ecs"
+
+	"github.com/jdavasligil/sandbox/grid"
+)
+
+// CheckInvariants reports the first way the world disagrees with itself:
+//
+//   - every particle has a material and a position on the grid
+//   - no two resting particles share a cell, and each resting particle is
+//     drawn in its material and marked in the collision grid
+//   - the collision grid holds just the resting particles and walls
+//   - every boundary is a wall
+//   - every cell drawn in a particle material holds a particle
+//   - once nothing is falling, there are as many such cells as particles
+//   - every particle marked as moved still exists
+//
+// Only resting particles are checked for sharing cells. Falling particles
+// pass through each other, and one stuck on a full column falls behind the
+// particle resting in its cell, as place allows, so while any are falling
+// two particles may share a cell and fewer cells are drawn than there are
+// particles. Once they come to rest they are checked like the others.
+func (s *Simulation) CheckInvariants() error {
+	ents, ps := ecs.Query[Position](&s.world)
+	if len(ents) != s.world.EntityCount() {
+		return fmt.Errorf("%d of %d particles have a position", len(ents), s.world.EntityCount())
+	}
+	held := make([]bool, grid.WIDTH*grid.HEIGHT) // cells holding any particle
+	resting := make(map[int]ecs.Entity)
+	falling := 0
+	for i, e := range ents {
+		x, y := int(ps[i].X), int(ps[i].Y)
+		if x < 0 || y < 0 || x >= grid.WIDTH || y >= grid.HEIGHT {
+			return fmt.Errorf("particle %d is off the grid at (%d, %d)", e, x, y)
+		}
+		m, ok := ecs.Get[Material](&s.world, e)
+		if !ok {
+			return fmt.Errorf("particle %d has no material", e)
+		}
+		held[y*grid.WIDTH+x] = true
+		if _, ok := ecs.Get[Falling](&s.world, e); ok {
+			falling++
+			continue
+		}
+		if other, ok := resting[y*grid.WIDTH+x]; ok {
+			return fmt.Errorf("particles %d and %d rest on (%d, %d)", other, e, x, y)
+		}
+		resting[y*grid.WIDTH+x] = e
+		if !s.col.IsSet(x, y) {
+			return fmt.Errorf("particle %d rests on (%d, %d) without colliding", e, x, y)
+		}
+		if at := s.grid.At(x, y); at != m {
+			return fmt.Errorf("particle %d of %v is drawn as %v at (%d, %d)", e, m, at, x, y)
+		}
+	}
+	walls, drawn := 0, 0
+	for i, m := range s.grid.data {
+		switch {
+		case m == Empty:
+		case m.IsStatic():
+			walls++
+		case !held[i]:
+			return fmt.Errorf("%v is drawn at (%d, %d) without a particle", m, i%grid.WIDTH, i/grid.WIDTH)
+		default:
+			drawn++
+		}
+	}
+	if n := s.col.Count(); n != len(resting)+walls {
+		return fmt.Errorf("%d cells collide for %d resting particles and %d walls", n, len(resting), walls)
+	}
+	for y := 0; y < grid.HEIGHT; y++ {
+		for x := 0; x < grid.WIDTH; x++ {
+			if s.boundary.IsSet(x, y) && s.grid.At(x, y) != Wall {
+				return fmt.Errorf("boundary at (%d, %d) is drawn as %v", x, y, s.grid.At(x, y))
+			}
+		}
+	}
+	if falling == 0 && drawn != len(ents) {
+		return fmt.Errorf("%d cells are drawn for %d particles", drawn, len(ents))
+	}
+	for _, e := range s.moved.Ents() {
+		if _, ok := ecs.Get[Position](&s.world, e); !ok {
+			return fmt.Errorf("particle %d is marked as moved but gone", e)
+		}
+	}
+	return nil
+}
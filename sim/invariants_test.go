@@ -0,0 +1,188 @@
+package sim
+
+import (
+	"image"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/mobile/event/mouse"
+
+	"github.com/jdavasligil/sandbox/input"
+)
+
+// stepChecked runs n ticks of s, failing t at the first broken invariant.
+func stepChecked(t *testing.T, s *Simulation, n int) {
+	t.Helper()
+	for range n {
+		s.Step()
+		if err := s.CheckInvariants(); err != nil {
+			t.Fatalf("tick %d: %v", s.tick, err)
+		}
+	}
+}
+
+// GOLDENTICKS is how long each golden scene runs, as in the golden tests of
+// render.
+const GOLDENTICKS = 600
+
+func TestInvariantsScenes(t *testing.T) {
+	smallWorld(t)
+	stamps, err := LoadStamps("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scenes, _ := filepath.Glob("../render/testdata/golden/*.json")
+	for _, path := range scenes {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			sc, err := LoadScene(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := NewSimulation(stamps)
+			if err := s.ApplyScene(sc); err != nil {
+				t.Fatal(err)
+			}
+			stepChecked(t, s, GOLDENTICKS)
+		})
+	}
+}
+
+// TestInvariantsPresets plays each built-in demo scene for a while in a
+// world of the default size, which they are drawn for.
+func TestInvariantsPresets(t *testing.T) {
+	if len(PresetNames) == 0 {
+		t.Fatal("no presets")
+	}
+	Configure(DefaultConfig())
+	s := NewSimulation(nil)
+	for i, name := range PresetNames {
+		t.Run(name, func(t *testing.T) {
+			s.Handle(Preset(i))
+			if s.world.EntityCount() == 0 && len(s.emitters) == 0 {
+				t.Fatal("preset left the world empty")
+			}
+			stepChecked(t, s, 60)
+		})
+	}
+}
+
+func TestInvariantsGenerators(t *testing.T) {
+	smallWorld(t)
+	for _, name := range keys(Generators) {
+		t.Run(name, func(t *testing.T) {
+			sc, err := Generate(name, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := NewSimulation(nil)
+			if err := s.ApplyScene(sc); err != nil {
+				t.Fatal(err)
+			}
+			if s.world.EntityCount() == 0 {
+				t.Fatal("generated an empty world")
+			}
+			stepChecked(t, s, GOLDENTICKS)
+		})
+	}
+}
+
+func TestInvariantsEdits(t *testing.T) {
+	smallWorld(t)
+	s := NewSimulation(nil)
+	s.Seed(1, 2)
+	s.SpawnDisc(100, 140, 30, Wall, Velocity{})
+
+	drag := func(b mouse.Button, from, to image.Point) {
+		s.Handle(mouse.Event{X: float32(from.X), Y: float32(from.Y), Button: b, Direction: mouse.DirPress})
+		stepChecked(t, s, 1)
+		for i := 1; i <= 20; i++ {
+			p := from.Add(to.Sub(from).Mul(i).Div(20))
+			s.Handle(mouse.Event{X: float32(p.X), Y: float32(p.Y), Button: b})
+			stepChecked(t, s, 1)
+		}
+		s.Handle(mouse.Event{X: float32(to.X), Y: float32(to.Y), Button: b, Direction: mouse.DirRelease})
+		stepChecked(t, s, 1)
+	}
+	for _, m := range []Material{Sand, Water} {
+		s.Handle(m)
+		drag(mouse.ButtonLeft, image.Point{20, 20}, image.Point{180, 30})
+	}
+	stepChecked(t, s, 200)
+	drag(mouse.ButtonRight, image.Point{60, 100}, image.Point{140, 110})
+	stepChecked(t, s, 50)
+
+	s.Handle(input.ActionUndo)
+	stepChecked(t, s, 50)
+	s.Handle(input.ActionRedo)
+	stepChecked(t, s, 1)
+	s.Handle(input.ActionUndo)
+	s.Handle(input.ActionUndo)
+	stepChecked(t, s, 1)
+
+	// Painting while paused stacks up new particles before any move.
+	s.Handle(input.ActionPause)
+	s.Handle(Sand)
+	drag(mouse.ButtonLeft, image.Point{30, 40}, image.Point{170, 40})
+	s.Handle(input.ActionPause)
+	stepChecked(t, s, 300)
+
+	s.Handle(ToolRect)
+	drag(mouse.ButtonLeft, image.Point{10, 10}, image.Point{40, 30})
+	s.Handle(ToolSelect)
+	drag(mouse.ButtonLeft, image.Point{0, 60}, image.Point{199, 149})
+	s.Handle(input.ActionCut)
+	stepChecked(t, s, 1)
+	s.Handle(mouse.Event{X: 100, Y: 40})
+	s.Handle(input.ActionPaste)
+	stepChecked(t, s, 300)
+	s.Handle(input.ActionClear)
+	stepChecked(t, s, 1)
+}
+
+func TestBoundary(t *testing.T) {
+	smallWorld(t)
+	s := NewSimulation(nil)
+	s.Seed(1, 2)
+	press := func(b mouse.Button, x, y float32) {
+		s.Handle(mouse.Event{X: x, Y: y, Button: b, Direction: mouse.DirPress})
+		stepChecked(t, s, 1)
+		s.Handle(mouse.Event{X: x, Y: y, Button: b, Direction: mouse.DirRelease})
+		stepChecked(t, s, 1)
+	}
+	s.Handle(ToolBoundary)
+	press(mouse.ButtonLeft, 100, 120)
+	n := s.boundary.Count()
+	if n == 0 {
+		t.Fatal("boundary tool painted nothing")
+	}
+
+	// Nothing but the boundary tool takes it away.
+	s.Handle(Sand)
+	s.Handle(ToolBrush)
+	press(mouse.ButtonRight, 100, 120)
+	s.Handle(input.ActionUndo)
+	s.Delete(s.grid.Bounds())
+	stepChecked(t, s, 1)
+	if got := s.boundary.Count(); got != n {
+		t.Fatalf("%d boundary cells left of %d", got, n)
+	}
+
+	path := filepath.Join(t.TempDir(), "boundary.sav")
+	if err := s.SaveFile(path); err != nil {
+		t.Fatal(err)
+	}
+	s.Clear()
+	if err := s.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	stepChecked(t, s, 1)
+	if got := s.boundary.Count(); got != n {
+		t.Fatalf("%d boundary cells loaded of %d", got, n)
+	}
+
+	s.Handle(ToolBoundary)
+	press(mouse.ButtonRight, 100, 120)
+	if got := s.boundary.Count(); got != 0 {
+		t.Fatalf("%d boundary cells left after erasing", got)
+	}
+}
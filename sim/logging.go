@@ -0,0 +1,73 @@
+package sim
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// logLevel is the least severe level logged, set by -v and -quiet.
+var logLevel = new(slog.LevelVar)
+
+// logOutput is where log records are written, stderr unless held back.
+var logOutput = &swapWriter{w: os.Stderr}
+
+// logHandler writes the records of every logger to logOutput as text.
+var logHandler = slog.NewTextHandler(logOutput, &slog.HandlerOptions{Level: logLevel})
+
+// The loggers of each part of the simulation, tagging their records with
+// its name as sys.
+var (
+	simLog      = Subsystem("sim")
+	autosaveLog = Subsystem("autosave")
+	scriptLog   = Subsystem("script")
+	soundLog    = Subsystem("sound")
+	musicLog    = Subsystem("music")
+)
+
+// Subsystem returns a logger for the part of the program called name,
+// writing through the handler ConfigureLogging sets up.
+func Subsystem(name string) *slog.Logger {
+	return slog.New(logHandler).With("sys", name)
+}
+
+// ConfigureLogging logs debug records too if verbose, or only warnings and
+// errors if quiet, and sends the standard logger through the same handler.
+func ConfigureLogging(verbose, quiet bool) {
+	switch {
+	case verbose:
+		logLevel.Set(slog.LevelDebug)
+	case quiet:
+		logLevel.Set(slog.LevelWarn)
+	}
+	slog.SetDefault(slog.New(logHandler))
+}
+
+// SetLogOutput sends log records to w from now on and returns where they
+// went before.
+func SetLogOutput(w io.Writer) io.Writer {
+	logOutput.mu.Lock()
+	defer logOutput.mu.Unlock()
+	old := logOutput.w
+	logOutput.w = w
+	return old
+}
+
+// swapWriter writes to a writer that can be changed while in use.
+type swapWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *swapWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+// fatal logs msg and its attributes as an error to l and exits.
+func fatal(l *slog.Logger, msg string, args ...any) {
+	l.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,228 @@
+package sim
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/jdavasligil/go-ecs"
+
+	"github.com/jdavasligil/sandbox/grid"
+	"github.com/jdavasligil/sandbox/input"
+)
+
+// Material is the substance a cell or particle is made of. It doubles as the
+// component tagging each particle entity with its material.
+type Material uint8
+
+const (
+	Empty Material = iota
+	Sand
+	Water
+	Wall
+)
+
+// Materials lists the selectable materials. Selecting Empty erases.
+var Materials = []Material{Empty, Sand, Water, Wall}
+
+// Element describes how a material is named, drawn and simulated.
+type Element struct {
+	Name    string
+	Color   color.RGBA  // drawn in every palette; built-in materials take theirs from the palette
+	Static  bool        // placed straight into the grids, like walls
+	Flows   bool        // spreads sideways as it settles, like water
+	Hidden  bool        // placed by the simulation alone, so never selectable
+	Blows   image.Point // direction a static fan pushes particles, if any
+	Conveys int         // -1 or 1 for a conveyor sliding what rests on it left or right
+	Logic   Logic       // what a gate computes, if it is one
+
+	// Update, if set, runs once a tick after physics, under the name of
+	// the element.
+	Update System
+}
+
+// Elements describes each material, indexed by Material.
+var Elements = []Element{
+	Empty: {Name: "erase"},
+	Sand:  {Name: "sand"},
+	Water: {Name: "water", Flows: true},
+	Wall:  {Name: "wall", Static: true},
+}
+
+// The built-in elements defined in files of their own, registered in a
+// fixed order whatever the files are called. Add new ones at the end. The
+// built-in materials and the tools are bound first, so no element can be
+// named like them.
+func init() {
+	input.DefaultKeys = append(input.DefaultKeys,
+		input.Binding{Command: Empty, Chords: []string{"0"}},
+		input.Binding{Command: Sand, Chords: []string{"1"}},
+		input.Binding{Command: Water, Chords: []string{"2"}},
+		input.Binding{Command: Wall, Chords: []string{"3"}},
+		input.Binding{Command: ToolBrush, Chords: []string{"b"}},
+		input.Binding{Command: ToolLine, Chords: []string{"l"}},
+		input.Binding{Command: ToolRect, Chords: []string{"r"}},
+		input.Binding{Command: ToolEllipse, Chords: []string{"e"}},
+		input.Binding{Command: ToolFill, Chords: []string{"f"}},
+		input.Binding{Command: ToolPick, Chords: nil},
+		input.Binding{Command: ToolSelect, Chords: []string{"g"}},
+		input.Binding{Command: ToolBoundary, Chords: []string{"w"}},
+	)
+	registerDrain()
+	registerPlatform()
+	registerFans()
+	registerConveyors()
+	registerSensors()
+	registerCircuits()
+	registerTerrain()
+}
+
+// RegisterElement adds e as a new material, selectable unless it is Hidden,
+// and returns it. A selectable element is also a command, unbound by
+// default, that key bindings name by the element's name. Call it before any
+// simulation starts or keymap loads, such as from an init function.
+// Materials are numbered in the order they are registered, which saves and
+// replays rely on.
+func RegisterElement(e Element) Material {
+	if len(Elements) > math.MaxUint8 {
+		panic("too many elements")
+	}
+	for _, other := range Elements {
+		if other.Name == e.Name {
+			panic("element " + e.Name + " registered twice")
+		}
+	}
+	if input.IsCommand(e.Name) {
+		panic("element " + e.Name + " is named like a command")
+	}
+	m := Material(len(Elements))
+	Elements = append(Elements, e)
+	if !e.Hidden {
+		Materials = append(Materials, m)
+		input.DefaultKeys = append(input.DefaultKeys, input.Binding{Command: m, Chords: nil})
+	}
+	return m
+}
+
+// Step returns the selectable material n places after m in Materials,
+// wrapping around, or before it if n is negative.
+func (m Material) Step(n int) Material {
+	i := max(slices.Index(Materials, m), 0)
+	return Materials[((i+n)%len(Materials)+len(Materials))%len(Materials)]
+}
+
+func (m Material) ID() ecs.ComponentID {
+	return MaterialID
+}
+
+func (m Material) String() string {
+	if int(m) < len(Elements) {
+		return Elements[m].Name
+	}
+	return "unknown"
+}
+
+// ParseMaterial returns the material named s by String.
+func ParseMaterial(s string) (Material, error) {
+	for _, m := range Materials {
+		if m.String() == s {
+			return m, nil
+		}
+	}
+	return Empty, fmt.Errorf("unknown material %q", s)
+}
+
+// IsStatic reports whether the material is placed straight into the grids
+// instead of being simulated as particles.
+func (m Material) IsStatic() bool {
+	return Elements[m].Static
+}
+
+// Flows reports whether the material spreads sideways as it settles.
+func (m Material) Flows() bool {
+	return Elements[m].Flows
+}
+
+// MaterialGrid records the material drawn in each cell.
+type MaterialGrid struct {
+	data []Material
+
+	// dirty marks the tiles changed since the last call to TakeDirty.
+	// Physics bands write disjoint columns of it.
+	dirty []bool
+}
+
+func NewMaterialGrid() MaterialGrid {
+	return MaterialGrid{
+		data:  make([]Material, grid.WIDTH*grid.HEIGHT),
+		dirty: make([]bool, grid.TilesAcross()*grid.TilesDown()),
+	}
+}
+
+func (g *MaterialGrid) At(x, y int) Material {
+	return g.data[x+grid.WIDTH*y]
+}
+
+func (g *MaterialGrid) IsSet(x, y int) bool {
+	return g.data[x+grid.WIDTH*y] != Empty
+}
+
+func (g *MaterialGrid) Set(x, y int, m Material) {
+	g.data[x+grid.WIDTH*y] = m
+	g.markDirty(x, y)
+}
+
+func (g *MaterialGrid) Clear(x, y int) {
+	g.data[x+grid.WIDTH*y] = Empty
+	g.markDirty(x, y)
+}
+
+func (g *MaterialGrid) Reset() {
+	clear(g.data)
+	for i := range g.dirty {
+		g.dirty[i] = true
+	}
+}
+
+// Cells returns the material of every cell in row major order. Change them
+// through Set and Clear, which keep track of the tiles changed.
+func (g *MaterialGrid) Cells() []Material {
+	return g.data
+}
+
+func (g *MaterialGrid) Bounds() image.Rectangle {
+	return image.Rect(0, 0, grid.WIDTH, grid.HEIGHT)
+}
+
+func (g *MaterialGrid) markDirty(x, y int) {
+	g.dirty[grid.TileOf(x, y)] = true
+}
+
+// TakeDirty returns the tiles changed since the previous call, written
+// over dst.
+func (g *MaterialGrid) TakeDirty(dst grid.Tiles) grid.Tiles {
+	t := grid.TilesIn(g.dirty, dst)
+	clear(g.dirty)
+	return t
+}
+
+// CopyRect copies the cells of src within r into g.
+func (g *MaterialGrid) CopyRect(src *MaterialGrid, r image.Rectangle) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		i := r.Min.X + grid.WIDTH*y
+		j := r.Max.X + grid.WIDTH*y
+		copy(g.data[i:j], src.data[i:j])
+	}
+}
+
+// ParseHex parses a color written as "#rrggbb".
+func ParseHex(s string) (color.RGBA, error) {
+	c := color.RGBA{A: 0xff}
+	if _, err := fmt.Sscanf(strings.TrimPrefix(s, "#"), "%02x%02x%02x", &c.R, &c.G, &c.B); err != nil {
+		return c, fmt.Errorf("bad color %q", s)
+	}
+	return c, nil
+}
@@ -0,0 +1,36 @@
+package sim
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdavasligil/sandbox/input"
+)
+
+// TestLoadKeymapElements binds registered elements by name. Hidden ones are
+// not commands.
+func TestLoadKeymapElements(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, []byte(`{"drain": ["d"], "stone": ["shift+d"], "sand": ["x"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	km, err := input.LoadKeymap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for s, want := range map[string]Material{"d": Drain, "shift+d": Stone, "x": Sand} {
+		c, _ := input.ParseChord(s)
+		if got := km[c]; got != want {
+			t.Errorf("%s is bound to %v, want %v", s, got, want)
+		}
+	}
+	for _, m := range Materials {
+		if !input.IsCommand(m.String()) {
+			t.Errorf("selectable %v is not a command", m)
+		}
+	}
+	if input.IsCommand(PlatformCell.String()) {
+		t.Error("hidden platform cells are a command")
+	}
+}
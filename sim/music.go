@@ -0,0 +1,165 @@
+package sim
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// MUSICEXTS are the extensions of the tracks played from the music
+// directory.
+var MUSICEXTS = []string{".ogg", ".mp3"}
+
+// Music loops through a list of tracks, decoding each with ffmpeg on its
+// own goroutine into blocks of samples the mixer plays under its sounds.
+// The mixer never waits for it: a block not decoded in time is silence.
+type Music struct {
+	ffmpeg string
+	tracks []string
+
+	blocks chan []float64
+	skip   chan struct{}
+	volume atomic.Int32 // percent
+}
+
+// FindMusic lists the tracks in dir in name order. A missing directory
+// holds none.
+func FindMusic(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var tracks []string
+	for _, e := range entries {
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		for _, want := range MUSICEXTS {
+			if !e.IsDir() && ext == want {
+				tracks = append(tracks, filepath.Join(dir, e.Name()))
+			}
+		}
+	}
+	sort.Strings(tracks)
+	return tracks, nil
+}
+
+// StartMusic starts decoding tracks with the ffmpeg binary, at volume
+// percent.
+func StartMusic(ffmpeg string, tracks []string, volume int) *Music {
+	mu := &Music{
+		ffmpeg: ffmpeg,
+		tracks: tracks,
+		blocks: make(chan []float64, SOUNDAHEAD),
+		skip:   make(chan struct{}, 1),
+	}
+	mu.volume.Store(int32(max(min(volume, 100), 0)))
+	go mu.run()
+	return mu
+}
+
+func (mu *Music) run() {
+	for i, failed := 0, 0; failed < len(mu.tracks); i = (i + 1) % len(mu.tracks) {
+		if err := mu.play(mu.tracks[i]); err != nil {
+			musicLog.Warn("track failed", "track", mu.tracks[i], "err", err)
+			failed++
+			continue
+		}
+		failed = 0
+	}
+	musicLog.Error("no track would play")
+}
+
+// play decodes track into blocks until it ends or is skipped.
+func (mu *Music) play(track string) error {
+	cmd := exec.Command(mu.ffmpeg,
+		"-loglevel", "error",
+		"-i", track,
+		"-f", "s16le", "-ac", "1", "-ar", fmt.Sprint(SOUNDRATE),
+		"-",
+	)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	raw := make([]byte, 2*SOUNDRATE/SOUNDBLOCKS)
+	played := false
+	for {
+		n, err := io.ReadFull(stdout, raw)
+		if n > 0 {
+			if !played {
+				musicLog.Info("playing", "track", filepath.Base(track))
+			}
+			played = true
+			block := make([]float64, len(raw)/2)
+			for j := range n / 2 {
+				block[j] = float64(int16(binary.LittleEndian.Uint16(raw[2*j:]))) / (1 << 15)
+			}
+			select {
+			case mu.blocks <- block:
+			case <-mu.skip:
+				cmd.Process.Kill()
+				cmd.Wait()
+				return nil
+			}
+		}
+		if err != nil {
+			werr := cmd.Wait()
+			if played {
+				return nil
+			}
+			if werr == nil {
+				werr = errors.New("no sound in it")
+			}
+			return werr
+		}
+	}
+}
+
+// next returns the next block of music at its volume, or nil if none is
+// ready.
+func (mu *Music) next() ([]float64, float64) {
+	if mu == nil {
+		return nil, 0
+	}
+	select {
+	case b := <-mu.blocks:
+		return b, float64(mu.volume.Load()) / 100
+	default:
+		return nil, 0
+	}
+}
+
+// Skip moves on to the next track.
+func (mu *Music) Skip() {
+	if mu == nil {
+		return
+	}
+	select {
+	case mu.skip <- struct{}{}:
+	default:
+	}
+}
+
+// Louder changes the music volume by steps of VOLUMESTEP, lowering it if
+// steps is negative.
+func (mu *Music) Louder(steps int) {
+	if mu == nil {
+		return
+	}
+	v := max(min(int(mu.volume.Load())+steps*VOLUMESTEP, 100), 0)
+	mu.volume.Store(int32(v))
+	musicLog.Info("volume", "percent", v)
+}
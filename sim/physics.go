@@ -0,0 +1,518 @@
+package sim
+
+import (
+	"runtime"
+	"slices"
+	"sync"
+
+	"github.com/jdavasligil/go-ecs"
+
+	"github.com/jdavasligil/sandbox/grid"
+)
+
+const (
+	PARALLELMIN = 4096 // falling particles needed to split physics into bands
+
+	// BAND is the width of a band of the parallel physics pass. It is a
+	// multiple of 64 and of TILE so that bands never share a word of a Grid
+	// or a dirty tile.
+	BAND = CHUNK
+)
+
+// Band is the strip of columns [lo, hi) of the collision grid a particle
+// may look at while it moves. Looking outside it marks the move escaped,
+// and the cell reads as full so the search stays inside.
+type Band struct {
+	col     *grid.Grid
+	lo, hi  int
+	escaped bool
+}
+
+func (b *Band) IsSet(x, y int) bool {
+	if x < b.lo || x >= b.hi {
+		b.escaped = true
+		return true
+	}
+	return b.col.IsSet(x, y)
+}
+
+func (b *Band) AnySet(x0, x1, y int) bool {
+	if x0 < b.lo || x1 > b.hi {
+		b.escaped = true
+		return true
+	}
+	return b.col.AnySet(x0, x1, y)
+}
+
+// Flow spreads water resting at (x, y) sideways. It looks up to WATERFLOW
+// cells along the row for the nearest spot it can drop into, repeating until
+// the water can fall no further.
+func Flow(col *Band, x, y int) (int, int) {
+	for y+1 < grid.HEIGHT {
+		nx := -1
+		for d := 1; d <= WATERFLOW && nx < 0; d++ {
+			// Alternate the side searched first so pools level out evenly.
+			for _, sx := range [2]int{x - d, x + d} {
+				if (x+y)%2 == 1 {
+					sx = 2*x - sx
+				}
+				if sx < 0 || sx >= grid.WIDTH || col.IsSet(sx, y) {
+					continue
+				}
+				if !col.IsSet(sx, y+1) && reachable(col, x, sx, y) {
+					nx = sx
+					break
+				}
+			}
+		}
+		if nx < 0 {
+			break
+		}
+		x = nx
+		for (y+1) < grid.HEIGHT && !col.IsSet(x, y+1) {
+			y++
+		}
+	}
+	return x, y
+}
+
+// Slide moves a particle that landed at (x, y) down the slope it is on. A
+// particle slides a cell to the side and one down while both are free,
+// and falls straight down wherever it can, until it is Supported.
+func Slide(col *Band, x, y int) (int, int) {
+	for {
+		for (y+1) < grid.HEIGHT && !col.IsSet(x, y+1) {
+			y++
+		}
+		l, r := slides(col, x, y, -1), slides(col, x, y, 1)
+		switch {
+		case l && r:
+			// Alternate the side taken so piles grow evenly.
+			if (x+y)%2 == 0 {
+				x--
+			} else {
+				x++
+			}
+		case l:
+			x--
+		case r:
+			x++
+		default:
+			return x, y
+		}
+		y++
+	}
+}
+
+// Supported reports whether a particle at (x, y) can rest there: it is on
+// the bottom row, or the cell below is full and it cannot slide to either
+// side.
+func Supported(col *Band, x, y int) bool {
+	if y+1 >= grid.HEIGHT {
+		return true
+	}
+	return col.IsSet(x, y+1) && !slides(col, x, y, -1) && !slides(col, x, y, 1)
+}
+
+// slides reports whether a particle at (x, y) can slide to the side dx,
+// which takes the cell beside it and the one below that.
+func slides(col *Band, x, y, dx int) bool {
+	x += dx
+	return x >= 0 && x < grid.WIDTH && y+1 < grid.HEIGHT && !col.IsSet(x, y) && !col.IsSet(x, y+1)
+}
+
+// reachable reports whether every cell of row y between x0 and x1 is free.
+func reachable(col *Band, x0, x1, y int) bool {
+	return !col.AnySet(min(x0, x1)+1, max(x0, x1), y)
+}
+
+// Integrate applies gravity to the velocities vx, vy and moves the
+// positions x, y along them for one tick, ignoring collisions. The slices
+// must be the same length.
+func Integrate(x, y, vx, vy []float32) {
+	y, vx, vy = y[:len(x)], vx[:len(x)], vy[:len(x)]
+	for i := range x {
+		// GRAVITY
+		vy[i] = min(vy[i]+DELTA*GRAVITY, MAXVEL)
+
+		// MOTION
+		x[i] += DELTA * vx[i]
+		y[i] += DELTA * vy[i]
+	}
+}
+
+// Collide works out where a falling particle of material m that Integrate
+// moved to next with velocity v ends up, and whether it has come to rest
+// there. It only reads the collision grid.
+func Collide(col *Band, next Position, v Velocity, m Material) (Position, Velocity, bool) {
+	width, height := float32(grid.WIDTH), float32(grid.HEIGHT)
+	pNextX, pNextY := next.X, next.Y
+
+	// COLLISION
+	colSet := false
+	if pNextX < 0 {
+		v.X = -v.X
+		pNextX = 0
+	} else if pNextX >= width {
+		v.X = -v.X
+		pNextX = width - 1
+	}
+	if pNextY < 0 {
+		v.Y = -v.Y
+		pNextY = 0
+	} else if pNextY >= height {
+		v.X = 0
+		v.Y = 0
+		pNextY = height - 1
+		for pNextY > 0 && col.IsSet(int(pNextX), int(pNextY)) {
+			pNextY -= 1
+		}
+		colSet = !col.IsSet(int(pNextX), int(pNextY))
+	} else if col.IsSet(int(pNextX), int(pNextY)) {
+		x := int(pNextX)
+		y := int(pNextY)
+		for {
+			l := max(x-1, 0)
+			r := min(x+1, grid.WIDTH-1)
+			setL := col.IsSet(l, y)
+			setR := col.IsSet(r, y)
+			if setL && setR {
+				y = max(y-1, 0)
+				if y == 0 {
+					break
+				}
+			} else if !(setL || setR) {
+				if l%2 == 0 {
+					x = l
+				} else {
+					x = r
+				}
+			} else if setL {
+				x = r
+			} else {
+				x = l
+			}
+			if !col.IsSet(x, y) {
+				for (y+1) < grid.HEIGHT && !col.IsSet(x, y+1) {
+					y++
+				}
+				break
+			}
+		}
+		for (y+1) < grid.HEIGHT && !col.IsSet(x, y+1) {
+			y++
+		}
+
+		pNextX = float32(x)
+		pNextY = float32(y)
+		colSet = true
+		if col.IsSet(x, y) {
+			// The column is full to the top. Resting here would stack
+			// two particles in one cell, so keep falling until there is
+			// room.
+			v = Velocity{}
+			colSet = false
+		}
+	}
+
+	if colSet {
+		x, y := Slide(col, int(pNextX), int(pNextY))
+		if m.Flows() {
+			x, y = Flow(col, x, y)
+		}
+		pNextX = float32(x)
+		pNextY = float32(y)
+	}
+	return Position{pNextX, pNextY}, v, colSet
+}
+
+// place moves a particle from p to next and records it in the grids,
+// resting in col if it settled.
+func place(grid *MaterialGrid, col *grid.Grid, field *Field, p *Position, next Position, v *Velocity, m Material, settled bool) {
+	if settled {
+		col.Set(int(next.X), int(next.Y))
+	}
+	// Leave the old cell unless a particle has come to rest in it.
+	if !col.IsSet(int(p.X), int(p.Y)) {
+		grid.Clear(int(p.X), int(p.Y))
+	}
+	field.Set(int(p.X), int(p.Y), Velocity{})
+	*p = next
+	// A particle stuck on a full column falls behind what rests there.
+	if settled || !col.IsSet(int(p.X), int(p.Y)) {
+		grid.Set(int(p.X), int(p.Y), m)
+	}
+	if !settled {
+		field.Set(int(p.X), int(p.Y), *v)
+	}
+}
+
+// ApplyPhysics moves every falling particle one tick. Their components are
+// gathered into arrays and integrated in one pass before collisions are
+// resolved. With enough of them the world is split into bands of BAND
+// columns. Even bands then odd bands run in parallel; a band only touches
+// its own columns, so the result does not depend on scheduling. Particles
+// that would cross out of their band are moved afterwards, one at a time.
+func (s *Simulation) ApplyPhysics() {
+	sc := &s.scratch
+	pt := &sc.particles
+	pt.Gather(&s.world)
+	Integrate(pt.x, pt.y, pt.vx, pt.vy)
+	sc.moves = sc.moves[:0]
+	if len(pt.ents) < PARALLELMIN {
+		for i := range pt.ents {
+			s.fall(i, &Band{col: &s.col, lo: 0, hi: grid.WIDTH}, &sc.moves)
+		}
+	} else {
+		s.applyBands()
+	}
+	s.markMoves(sc.moves)
+}
+
+// markMoves marks the particles of the tick at moves as moved.
+func (s *Simulation) markMoves(moves []int) {
+	pt := &s.scratch.particles
+	for _, i := range moves {
+		s.moved.Mark(pt.ents[i], pt.from[i])
+	}
+}
+
+// applyBands moves the gathered particles band by band.
+func (s *Simulation) applyBands() {
+	sc := &s.scratch
+	pt := &sc.particles
+	n := (grid.WIDTH + BAND - 1) / BAND
+	if len(sc.bands) != n {
+		sc.bands = make([][]int, n)
+		sc.settled = make([][]int, n)
+		sc.escaped = make([][]int, n)
+		sc.moved = make([][]int, n)
+		for i := range n {
+			sc.phases[i%2] = append(sc.phases[i%2], i)
+		}
+		sc.band = s.band
+	}
+	for i := range n {
+		sc.bands[i] = sc.bands[i][:0]
+		sc.settled[i] = sc.settled[i][:0]
+		sc.escaped[i] = sc.escaped[i][:0]
+		sc.moved[i] = sc.moved[i][:0]
+	}
+	for j, p := range pt.pos {
+		i := min(max(int(p.X), 0), grid.WIDTH-1) / BAND
+		sc.bands[i] = append(sc.bands[i], j)
+	}
+	if s.pool == nil {
+		s.pool = NewPool(runtime.GOMAXPROCS(0))
+	}
+	for _, phase := range sc.phases {
+		s.pool.Run(sc.band, phase)
+	}
+	// Bands run at once, so each keeps its own list of moves to mark.
+	for i, settled := range sc.settled {
+		for _, j := range settled {
+			s.rest(j)
+		}
+		s.markMoves(sc.moved[i])
+	}
+	for _, escaped := range sc.escaped {
+		for _, j := range escaped {
+			s.fall(j, &Band{col: &s.col, lo: 0, hi: grid.WIDTH}, &sc.moves)
+		}
+	}
+}
+
+// physicsScratch holds the buffers of ApplyPhysics from one tick to the
+// next.
+type physicsScratch struct {
+	particles Particles
+
+	bands   [][]int     // indices into particles by band
+	settled [][]int     // ...that came to rest
+	escaped [][]int     // ...that must move one at a time
+	moved   [][]int     // ...that changed position
+	moves   []int       // particles moved one at a time that changed position
+	phases  [2][]int    // the even and the odd bands
+	band    func(i int) // Simulation.band, bound once
+}
+
+// Particles holds the falling particles of a tick side by side in arrays.
+// x, y, vx and vy start as copies of their components and are integrated in
+// place; pos and vel point at the components to write the results back.
+type Particles struct {
+	falling   Join3[Falling, Position, Velocity]
+	materials Index[Material]
+
+	ents   []ecs.Entity
+	m      []Material
+	pos    []*Position
+	vel    []*Velocity
+	from   []Position // where each one started the tick
+	x, y   []float32
+	vx, vy []float32
+}
+
+// Gather loads the falling particles of w and their components. The
+// pointers stay valid as long as no Position or Velocity is added or
+// removed.
+func (pt *Particles) Gather(w *ecs.World) {
+	// Settling only queues Falling to be removed, so the store the query
+	// walked is left as it was until the system returns.
+	q := &pt.falling
+	q.Run(w)
+	pt.materials.Sync(w)
+	pt.ents, pt.pos, pt.vel = q.Ents, q.B, q.C
+	n := q.Len()
+	pt.m = resize(pt.m, n)
+	pt.from = resize(pt.from, n)
+	pt.x, pt.y, pt.vx, pt.vy = resize(pt.x, n), resize(pt.y, n), resize(pt.vx, n), resize(pt.vy, n)
+	for i, e := range pt.ents {
+		p, v := pt.pos[i], pt.vel[i]
+		pt.m[i] = Empty
+		if m := pt.materials.Get(e); m != nil {
+			pt.m[i] = *m
+		}
+		pt.from[i] = *p
+		pt.x[i], pt.y[i] = p.X, p.Y
+		pt.vx[i], pt.vy[i] = v.X, v.Y
+	}
+}
+
+// Moves writes over dst the particles marked as moved that changed cell
+// during the tick.
+func (s *Simulation) Moves(dst []Motion) []Motion {
+	dst = dst[:0]
+	was := s.moved.Was()
+	for i, e := range s.moved.Ents() {
+		from := was[i]
+		p, _ := ecs.Get[Position](&s.world, e)
+		if int(from.X) != int(p.X) || int(from.Y) != int(p.Y) {
+			m, _ := ecs.Get[Material](&s.world, e)
+			dst = append(dst, Motion{From: from, To: p, M: m})
+		}
+	}
+	return dst
+}
+
+// Motion is the move of a particle of material M over one tick.
+type Motion struct {
+	From, To Position
+	M        Material
+}
+
+// resize returns s with length n, reusing its storage when there is room.
+func resize[T any](s []T, n int) []T {
+	return slices.Grow(s[:0], n)[:n]
+}
+
+// band moves the falling particles of band i that stay within it.
+func (s *Simulation) band(i int) {
+	sc := &s.scratch
+	for _, j := range sc.bands[i] {
+		b := Band{col: &s.col, lo: i * BAND, hi: min((i+1)*BAND, grid.WIDTH)}
+		switch s.move(j, &b, &sc.moved[i]) {
+		case moveEscaped:
+			sc.escaped[i] = append(sc.escaped[i], j)
+		case moveSettled:
+			sc.settled[i] = append(sc.settled[i], j)
+		}
+	}
+}
+
+type moveResult uint8
+
+const (
+	moveFalling moveResult = iota
+	moveSettled
+	moveEscaped
+)
+
+// move moves falling particle i of the tick unless it would leave band b,
+// adding i to moves if its position changed.
+func (s *Simulation) move(i int, b *Band, moves *[]int) moveResult {
+	pt := &s.scratch.particles
+	p, v, m := pt.pos[i], pt.vel[i], pt.m[i]
+	next, nv, settled := Collide(b, Position{pt.x[i], pt.y[i]}, Velocity{pt.vx[i], pt.vy[i]}, m)
+	if x := int(next.X); b.escaped || x < b.lo || x >= b.hi {
+		return moveEscaped
+	}
+	*v = nv
+	e := pt.ents[i]
+	s.hash.Move(e, int(p.X), int(p.Y), int(next.X), int(next.Y))
+	if next != *p {
+		*moves = append(*moves, i)
+	}
+	place(&s.grid, &s.col, &s.field, p, next, v, m, settled)
+	if settled {
+		return moveSettled
+	}
+	return moveFalling
+}
+
+// fall moves falling particle i of the tick and files it as resting if it
+// settles.
+func (s *Simulation) fall(i int, b *Band, moves *[]int) {
+	if s.move(i, b, moves) == moveSettled {
+		s.rest(i)
+	}
+}
+
+// rest files settled particle i of the tick with its chunk and stops it
+// falling.
+func (s *Simulation) rest(i int) {
+	pt := &s.scratch.particles
+	e, p := pt.ents[i], pt.pos[i]
+	s.chunks.Rest(e, int(p.X), int(p.Y))
+	s.commands.Rest(e)
+	s.bus.Publish(Event{EventSettled, e, int(p.X), int(p.Y), pt.m[i]})
+}
+
+// Pool runs batches of jobs on a fixed set of goroutines. A pool of one
+// runs them in order on the caller instead, as handing them over would gain
+// nothing and costs a lot where goroutines share a thread, as in a browser.
+type Pool struct {
+	jobs chan int
+	run  func(job int) // set for the batch in progress
+	wg   sync.WaitGroup
+	solo bool
+}
+
+func NewPool(workers int) *Pool {
+	p := &Pool{jobs: make(chan int), solo: workers <= 1}
+	if p.solo {
+		return p
+	}
+	for range workers {
+		go func() {
+			for job := range p.jobs {
+				p.run(job)
+				p.wg.Done()
+			}
+		}()
+	}
+	return p
+}
+
+// Close stops the goroutines of the pool. It must not be run afterwards.
+func (p *Pool) Close() {
+	if !p.solo {
+		close(p.jobs)
+	}
+}
+
+// Run calls run for each of jobs across the pool and waits for all of them
+// to finish.
+func (p *Pool) Run(run func(job int), jobs []int) {
+	if p.solo {
+		for _, job := range jobs {
+			run(job)
+		}
+		return
+	}
+	p.run = run
+	p.wg.Add(len(jobs))
+	for _, job := range jobs {
+		p.jobs <- job
+	}
+	p.wg.Wait()
+}
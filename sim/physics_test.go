@@ -0,0 +1,128 @@
+package sim
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/jdavasligil/go-ecs"
+
+	"github.com/jdavasligil/sandbox/grid"
+)
+
+// REBUILD is how many ticks a benchmark world runs before it is rebuilt, so
+// the particles being measured have not yet come to rest.
+const REBUILD = 16
+
+// benchWorld returns a seeded simulation with whatever fill adds, topped up
+// to n particles by falling sand spread over the top of the world.
+func benchWorld(n int, fill func(s *Simulation)) *Simulation {
+	SetRates(64, 60)
+	s := NewSimulation(nil)
+	s.Seed(1, 2)
+	if fill != nil {
+		fill(s)
+	}
+	for i := 0; s.world.EntityCount() < n && i < grid.WIDTH*grid.HEIGHT; i++ {
+		x, y := (i*7919)%grid.WIDTH, (i/grid.WIDTH)%(grid.HEIGHT/4)
+		s.SpawnCell(x, y, Sand, Velocity{})
+	}
+	return s
+}
+
+// settle adds a pile of resting sand covering the bottom rows of the world.
+func settle(rows int) func(s *Simulation) {
+	return func(s *Simulation) {
+		for y := grid.HEIGHT - rows; y < grid.HEIGHT; y++ {
+			for x := 0; x < grid.WIDTH; x++ {
+				e := s.world.NewEntity()
+				ecs.Add(&s.world, e, Position{float32(x), float32(y)})
+				ecs.Add(&s.world, e, Velocity{})
+				ecs.Add(&s.world, e, Sand)
+				s.grid.Set(x, y, Sand)
+				s.col.Set(x, y)
+				s.hash.Insert(e, x, y)
+				s.chunks.Rest(e, x, y)
+			}
+		}
+	}
+}
+
+func benchPhysics(b *testing.B, n int, fill func(s *Simulation)) {
+	var s *Simulation
+	for i := 0; i < b.N; i++ {
+		if i%REBUILD == 0 {
+			b.StopTimer()
+			s = benchWorld(n, fill)
+			b.StartTimer()
+		}
+		s.ApplyPhysics()
+		s.commands.Flush(s)
+	}
+}
+
+func BenchmarkApplyPhysics(b *testing.B) {
+	for _, n := range []int{1000, 10000, 50000} {
+		b.Run(fmt.Sprintf("falling=%d", n), func(b *testing.B) {
+			benchPhysics(b, n, nil)
+		})
+	}
+}
+
+func BenchmarkApplyPhysicsDeepPile(b *testing.B) {
+	deep := settle(grid.HEIGHT / 2)
+	for _, n := range []int{1000, 10000} {
+		b.Run(fmt.Sprintf("falling=%d", n), func(b *testing.B) {
+			benchPhysics(b, n+grid.WIDTH*grid.HEIGHT/2, deep)
+		})
+	}
+}
+
+func BenchmarkApplyPhysicsFullBottomRow(b *testing.B) {
+	row := func(s *Simulation) {
+		for x := 0; x < grid.WIDTH; x++ {
+			s.SpawnCell(x, grid.HEIGHT-1, Wall, Velocity{})
+		}
+	}
+	benchPhysics(b, 10000, row)
+}
+
+func BenchmarkApplyPhysicsHourglass(b *testing.B) {
+	hourglass := func(s *Simulation) {
+		sc, err := Generate("hourglass", 0)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := s.ApplyScene(sc); err != nil {
+			b.Fatal(err)
+		}
+	}
+	benchPhysics(b, 0, hourglass)
+}
+
+// BenchmarkGather gathers 10000 falling particles from over a pile of
+// resting ones.
+func BenchmarkGather(b *testing.B) {
+	s := benchWorld(grid.WIDTH*grid.HEIGHT/4+10000, settle(grid.HEIGHT/4))
+	var pt Particles
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pt.Gather(&s.world)
+	}
+}
+
+// BenchmarkGatherDraining gathers as BenchmarkGather does while a particle
+// is removed every tick, as a drain removes them.
+func BenchmarkGatherDraining(b *testing.B) {
+	s := benchWorld(grid.WIDTH*grid.HEIGHT/4+10000, settle(grid.HEIGHT/4))
+	var pt Particles
+	pt.Gather(&s.world)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ents, _ := ecs.Query[Position](&s.world)
+		e := ents[i%len(ents)]
+		if _, falling := ecs.Get[Falling](&s.world, e); !falling {
+			s.RemoveParticle(e)
+		}
+		pt.Gather(&s.world)
+	}
+}
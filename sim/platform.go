@@ -0,0 +1,280 @@
+package sim
+
+import (
+	"image"
+	"image/color"
+	"slices"
+
+	"github.com/jdavasligil/go-ecs"
+)
+
+const PLOWREACH = 8 // cells a platform looks ahead for room to push a particle into
+
+// PlatformCell is the material platforms are drawn in. Only platforms place
+// it, so it cannot be selected.
+var PlatformCell Material
+
+func registerPlatform() {
+	PlatformCell = RegisterElement(Element{
+		Name:   "platform",
+		Color:  color.RGBA{0x8c, 0x6a, 0x3c, 0xff},
+		Static: true,
+		Hidden: true,
+	})
+}
+
+// Platform is a solid rectangle that sweeps back and forth along a path,
+// one cell at a time. It is drawn into the grids like a wall. Particles in
+// its way are pushed ahead of it, or up and over what lies ahead, and those
+// resting on top ride along when it moves sideways. A platform that cannot
+// make room, or would run into a wall, turns back. Erased platform cells
+// come back on the next tick.
+type Platform struct {
+	Rect  image.Rectangle // cells covered at present
+	Path  []image.Point   // waypoints of Rect.Min, swept in order and back
+	Speed float32         // cells a second
+
+	from   image.Point // where the present leg started
+	leg    int         // index of the waypoint headed for
+	dir    int         // +1 or -1 through Path
+	travel float32     // cells owed since the last step
+}
+
+// NewPlatform returns a w by h platform starting at the first waypoint of
+// path.
+func NewPlatform(w, h int, path []image.Point, speed float32) Platform {
+	return Platform{
+		Rect:  image.Rectangle{path[0], path[0].Add(image.Point{w, h})},
+		Path:  path,
+		Speed: speed,
+		from:  path[0],
+		dir:   1,
+	}
+}
+
+// heading returns the unit step the platform takes next along its path,
+// or zero if the path goes nowhere.
+func (p *Platform) heading() image.Point {
+	if len(p.Path) < 2 {
+		return image.Point{}
+	}
+	at := p.Rect.Min
+	if at == p.Path[p.leg] {
+		if next := p.leg + p.dir; next < 0 || next >= len(p.Path) {
+			p.dir = -p.dir
+		}
+		p.from, p.leg = at, p.leg+p.dir
+	}
+	// Step along the axis furthest behind, to stay close to the straight
+	// line of the leg.
+	total, left := p.Path[p.leg].Sub(p.from), p.Path[p.leg].Sub(at)
+	done := func(total, left int) float32 {
+		if left == 0 {
+			return 2
+		}
+		return 1 - float32(left)/float32(total)
+	}
+	if done(total.X, left.X) <= done(total.Y, left.Y) {
+		return image.Point{sign(left.X), 0}
+	}
+	return image.Point{0, sign(left.Y)}
+}
+
+// turn sends the platform back towards the waypoint it last left.
+func (p *Platform) turn() {
+	if len(p.Path) < 2 {
+		return
+	}
+	p.dir = -p.dir
+	p.from, p.leg = p.Rect.Min, p.leg+p.dir
+	p.travel = 0
+}
+
+func sign(x int) int {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	}
+	return 0
+}
+
+// MovePlatforms moves each platform as far along its path as its speed
+// takes it this tick.
+func (s *Simulation) MovePlatforms() {
+	for i := range s.platforms {
+		p := &s.platforms[i]
+		s.fill(p.Rect, PlatformCell)
+		p.travel += p.Speed * DELTA
+		for ; p.travel >= 1; p.travel-- {
+			d := p.heading()
+			if d == (image.Point{}) {
+				p.travel = 0
+				break
+			}
+			if !s.shiftPlatform(p, d) {
+				p.turn()
+				break
+			}
+		}
+	}
+}
+
+// fill draws static material m into the cells of r left empty, such as by
+// an eraser.
+func (s *Simulation) fill(r image.Rectangle, m Material) {
+	r = r.Intersect(s.grid.Bounds())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if !s.grid.IsSet(x, y) && len(s.particlesAt(image.Rect(x, y, x+1, y+1))) == 0 {
+				s.grid.Set(x, y, m)
+				s.col.Set(x, y)
+			}
+		}
+	}
+}
+
+// particlesAt returns the particles within r.
+func (s *Simulation) particlesAt(r image.Rectangle) []ecs.Entity {
+	ents := s.hash.Within(r, nil)
+	return slices.DeleteFunc(ents, func(e ecs.Entity) bool {
+		q, _ := ecs.Get[Position](&s.world, e)
+		return !(image.Point{int(q.X), int(q.Y)}).In(r)
+	})
+}
+
+// shiftPlatform moves p one cell by d, pushing the particles in its way,
+// and reports whether there was room to.
+func (s *Simulation) shiftPlatform(p *Platform, d image.Point) bool {
+	next := p.Rect.Add(d)
+	if !next.In(s.grid.Bounds()) {
+		return false
+	}
+	// The row or column of cells the move covers.
+	lead := next
+	switch {
+	case d.X > 0:
+		lead.Min.X = next.Max.X - 1
+	case d.X < 0:
+		lead.Max.X = next.Min.X + 1
+	case d.Y > 0:
+		lead.Min.Y = next.Max.Y - 1
+	case d.Y < 0:
+		lead.Max.Y = next.Min.Y + 1
+	}
+	for y := lead.Min.Y; y < lead.Max.Y; y++ {
+		for x := lead.Min.X; x < lead.Max.X; x++ {
+			if m := s.grid.At(x, y); m.IsStatic() && m != PlatformCell {
+				return false
+			}
+		}
+	}
+
+	// Find room for everything in the way before moving any of it.
+	type push struct {
+		e  ecs.Entity
+		to image.Point
+	}
+	var pushes []push
+	claimed := make(map[image.Point]bool)
+	free := func(q image.Point) bool {
+		return q.In(s.grid.Bounds()) && !q.In(next) && !s.grid.IsSet(q.X, q.Y) && !claimed[q]
+	}
+	for _, e := range s.particlesAt(lead) {
+		q, _ := ecs.Get[Position](&s.world, e)
+		at := image.Point{int(q.X), int(q.Y)}
+		found := false
+		for k := 1; k <= PLOWREACH && !found; k++ {
+			if to := at.Add(d.Mul(k)); free(to) {
+				pushes, found = append(pushes, push{e, to}), true
+			}
+		}
+		// Failing that, onto the top of the column just ahead.
+		for to := at.Add(d).Add(image.Point{0, -1}); !found && d.Y == 0 && to.In(s.grid.Bounds()); to.Y-- {
+			if m := s.grid.At(to.X, to.Y); m.IsStatic() {
+				break
+			}
+			if free(to) {
+				pushes, found = append(pushes, push{e, to}), true
+			}
+		}
+		if !found {
+			return false
+		}
+		claimed[pushes[len(pushes)-1].to] = true
+	}
+	v := Velocity{float32(d.X) * p.Speed, float32(d.Y) * p.Speed}
+	for _, pu := range pushes {
+		s.displace(pu.e, pu.to, v)
+	}
+
+	old := p.Rect
+	for y := old.Min.Y; y < old.Max.Y; y++ {
+		for x := old.Min.X; x < old.Max.X; x++ {
+			if !(image.Point{x, y}).In(next) && s.grid.At(x, y) == PlatformCell {
+				s.grid.Clear(x, y)
+				s.col.Clear(x, y)
+				s.chunks.Wake(x, y)
+			}
+		}
+	}
+	for y := lead.Min.Y; y < lead.Max.Y; y++ {
+		for x := lead.Min.X; x < lead.Max.X; x++ {
+			if !s.grid.IsSet(x, y) {
+				s.grid.Set(x, y, PlatformCell)
+				s.col.Set(x, y)
+			}
+		}
+	}
+	p.Rect = next
+
+	// Carry what rests on top, leading side first so each finds the cell
+	// ahead already vacated.
+	if top := old.Min.Y - 1; d.X != 0 && top >= 0 {
+		riders := s.particlesAt(image.Rect(old.Min.X, top, old.Max.X, top+1))
+		slices.SortFunc(riders, func(a, b ecs.Entity) int {
+			pa, _ := ecs.Get[Position](&s.world, a)
+			pb, _ := ecs.Get[Position](&s.world, b)
+			return d.X * (int(pb.X) - int(pa.X))
+		})
+		for _, e := range riders {
+			if _, falling := ecs.Get[Falling](&s.world, e); falling {
+				continue
+			}
+			q, _ := ecs.Get[Position](&s.world, e)
+			if to := (image.Point{int(q.X) + d.X, top}); to.In(s.grid.Bounds()) && !s.grid.IsSet(to.X, to.Y) {
+				s.displace(e, to, v)
+			}
+		}
+	}
+	return true
+}
+
+// displace moves particle e to the empty cell to and sets it falling at v,
+// so that it settles again wherever it lands.
+func (s *Simulation) displace(e ecs.Entity, to image.Point, v Velocity) {
+	pos, _ := ecs.GetMut[Position](&s.world, e)
+	vel, _ := ecs.GetMut[Velocity](&s.world, e)
+	m, _ := ecs.Get[Material](&s.world, e)
+	x, y := int(pos.X), int(pos.Y)
+	_, falling := ecs.Get[Falling](&s.world, e)
+	// A falling particle may pass over a cell something else rests in.
+	if s.grid.At(x, y) == m && (!falling || !s.col.IsSet(x, y)) {
+		s.grid.Clear(x, y)
+	}
+	if !falling {
+		s.col.Clear(x, y)
+		s.chunks.Wake(x, y)
+		ecs.Add(&s.world, e, Falling{})
+		if s.bus.Wants(EventWoken) {
+			s.bus.Publish(Event{EventWoken, e, x, y, m})
+		}
+	}
+	s.field.Set(x, y, Velocity{})
+	s.hash.Move(e, x, y, to.X, to.Y)
+	s.moved.Mark(e, *pos)
+	*pos = Position{float32(to.X), float32(to.Y)}
+	*vel = v
+	s.grid.Set(to.X, to.Y, m)
+}
@@ -0,0 +1,129 @@
+package sim
+
+import (
+	"image"
+
+	"golang.org/x/mobile/event/mouse"
+)
+
+// Presence is the cursor of one player.
+type Presence struct {
+	ID       int      `json:"id"`
+	X        int      `json:"x"`
+	Y        int      `json:"y"`
+	R        int      `json:"r"`
+	Material Material `json:"material"`
+}
+
+// Player is the brush and stroke of someone painting into the simulation
+// besides its own user, such as a player joined to a host.
+type Player struct {
+	source Source
+	edit   *Edit // its stroke being recorded
+}
+
+// NewPlayer returns a player holding a brush of the default size, loaded
+// with Sand.
+func NewPlayer() Player {
+	return Player{source: Source{radius: BRUSHRADIUS, material: Sand}}
+}
+
+// Presence returns the cursor of p as player id.
+func (p *Player) Presence(id int) Presence {
+	return Presence{id, int(p.source.p.X), int(p.source.p.Y), p.source.radius, p.source.material}
+}
+
+// Track moves the brush of p with e, pressing or releasing it, without
+// painting. A player joined to a host tracks its own brush this way to draw
+// previews of what the host paints.
+func (p *Player) Track(e mouse.Event) {
+	source := &p.source
+	if e.Button.IsWheel() {
+		source.Resize(e.Button)
+		return
+	}
+	source.p = Position{e.X, e.Y}
+	if e.Direction == mouse.DirPress {
+		source.anchor, source.stroke = source.p, StrokeTool(e, source.tool)
+	}
+	source.isActive = (source.isActive || e.Direction == mouse.DirPress) && e.Direction != mouse.DirRelease
+}
+
+// Material returns the material the brush of p is loaded with.
+func (p *Player) Material() Material {
+	return p.source.material
+}
+
+// Select loads the brush of p with m.
+func (p *Player) Select(m Material) {
+	p.source.material = m
+}
+
+// Use has p drag t from now on.
+func (p *Player) Use(t Tool) {
+	p.source.tool = t
+}
+
+// Status returns the state of the brush of p, the part of a Status a
+// renderer draws a player's previews from.
+func (p *Player) Status() Status {
+	source := &p.source
+	st := Status{Radius: source.radius, Material: source.material, Tool: source.tool}
+	if source.isActive && source.stroke != ToolBrush {
+		st.Stroke = source.stroke
+		st.Anchor = image.Point{int(source.anchor.X), int(source.anchor.Y)}
+	}
+	return st
+}
+
+// As runs fn with the brush and stroke of p in place of the simulation's.
+func (s *Simulation) As(p *Player, fn func()) {
+	s.source, p.source = p.source, s.source
+	s.history.current, p.edit = p.edit, s.history.current
+	defer func() {
+		s.source, p.source = p.source, s.source
+		s.history.current, p.edit = p.edit, s.history.current
+	}()
+	fn()
+}
+
+// PaintAs applies the brush of p for one tick, as Step does the
+// simulation's own. A brush stroke only paints while spend allows it.
+func (s *Simulation) PaintAs(p *Player, spend func() bool) {
+	s.As(p, func() {
+		if !s.source.isActive || s.source.stroke != ToolBrush || spend() {
+			s.Paint()
+		}
+		s.source.prev = s.source.p
+	})
+}
+
+// Release finishes the stroke p is dragging, if any, as if its button was
+// let go.
+func (s *Simulation) Release(p *Player) {
+	if !p.source.isActive {
+		return
+	}
+	s.As(p, func() {
+		s.HandleMouse(mouse.Event{X: s.source.p.X, Y: s.source.p.Y, Direction: mouse.DirRelease})
+	})
+}
+
+// Cursor returns the cursor of the simulation's own brush as player 0. It
+// reports false while the brush is still in the corner it starts in, not
+// having moved yet.
+func (s *Simulation) Cursor() (Presence, bool) {
+	p := Player{source: s.source}
+	return p.Presence(0), s.source.p != (Position{})
+}
+
+// SetPeers sets the cursors of the other players, which frames carry for
+// the renderer to draw.
+func (s *Simulation) SetPeers(peers []Presence) {
+	s.peers = append(s.peers[:0], peers...)
+}
+
+// Peers returns the cursors set by SetPeers.
+func (s *Simulation) Peers() []Presence {
+	return s.peers
+}
@@ -0,0 +1,98 @@
+package sim
+
+import (
+	"image"
+	"math"
+	"slices"
+
+	"github.com/jdavasligil/go-ecs"
+)
+
+// Portal links two discs of radius R. A particle inside either disc is sent
+// out of the other, its offset from the center and its velocity turned by
+// Turn quarter turns clockwise going from A to B, and back going from B to
+// A. It leaves along its turned velocity, or straight out if it was still,
+// so that it does not fall back in at once. A particle with nowhere free to
+// come out waits where it is.
+type Portal struct {
+	A, B image.Point
+	R    int
+	Turn int
+}
+
+// quarter turns (x, y) by n quarter turns clockwise, as seen on screen.
+func quarter(x, y float32, n int) (float32, float32) {
+	for range (n%4 + 4) % 4 {
+		x, y = -y, x
+	}
+	return x, y
+}
+
+// TogglePortal removes the portal with an end over p. Otherwise it opens a
+// portal there with the radius of the brush, or links one opened before.
+func (s *Simulation) TogglePortal(p image.Point) {
+	over := func(c image.Point, r int) bool {
+		d := p.Sub(c)
+		return d.X*d.X+d.Y*d.Y <= r*r
+	}
+	for i, pt := range s.portals {
+		if over(pt.A, pt.R) || over(pt.B, pt.R) {
+			s.portals = slices.Delete(s.portals, i, i+1)
+			return
+		}
+	}
+	if s.opening == nil {
+		s.opening = &Portal{A: p, B: p, R: s.source.radius}
+		return
+	}
+	if over(s.opening.A, s.opening.R) {
+		s.opening = nil
+		return
+	}
+	s.opening.B = p
+	s.portals = append(s.portals, *s.opening)
+	s.opening = nil
+}
+
+// Teleport sends the particles inside each portal out of the other end.
+func (s *Simulation) Teleport() {
+	for _, pt := range s.portals {
+		s.teleport(pt.A, pt.B, pt.R, pt.Turn)
+		s.teleport(pt.B, pt.A, pt.R, -pt.Turn)
+	}
+}
+
+// teleport sends the particles within r of from to the matching place
+// around to.
+func (s *Simulation) teleport(from, to image.Point, r, turn int) {
+	in := image.Rect(from.X-r, from.Y-r, from.X+r+1, from.Y+r+1)
+	for _, e := range s.particlesAt(in) {
+		p, _ := ecs.Get[Position](&s.world, e)
+		v, _ := ecs.Get[Velocity](&s.world, e)
+		ox, oy := p.X-float32(from.X), p.Y-float32(from.Y)
+		if ox*ox+oy*oy > float32(r*r) {
+			continue
+		}
+		ox, oy = quarter(ox, oy, turn)
+		vx, vy := quarter(v.X, v.Y, turn)
+		// March out of the far disc, along the velocity or else outward.
+		dx, dy := vx, vy
+		if dx == 0 && dy == 0 {
+			dx, dy = ox, oy
+		}
+		if n := float32(math.Hypot(float64(dx), float64(dy))); n > 0 {
+			dx, dy = dx/n, dy/n
+		} else {
+			dy = 1
+		}
+		x, y := float32(to.X)+ox, float32(to.Y)+oy
+		for (x-float32(to.X))*(x-float32(to.X))+(y-float32(to.Y))*(y-float32(to.Y)) <= float32(r*r) {
+			x, y = x+dx, y+dy
+		}
+		q := image.Point{int(x), int(y)}
+		if x < 0 || y < 0 || !q.In(s.grid.Bounds()) || s.grid.IsSet(q.X, q.Y) {
+			continue
+		}
+		s.displace(e, q, Velocity{vx, vy})
+	}
+}
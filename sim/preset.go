@@ -0,0 +1,92 @@
+package sim
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/jdavasligil/sandbox/input"
+)
+
+// PRESETKEYS is how many presets get a default key, F1 onwards. F9 and up
+// are taken by the recorders.
+const PRESETKEYS = 8
+
+//go:embed presets/*.json
+var presetFiles embed.FS
+
+// Preset selects one of the demo scenes built into the program, numbered
+// from 0 in the order of PresetNames.
+type Preset uint8
+
+// PresetNames names the built-in demo scenes. Their files are named after
+// them, with a number in front setting their order.
+var PresetNames = func() []string {
+	paths, _ := fs.Glob(presetFiles, "presets/*.json")
+	names := make([]string, len(paths))
+	for i, p := range paths {
+		name := strings.TrimSuffix(path.Base(p), ".json")
+		_, names[i], _ = strings.Cut(name, "-")
+	}
+	return names
+}()
+
+func init() {
+	for i := range min(len(PresetNames), PRESETKEYS) {
+		input.DefaultKeys = append(input.DefaultKeys, input.Binding{Command: Preset(i), Chords: []string{fmt.Sprintf("f%d", i+1)}})
+	}
+}
+
+func (p Preset) String() string {
+	return fmt.Sprintf("preset-%d", int(p)+1)
+}
+
+// LoadPreset returns the built-in scene p.
+func LoadPreset(p Preset) (Scene, error) {
+	var sc Scene
+	paths, _ := fs.Glob(presetFiles, "presets/*.json")
+	if int(p) >= len(paths) {
+		return sc, fmt.Errorf("no %s", p)
+	}
+	data, err := presetFiles.ReadFile(paths[p])
+	if err != nil {
+		return sc, err
+	}
+	if err := json.Unmarshal(data, &sc); err != nil {
+		return sc, fmt.Errorf("%s: %w", paths[p], err)
+	}
+	return sc, nil
+}
+
+// PlayPreset replaces the world with the built-in scene p.
+func (s *Simulation) PlayPreset(p Preset) {
+	sc, err := LoadPreset(p)
+	if err != nil {
+		simLog.Error("cannot load preset", "err", err)
+		return
+	}
+	s.Unload()
+	if err := s.ApplyScene(sc); err != nil {
+		simLog.Error("cannot apply preset", "preset", PresetNames[p], "err", err)
+		return
+	}
+	s.paused = false
+}
+
+// PresetHint lists the presets bound in km for the HUD, or returns "" if
+// none are.
+func PresetHint(km input.Keymap) string {
+	var parts []string
+	for i, name := range PresetNames {
+		if c, ok := km.Find(Preset(i)); ok {
+			parts = append(parts, c.String()+" "+name)
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "DEMOS " + strings.Join(parts, ", ")
+}
@@ -0,0 +1,122 @@
+package sim
+
+import (
+	"slices"
+
+	"github.com/jdavasligil/go-ecs"
+)
+
+// Join3 joins the entities that have all of the components A, B and C,
+// holding each beside pointers to its three components, so a system walks
+// them in one loop. It walks the dense store of A and finds each entity in
+// those of B and C through an Index rather than the world. A join is meant
+// to be kept and run again each tick, reusing its storage.
+type Join3[A, B, C ecs.Component] struct {
+	Ents []ecs.Entity
+	A    []*A
+	B    []*B
+	C    []*C
+
+	b Index[B]
+	c Index[C]
+}
+
+// Run gathers the join from w. It walks the store of A in its order, so A
+// should be the rarest of the three, such as a tag like Falling. The
+// pointers stay valid until an A, B or C is added or removed.
+func (q *Join3[A, B, C]) Run(w *ecs.World) {
+	ents, as := ecs.Query[A](w)
+	q.b.Sync(w)
+	q.c.Sync(w)
+	n := len(ents)
+	q.Ents, q.A, q.B, q.C = resize(q.Ents, n), resize(q.A, n), resize(q.B, n), resize(q.C, n)
+	k := 0
+	for i, e := range ents {
+		b := q.b.Get(e)
+		if b == nil {
+			continue
+		}
+		c := q.c.Get(e)
+		if c == nil {
+			continue
+		}
+		q.Ents[k], q.A[k], q.B[k], q.C[k] = e, &as[i], b, c
+		k++
+	}
+	q.Ents, q.A, q.B, q.C = q.Ents[:k], q.A[:k], q.B[:k], q.C[:k]
+}
+
+// Len returns how many entities the last Run found.
+func (q *Join3[A, B, C]) Len() int {
+	return len(q.Ents)
+}
+
+// Index finds entities in the dense store of component T by their ID.
+// go-ecs keeps the sparse index of a store to itself, so Index keeps its
+// own, checking every entry it uses against the store. Entities added at
+// the end of the store are indexed as they arrive. A removal moves the last
+// entity into the gap, which Get then looks up in the world instead; once
+// that happens for more than one in INDEXSTALE of the store, the next Sync
+// indexes the store again.
+type Index[T ecs.Component] struct {
+	at     []int32 // place in the store by entity ID, if it is still there
+	n      int     // how much of the store at covers
+	misses int     // lookups at can no longer answer
+
+	w     *ecs.World
+	ents  []ecs.Entity
+	comps []T
+}
+
+// INDEXSTALE is the share of the entities of a store, as one in this many,
+// that an Index may look up in the world before it is rebuilt.
+const INDEXSTALE = 32
+
+// Sync catches the index up with the store of T in w. Pointers from Get
+// stay valid until a T is added or removed.
+func (x *Index[T]) Sync(w *ecs.World) {
+	x.w = w
+	x.ents, x.comps = ecs.Query[T](w)
+	if x.misses > len(x.ents)/INDEXSTALE {
+		x.n, x.misses = 0, 0
+	}
+	x.index(min(x.n, len(x.ents)))
+}
+
+// Get returns the T of e, or nil if e has none.
+func (x *Index[T]) Get(e ecs.Entity) *T {
+	if i, ok := x.find(e); ok {
+		return &x.comps[i]
+	}
+	c, ok := ecs.GetMut[T](x.w, e)
+	if !ok {
+		return nil
+	}
+	x.misses++
+	return c
+}
+
+func (x *Index[T]) find(e ecs.Entity) (int, bool) {
+	id := int(e.ID())
+	if id >= len(x.at) {
+		return 0, false
+	}
+	i := int(x.at[id])
+	return i, i < len(x.ents) && x.ents[i] == e
+}
+
+// index indexes the store from place i on. Entries of entities that have
+// since left the store are not cleared, as find never trusts an entry the
+// store disagrees with.
+func (x *Index[T]) index(i int) {
+	top := len(x.at)
+	for _, e := range x.ents[i:] {
+		top = max(top, int(e.ID())+1)
+	}
+	// Whatever at grows into is checked before it is used.
+	x.at = slices.Grow(x.at, top-len(x.at))[:top]
+	for ; i < len(x.ents); i++ {
+		x.at[x.ents[i].ID()] = int32(i)
+	}
+	x.n = len(x.ents)
+}
@@ -0,0 +1,69 @@
+package sim
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/jdavasligil/go-ecs"
+)
+
+// TestJoin3 runs a join between random changes to a world, including
+// removals that reorder the stores and entities recycled for new ones, and
+// checks it against looking every entity up in the world.
+func TestJoin3(t *testing.T) {
+	w := NewWorld()
+	rng := rand.New(rand.NewPCG(1, 2))
+	var live []ecs.Entity
+	var q Join3[Falling, Position, Velocity]
+	for round := range 200 {
+		for range rng.IntN(50) {
+			e := w.NewEntity()
+			ecs.Add(&w, e, Position{float32(round), rng.Float32()})
+			if rng.IntN(4) > 0 {
+				ecs.Add(&w, e, Velocity{rng.Float32(), 0})
+			}
+			if rng.IntN(2) > 0 {
+				ecs.Add(&w, e, Falling{})
+			}
+			live = append(live, e)
+		}
+		for range rng.IntN(40) {
+			if len(live) == 0 {
+				break
+			}
+			i := rng.IntN(len(live))
+			e := live[i]
+			switch rng.IntN(3) {
+			case 0:
+				ecs.Remove[Falling](&w, e)
+			case 1:
+				ecs.Remove[Velocity](&w, e)
+			default:
+				ecs.Remove[Position](&w, e)
+				ecs.Remove[Velocity](&w, e)
+				ecs.Remove[Falling](&w, e)
+				w.DestroyEntity(e)
+				live[i] = live[len(live)-1]
+				live = live[:len(live)-1]
+			}
+		}
+
+		q.Run(&w)
+		want, _ := ecs.Query[Falling](&w)
+		k := 0
+		for _, e := range want {
+			p, okp := ecs.GetMut[Position](&w, e)
+			v, okv := ecs.GetMut[Velocity](&w, e)
+			if !okp || !okv {
+				continue
+			}
+			if k >= q.Len() || q.Ents[k] != e || q.B[k] != p || q.C[k] != v {
+				t.Fatalf("round %d: join differs from the world at %d of %d", round, k, q.Len())
+			}
+			k++
+		}
+		if k != q.Len() {
+			t.Fatalf("round %d: joined %d entities, want %d", round, q.Len(), k)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package sim
+
+import (
+	"time"
+
+	"github.com/jdavasligil/sandbox/grid"
+)
+
+// Timing derived from the simulation and frame rates. See SetRates.
+var (
+	SIMRATE  = 64
+	FRMRATE  = 60
+	DELTA    float32
+	MAXVEL   float32
+	SIMTICK  time.Duration
+	DRAWTICK time.Duration // zero when frames are paced by the display
+)
+
+// SPEEDS are the simulation speed multipliers selectable at runtime. Physics
+// always advances DELTA per tick; speed only changes how often ticks run.
+var SPEEDS = []float64{0.25, 0.5, 1, 2, 4}
+
+// SetRates sets the ticks and frames per second. A frame rate of zero presents
+// a new frame as soon as the previous one has been published, letting the
+// driver's vsync pace the renderer.
+func SetRates(simrate, frmrate int) {
+	SIMRATE = simrate
+	FRMRATE = frmrate
+	DELTA = 1.0 / float32(SIMRATE)
+	MAXVEL = 4.0 * float32(SIMRATE)
+	SIMTICK = time.Second / time.Duration(SIMRATE)
+	DRAWTICK = 0
+	if FRMRATE > 0 {
+		DRAWTICK = time.Second / time.Duration(FRMRATE)
+	}
+}
+
+// Physics, set from sandbox.toml. See Configure.
+var (
+	MAXSAND         = grid.WIDTH * grid.HEIGHT / 2
+	GRAVITY float32 = 490.0 // px/s/s
+)
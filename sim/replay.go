@@ -0,0 +1,133 @@
+package sim
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"io"
+	"os"
+
+	"golang.org/x/mobile/event/mouse"
+
+	"github.com/jdavasligil/sandbox/input"
+)
+
+func init() {
+	gob.Register(mouse.Event{})
+	gob.Register(Material(0))
+	gob.Register(Tool(0))
+	gob.Register(input.Action(0))
+}
+
+// A replay file holds the seed of a session followed by every input event
+// the simulation handled, tagged with the tick that handled it. Since the
+// simulation is deterministic, handling the same events on the same ticks
+// from the same seed reproduces the session exactly, provided it starts from
+// the same world and any files it loads are unchanged.
+
+// ReplayEvent is an input event handled on tick Tick.
+type ReplayEvent struct {
+	Tick  uint64
+	Event any
+}
+
+// ReplayWriter records events to a replay file.
+type ReplayWriter struct {
+	f   *os.File
+	w   *bufio.Writer
+	enc *gob.Encoder
+}
+
+// CreateReplay starts a replay file at path for a session seeded with seed.
+func CreateReplay(path string, seed [2]uint64) (*ReplayWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	r := &ReplayWriter{f: f, w: w, enc: gob.NewEncoder(w)}
+	if err := r.enc.Encode(seed); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *ReplayWriter) Record(tick uint64, event any) error {
+	return r.enc.Encode(ReplayEvent{tick, event})
+}
+
+// Flush writes buffered events to the file.
+func (r *ReplayWriter) Flush() error {
+	return r.w.Flush()
+}
+
+// ReplayReader plays back a replay file.
+type ReplayReader struct {
+	f    *os.File
+	dec  *gob.Decoder
+	next ReplayEvent
+	done bool
+}
+
+// OpenReplay opens the replay file at path and returns it with the seed the
+// session must start from.
+func OpenReplay(path string) (*ReplayReader, [2]uint64, error) {
+	var seed [2]uint64
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, seed, err
+	}
+	r := &ReplayReader{f: f, dec: gob.NewDecoder(bufio.NewReader(f))}
+	if err := r.dec.Decode(&seed); err != nil {
+		f.Close()
+		return nil, seed, err
+	}
+	if err := r.advance(); err != nil {
+		f.Close()
+		return nil, seed, err
+	}
+	return r, seed, nil
+}
+
+func (r *ReplayReader) advance() error {
+	r.next = ReplayEvent{}
+	err := r.dec.Decode(&r.next)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		// A recording cut short by a crash simply ends early.
+		r.done = true
+		r.f.Close()
+		return nil
+	}
+	return err
+}
+
+// Done reports whether every event has been played back.
+func (r *ReplayReader) Done() bool {
+	return r.done
+}
+
+// Feed handles the events due on the current tick of s, recording them to
+// rec if it is not nil.
+func (r *ReplayReader) Feed(s *Simulation, rec *ReplayWriter) error {
+	due, err := r.Due(s.tick)
+	for _, event := range due {
+		if rec != nil {
+			rec.Record(s.tick, event)
+		}
+		s.Handle(event)
+	}
+	return err
+}
+
+// Due returns the events handled on tick, in their recorded order.
+func (r *ReplayReader) Due(tick uint64) ([]any, error) {
+	var events []any
+	for !r.done && r.next.Tick <= tick {
+		events = append(events, r.next.Event)
+		if err := r.advance(); err != nil {
+			return events, err
+		}
+	}
+	return events, nil
+}
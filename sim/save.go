@@ -0,0 +1,513 @@
+package sim
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"math/rand/v2"
+	"os"
+	"slices"
+
+	"github.com/jdavasligil/go-ecs"
+
+	"github.com/jdavasligil/sandbox/grid"
+)
+
+const (
+	SAVEMAGIC   = "SAND"
+	SAVEVERSION = 4
+)
+
+// A save file starts with SAVEMAGIC and a little-endian uint16 version,
+// followed by the gzip compressed save. Files without the magic are read as
+// the uncompressed saves that predate it. Up to version 1 particles were
+// saveParticle records; since then they are a world written by SaveWorld.
+// Version 3 adds the boundary grid after the world, and version 4 the
+// fixtures after that: a saveFixtures, then that many saveEmitter,
+// savePlatform (each followed by its waypoints as pairs of int32),
+// savePortal, saveSensor and saveDoor records in turn.
+
+// saveHeader is the fixed size part of a save.
+type saveHeader struct {
+	Width, Height uint32
+	Particles     uint32 // number of particle entities
+	SandCount     uint32 // unused, kept so older saves still load
+	RNGSize       uint32 // bytes of marshaled generator state
+
+	// Source state.
+	X, Y     float32
+	Radius   int32
+	Material Material
+	Tool     Tool
+	Symmetry Symmetry
+}
+
+// saveFixtures counts the fixtures of each kind in a save.
+type saveFixtures struct {
+	Emitters, Platforms, Portals, Sensors, Doors uint32
+}
+
+// saveRect is the saved form of an image.Rectangle.
+type saveRect struct {
+	X0, Y0, X1, Y1 int32
+}
+
+type saveEmitter struct {
+	X, Y, R, Every, Channel int32
+	Material                Material
+}
+
+type savePlatform struct {
+	Rect     saveRect
+	Speed    float32
+	FromX    int32
+	FromY    int32
+	Leg, Dir int32
+	Travel   float32
+	Points   uint32 // waypoints that follow
+}
+
+type savePortal struct {
+	AX, AY, BX, BY, R, Turn int32
+}
+
+type saveSensor struct {
+	Rect     saveRect
+	Material Material
+	Channel  int32
+	On       bool
+}
+
+type saveDoor struct {
+	Rect    saveRect
+	Channel int32
+}
+
+func toSaveRect(r image.Rectangle) saveRect {
+	return saveRect{int32(r.Min.X), int32(r.Min.Y), int32(r.Max.X), int32(r.Max.Y)}
+}
+
+func (r saveRect) rect() image.Rectangle {
+	return image.Rect(int(r.X0), int(r.Y0), int(r.X1), int(r.Y1))
+}
+
+// fixtures are the emitters, platforms, portals, sensors and doors of a
+// world, which scenes and tools add besides cells.
+type fixtures struct {
+	emitters  []Emitter
+	platforms []Platform
+	portals   []Portal
+	sensors   []Sensor
+	doors     []Door
+}
+
+// saveFixtures writes the fixtures of s to w.
+func (s *Simulation) saveFixtures(w io.Writer) error {
+	n := saveFixtures{uint32(len(s.emitters)), uint32(len(s.platforms)), uint32(len(s.portals)), uint32(len(s.sensors)), uint32(len(s.doors))}
+	data := []any{n}
+	for _, em := range s.emitters {
+		data = append(data, saveEmitter{int32(em.X), int32(em.Y), int32(em.R), int32(em.Every), int32(em.Channel), em.Material})
+	}
+	for _, p := range s.platforms {
+		data = append(data, savePlatform{toSaveRect(p.Rect), p.Speed, int32(p.from.X), int32(p.from.Y), int32(p.leg), int32(p.dir), p.travel, uint32(len(p.Path))})
+		for _, q := range p.Path {
+			data = append(data, [2]int32{int32(q.X), int32(q.Y)})
+		}
+	}
+	for _, pt := range s.portals {
+		data = append(data, savePortal{int32(pt.A.X), int32(pt.A.Y), int32(pt.B.X), int32(pt.B.Y), int32(pt.R), int32(pt.Turn)})
+	}
+	for _, sn := range s.sensors {
+		data = append(data, saveSensor{toSaveRect(sn.Rect), sn.Material, int32(sn.Channel), sn.on})
+	}
+	for _, d := range s.doors {
+		data = append(data, saveDoor{toSaveRect(d.Rect), int32(d.Channel)})
+	}
+	for _, v := range data {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadFixtures reads the fixtures written by saveFixtures from r, checking
+// that each fits in the world.
+func loadFixtures(r io.Reader) (fixtures, error) {
+	var f fixtures
+	var n saveFixtures
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return f, err
+	}
+	most := uint32(grid.WIDTH * grid.HEIGHT)
+	if n.Emitters > most || n.Platforms > most || n.Portals > most || n.Sensors > most || n.Doors > most {
+		return f, fmt.Errorf("save fixtures are corrupt")
+	}
+	bounds := image.Rect(0, 0, grid.WIDTH, grid.HEIGHT)
+	in := func(x, y int32) bool { return (image.Point{int(x), int(y)}).In(bounds) }
+	material := func(m Material) error {
+		if int(m) >= len(Elements) {
+			return fmt.Errorf("save holds unknown material %d", m)
+		}
+		return nil
+	}
+	for range n.Emitters {
+		var em saveEmitter
+		if err := binary.Read(r, binary.LittleEndian, &em); err != nil {
+			return f, err
+		}
+		if err := material(em.Material); err != nil {
+			return f, err
+		}
+		if !in(em.X, em.Y) || em.R < 0 || em.R > MAXRADIUS || em.Every < 1 || em.Channel < 0 {
+			return f, fmt.Errorf("save holds a bad emitter at (%d, %d)", em.X, em.Y)
+		}
+		f.emitters = append(f.emitters, Emitter{int(em.X), int(em.Y), int(em.R), em.Material, int(em.Every), int(em.Channel)})
+	}
+	for range n.Platforms {
+		var p savePlatform
+		if err := binary.Read(r, binary.LittleEndian, &p); err != nil {
+			return f, err
+		}
+		rect := p.Rect.rect()
+		if p.Points == 0 || p.Points > most || rect.Empty() || !rect.In(bounds) || int(p.Leg) >= int(p.Points) || p.Leg < 0 ||
+			p.Dir != 1 && p.Dir != -1 || !(p.Speed >= 0 && p.Speed <= MAXVEL) || !(p.Travel >= 0 && p.Travel < 1) {
+			return f, fmt.Errorf("save holds a bad platform at %v", rect)
+		}
+		path := make([]image.Point, p.Points)
+		for i := range path {
+			var q [2]int32
+			if err := binary.Read(r, binary.LittleEndian, &q); err != nil {
+				return f, err
+			}
+			path[i] = image.Point{int(q[0]), int(q[1])}
+			if !(image.Rectangle{path[i], path[i].Add(rect.Size())}).In(bounds) {
+				return f, fmt.Errorf("save holds a platform leaving the world at %v", path[i])
+			}
+		}
+		f.platforms = append(f.platforms, Platform{
+			Rect:   rect,
+			Path:   path,
+			Speed:  p.Speed,
+			from:   image.Point{int(p.FromX), int(p.FromY)},
+			leg:    int(p.Leg),
+			dir:    int(p.Dir),
+			travel: p.Travel,
+		})
+	}
+	for range n.Portals {
+		var pt savePortal
+		if err := binary.Read(r, binary.LittleEndian, &pt); err != nil {
+			return f, err
+		}
+		if !in(pt.AX, pt.AY) || !in(pt.BX, pt.BY) || pt.R < 0 || pt.R > MAXRADIUS {
+			return f, fmt.Errorf("save holds a bad portal at (%d, %d)", pt.AX, pt.AY)
+		}
+		f.portals = append(f.portals, Portal{image.Point{int(pt.AX), int(pt.AY)}, image.Point{int(pt.BX), int(pt.BY)}, int(pt.R), int(pt.Turn)})
+	}
+	for range n.Sensors {
+		var sn saveSensor
+		if err := binary.Read(r, binary.LittleEndian, &sn); err != nil {
+			return f, err
+		}
+		if err := material(sn.Material); err != nil {
+			return f, err
+		}
+		if rect := sn.Rect.rect(); !rect.In(bounds) || sn.Channel < 0 {
+			return f, fmt.Errorf("save holds a bad sensor at %v", rect)
+		}
+		f.sensors = append(f.sensors, Sensor{Rect: sn.Rect.rect(), Material: sn.Material, Channel: int(sn.Channel), on: sn.On})
+	}
+	for range n.Doors {
+		var d saveDoor
+		if err := binary.Read(r, binary.LittleEndian, &d); err != nil {
+			return f, err
+		}
+		if rect := d.Rect.rect(); !rect.In(bounds) || d.Channel < 0 {
+			return f, fmt.Errorf("save holds a bad door at %v", rect)
+		}
+		f.doors = append(f.doors, Door{d.Rect.rect(), int(d.Channel)})
+	}
+	return f, nil
+}
+
+// saveParticle is the saved form of a particle entity up to version 1.
+type saveParticle struct {
+	P       Position
+	V       Velocity
+	M       Material
+	Falling bool
+}
+
+// Save writes the grid, the world, its fixtures, the brush and the random
+// generator state to w. A challenge being played is not saved. The collision grid is rebuilt from these on load and the
+// velocity field starts out still.
+func (s *Simulation) Save(w io.Writer) error {
+	rng, err := s.pcg.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	// Falling particles go first, in the order ApplyPhysics moves them, so a
+	// loaded world evolves exactly as the saved one would have.
+	falling, _ := ecs.Query[Falling](&s.world)
+	ents, _ := ecs.Query[Position](&s.world)
+	order := make([]ecs.Entity, 0, len(ents))
+	order = append(order, falling...)
+	// Resting particles follow in the order their chunks check them.
+	filed := make(map[ecs.Entity]bool)
+	for i, list := range s.chunks.resting {
+		for _, e := range list {
+			if _, ok := s.resting(e, i); ok && !filed[e] {
+				filed[e] = true
+				order = append(order, e)
+			}
+		}
+	}
+	for _, e := range ents {
+		if _, ok := ecs.Get[Falling](&s.world, e); !ok && !filed[e] {
+			order = append(order, e)
+		}
+	}
+	h := saveHeader{
+		Width:     uint32(grid.WIDTH),
+		Height:    uint32(grid.HEIGHT),
+		Particles: uint32(len(order)),
+		RNGSize:   uint32(len(rng)),
+		X:         s.source.p.X,
+		Y:         s.source.p.Y,
+		Radius:    int32(s.source.radius),
+		Material:  s.source.material,
+		Tool:      s.source.tool,
+		Symmetry:  s.symmetry,
+	}
+
+	if _, err := io.WriteString(w, SAVEMAGIC); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint16(SAVEVERSION)); err != nil {
+		return err
+	}
+	// Autosaves encode on the simulation goroutine, so favor speed.
+	zw, err := gzip.NewWriterLevel(w, gzip.BestSpeed)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(zw)
+	for _, data := range []any{h, rng, s.grid.data} {
+		if err := binary.Write(bw, binary.LittleEndian, data); err != nil {
+			return err
+		}
+	}
+	if err := SaveWorld(bw, &s.world, order); err != nil {
+		return err
+	}
+	if err := binary.Write(bw, binary.LittleEndian, s.boundary.Words()); err != nil {
+		return err
+	}
+	if err := s.saveFixtures(bw); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Load replaces the state of s with a save read from r, fixtures included:
+// those of the session are dropped, as is any challenge. On error s is left
+// unchanged.
+func (s *Simulation) Load(r io.Reader) error {
+	br := bufio.NewReader(r)
+	version := uint16(1)
+	if magic, err := br.Peek(len(SAVEMAGIC)); err == nil && string(magic) == SAVEMAGIC {
+		br.Discard(len(SAVEMAGIC))
+		if err := binary.Read(br, binary.LittleEndian, &version); err != nil {
+			return err
+		}
+		if version < 1 || version > SAVEVERSION {
+			return fmt.Errorf("save version %d is not supported", version)
+		}
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		br = bufio.NewReader(zr)
+	}
+	var h saveHeader
+	if err := binary.Read(br, binary.LittleEndian, &h); err != nil {
+		return err
+	}
+	if int(h.Width) != grid.WIDTH || int(h.Height) != grid.HEIGHT {
+		return fmt.Errorf("save is %dx%d, want %dx%d", h.Width, h.Height, grid.WIDTH, grid.HEIGHT)
+	}
+	if h.RNGSize > 1024 || int(h.Particles) > grid.WIDTH*grid.HEIGHT {
+		return fmt.Errorf("save header is corrupt")
+	}
+	if !slices.Contains(Materials, h.Material) {
+		return fmt.Errorf("save selects material %d, which cannot be selected", h.Material)
+	}
+	if h.Tool >= TOOLS {
+		return fmt.Errorf("save selects unknown tool %d", h.Tool)
+	}
+	rng := make([]byte, h.RNGSize)
+	g := NewMaterialGrid()
+	for _, data := range []any{rng, g.data} {
+		if err := binary.Read(br, binary.LittleEndian, data); err != nil {
+			return err
+		}
+	}
+	for _, m := range g.data {
+		if int(m) >= len(Elements) {
+			return fmt.Errorf("save holds unknown material %d", m)
+		}
+	}
+	world := NewWorld()
+	var ents []ecs.Entity
+	if version >= 2 {
+		var err error
+		if ents, err = LoadWorld(br, &world, grid.WIDTH*grid.HEIGHT); err != nil {
+			return err
+		}
+	} else {
+		parts := make([]saveParticle, h.Particles)
+		if err := binary.Read(br, binary.LittleEndian, parts); err != nil {
+			return err
+		}
+		for _, p := range parts {
+			e := world.NewEntity()
+			ecs.Add(&world, e, p.P)
+			ecs.Add(&world, e, p.V)
+			ecs.Add(&world, e, p.M)
+			if p.Falling {
+				ecs.Add(&world, e, Falling{})
+			}
+			ents = append(ents, e)
+		}
+	}
+	boundary := grid.NewGrid()
+	if version >= 3 {
+		if err := binary.Read(br, binary.LittleEndian, boundary.Words()); err != nil {
+			return err
+		}
+		for y := 0; y < grid.HEIGHT; y++ {
+			for x := 0; x < grid.WIDTH; x++ {
+				if boundary.IsSet(x, y) && g.At(x, y) != Wall {
+					return fmt.Errorf("save holds a boundary off a wall at (%d, %d)", x, y)
+				}
+			}
+		}
+	}
+	var fx fixtures
+	if version >= 4 {
+		var err error
+		if fx, err = loadFixtures(br); err != nil {
+			return err
+		}
+	}
+	for _, e := range ents {
+		m, ok := ecs.Get[Material](&world, e)
+		if !ok || int(m) >= len(Elements) {
+			return fmt.Errorf("save holds unknown material %d", m)
+		}
+		p, ok := ecs.Get[Position](&world, e)
+		if !ok || !(image.Point{int(p.X), int(p.Y)}).In(g.Bounds()) || p.X < 0 || p.Y < 0 {
+			return fmt.Errorf("save holds a particle outside the world")
+		}
+		if _, ok := ecs.Get[Velocity](&world, e); !ok {
+			ecs.Add(&world, e, Velocity{})
+		}
+	}
+	pcg := &rand.PCG{}
+	if err := pcg.UnmarshalBinary(rng); err != nil {
+		return err
+	}
+
+	// Everything parsed; commit. The fixtures of the session are dropped
+	// along with its world, like any challenge it was playing.
+	s.Unload()
+	s.world = world
+	s.pcg = pcg
+	s.rng = rand.New(pcg)
+	s.emitters = append(s.emitters, fx.emitters...)
+	s.platforms = append(s.platforms, fx.platforms...)
+	s.portals = append(s.portals, fx.portals...)
+	s.sensors = append(s.sensors, fx.sensors...)
+	s.doors = append(s.doors, fx.doors...)
+	// The signals of the last tick, which emitters read before Sense
+	// runs again.
+	for _, sn := range s.sensors {
+		if sn.on && sn.Channel != 0 {
+			s.signals[sn.Channel] = true
+		}
+	}
+	if version < 4 {
+		// Older saves left out the platforms and doors, so their cells
+		// would stand forever.
+		for i, m := range g.data {
+			if m == PlatformCell || m == DoorCell {
+				g.data[i] = Empty
+			}
+		}
+	}
+	s.grid.CopyRect(&g, g.Bounds())
+	copy(s.boundary.Words(), boundary.Words())
+	for y := 0; y < grid.HEIGHT; y++ {
+		for x := 0; x < grid.WIDTH; x++ {
+			if s.grid.At(x, y).IsStatic() {
+				s.col.Set(x, y)
+			}
+		}
+	}
+	for _, e := range ents {
+		p, _ := ecs.Get[Position](&s.world, e)
+		x, y := int(p.X), int(p.Y)
+		if _, falling := ecs.Get[Falling](&s.world, e); !falling {
+			s.col.Set(x, y)
+			s.chunks.Rest(e, x, y)
+		}
+		s.hash.Insert(e, x, y)
+		s.moved.Mark(e, p)
+	}
+	// Recheck the supports of the whole world in case cells were freed
+	// since the last tick.
+	s.chunks.WakeAll()
+	for y := 0; y < grid.HEIGHT; y++ {
+		for x := 0; x < grid.WIDTH; x++ {
+			s.placed(x, y)
+		}
+	}
+	s.source.p = Position{h.X, h.Y}
+	s.source.prev = s.source.p
+	s.source.radius = max(min(int(h.Radius), MAXRADIUS), MINRADIUS)
+	s.source.material = h.Material
+	s.source.tool = h.Tool
+	s.symmetry = h.Symmetry % SYMMETRIES
+	return nil
+}
+
+// SaveFile saves s to the file at path.
+func (s *Simulation) SaveFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := s.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadFile loads s from the file at path.
+func (s *Simulation) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.Load(f)
+}
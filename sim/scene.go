@@ -0,0 +1,376 @@
+package sim
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"os"
+	"slices"
+)
+
+// Scene describes the starting contents of a world. It is read from JSON:
+//
+//	{
+//	  "seed": [1, 2],
+//	  "shapes": [
+//	    {"shape": "rect", "material": "wall", "x0": 100, "y0": 700, "x1": 700, "y1": 720},
+//	    {"shape": "line", "material": "wall", "x0": 100, "y0": 300, "x1": 300, "y1": 400, "r": 2},
+//	    {"shape": "disc", "material": "water", "x0": 400, "y0": 600, "r": 40}
+//	  ],
+//	  "stamps": [{"name": "cup", "x": 400, "y": 650}],
+//	  "emitters": [{"material": "sand", "x": 400, "y": 40, "r": 4, "every": 2}],
+//	  "platforms": [{"w": 80, "h": 6, "path": [[100, 500], [600, 500]], "speed": 40}],
+//	  "portals": [{"a": [200, 700], "b": [600, 100], "r": 8, "turn": 1}],
+//	  "sensors": [{"material": "sand", "x0": 100, "y0": 690, "x1": 140, "y1": 692, "channel": 1}],
+//	  "doors": [{"x0": 300, "y0": 500, "x1": 340, "y1": 504, "channel": 1}],
+//	  "goals": [{"kind": "fill", "material": "sand", "x0": 360, "y0": 600, "x1": 440, "y1": 650, "count": 500}],
+//	  "limit": 120
+//	}
+//
+// Shapes are drawn in order, so later shapes only fill cells earlier ones
+// left empty. A scene with goals, or a limit in seconds, is played as a
+// challenge.
+type Scene struct {
+	Seed      *[2]uint64      `json:"seed,omitempty"`
+	Shapes    []SceneShape    `json:"shapes"`
+	Stamps    []SceneStamp    `json:"stamps"`
+	Emitters  []SceneEmitter  `json:"emitters"`
+	Platforms []ScenePlatform `json:"platforms"`
+	Portals   []ScenePortal   `json:"portals"`
+	Sensors   []SceneSensor   `json:"sensors"`
+	Doors     []SceneDoor     `json:"doors"`
+	Goals     []SceneGoal     `json:"goals"`
+	Limit     float64         `json:"limit"`
+}
+
+// SceneShape is a rect or ellipse spanning (X0, Y0) to (X1, Y1), a line
+// between them with radius R, or a disc of radius R centered on (X0, Y0).
+type SceneShape struct {
+	Shape    string `json:"shape"`
+	Material string `json:"material"`
+	X0       int    `json:"x0"`
+	Y0       int    `json:"y0"`
+	X1       int    `json:"x1"`
+	Y1       int    `json:"y1"`
+	R        int    `json:"r"`
+}
+
+// SceneStamp places the named stamp centered on (X, Y).
+type SceneStamp struct {
+	Name string `json:"name"`
+	X    int    `json:"x"`
+	Y    int    `json:"y"`
+}
+
+type SceneEmitter struct {
+	Material string `json:"material"`
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+	R        int    `json:"r"`
+	Every    int    `json:"every"`
+	Channel  int    `json:"channel"`
+}
+
+// ScenePlatform is a W by H platform whose top left corner sweeps through
+// the points of Path at Speed cells a second.
+type ScenePlatform struct {
+	W     int      `json:"w"`
+	H     int      `json:"h"`
+	Path  [][2]int `json:"path"`
+	Speed float32  `json:"speed"`
+}
+
+// ScenePortal links discs of radius R around A and B, turning what passes
+// from A to B by Turn quarter turns clockwise.
+type ScenePortal struct {
+	A    [2]int `json:"a"`
+	B    [2]int `json:"b"`
+	R    int    `json:"r"`
+	Turn int    `json:"turn"`
+}
+
+// SceneSensor is a sensor spanning (X0, Y0) to (X1, Y1) that switches on
+// Channel while Material touches it.
+type SceneSensor struct {
+	Material string `json:"material"`
+	X0       int    `json:"x0"`
+	Y0       int    `json:"y0"`
+	X1       int    `json:"x1"`
+	Y1       int    `json:"y1"`
+	Channel  int    `json:"channel"`
+}
+
+// SceneDoor is a door spanning (X0, Y0) to (X1, Y1) that opens while
+// Channel is on.
+type SceneDoor struct {
+	X0      int `json:"x0"`
+	Y0      int `json:"y0"`
+	X1      int `json:"x1"`
+	Y1      int `json:"y1"`
+	Channel int `json:"channel"`
+}
+
+// SceneGoal is a goal of kind "fill", wanting Count particles of Material
+// within (X0, Y0) to (X1, Y1), "avoid", allowing no more than Count there,
+// or "hold", wanting Channel kept on for Seconds.
+type SceneGoal struct {
+	Kind     string  `json:"kind"`
+	Material string  `json:"material"`
+	X0       int     `json:"x0"`
+	Y0       int     `json:"y0"`
+	X1       int     `json:"x1"`
+	Y1       int     `json:"y1"`
+	Count    int     `json:"count"`
+	Channel  int     `json:"channel"`
+	Seconds  float64 `json:"seconds"`
+}
+
+// Emitter sprays a disc of material every Every ticks while physics runs,
+// and while the signal on Channel is on unless Channel is 0. One with wire
+// touching its nozzle also waits for that wire to be live.
+type Emitter struct {
+	X, Y, R  int
+	Material Material
+	Every    int
+	Channel  int
+}
+
+// LoadScene reads the JSON scene at path.
+func LoadScene(path string) (Scene, error) {
+	var sc Scene
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return sc, err
+	}
+	if err := json.Unmarshal(data, &sc); err != nil {
+		return sc, fmt.Errorf("%s: %w", path, err)
+	}
+	return sc, nil
+}
+
+// ApplyScene draws sc into the world and adds its emitters. Every part of
+// the scene is checked before any of it is applied, so a scene with an
+// error leaves the world as it was.
+func (s *Simulation) ApplyScene(sc Scene) error {
+	bounds := s.grid.Bounds()
+	in := func(p image.Point) bool { return p.In(bounds) }
+	radius := func(r int) bool { return r >= 0 && r <= MAXRADIUS }
+
+	shapes := make([]Material, len(sc.Shapes))
+	for i, sh := range sc.Shapes {
+		m, err := ParseMaterial(sh.Material)
+		if err != nil {
+			return fmt.Errorf("shape %d: %w", i, err)
+		}
+		a, b := image.Point{sh.X0, sh.Y0}, image.Point{sh.X1, sh.Y1}
+		switch sh.Shape {
+		case "rect", "ellipse", "line":
+			if !in(a) || !in(b) {
+				return fmt.Errorf("shape %d leaves the world", i)
+			}
+		case "disc":
+			if !in(a) {
+				return fmt.Errorf("shape %d leaves the world", i)
+			}
+		default:
+			return fmt.Errorf("shape %d: unknown shape %q", i, sh.Shape)
+		}
+		if (sh.Shape == "line" || sh.Shape == "disc") && !radius(sh.R) {
+			return fmt.Errorf("shape %d needs a radius from 0 to %d", i, MAXRADIUS)
+		}
+		shapes[i] = m
+	}
+	stamps := make([]Stamp, len(sc.Stamps))
+	for i, st := range sc.Stamps {
+		j := slices.IndexFunc(s.stamps, func(t Stamp) bool { return t.Name == st.Name })
+		if j < 0 {
+			return fmt.Errorf("unknown stamp %q", st.Name)
+		}
+		if !in(image.Point{st.X, st.Y}) {
+			return fmt.Errorf("stamp %d leaves the world", i)
+		}
+		stamps[i] = s.stamps[j]
+	}
+	var emitters []Emitter
+	for i, em := range sc.Emitters {
+		m, err := ParseMaterial(em.Material)
+		if err != nil {
+			return fmt.Errorf("emitter %d: %w", i, err)
+		}
+		if !in(image.Point{em.X, em.Y}) || !radius(em.R) {
+			return fmt.Errorf("emitter %d needs a place in the world and a radius from 0 to %d", i, MAXRADIUS)
+		}
+		emitters = append(emitters, Emitter{em.X, em.Y, max(em.R, MINRADIUS), m, max(em.Every, 1), max(em.Channel, 0)})
+	}
+	var platforms []Platform
+	for i, pl := range sc.Platforms {
+		if pl.W <= 0 || pl.H <= 0 || len(pl.Path) == 0 {
+			return fmt.Errorf("platform %d needs a size and a path", i)
+		}
+		if pl.Speed > MAXVEL {
+			return fmt.Errorf("platform %d is faster than %g cells a second", i, MAXVEL)
+		}
+		path := make([]image.Point, len(pl.Path))
+		for j, q := range pl.Path {
+			path[j] = image.Point{q[0], q[1]}
+			if !(image.Rectangle{path[j], path[j].Add(image.Point{pl.W, pl.H})}).In(bounds) {
+				return fmt.Errorf("platform %d leaves the world at point %d", i, j)
+			}
+			if j > 0 && path[j] == path[j-1] {
+				return fmt.Errorf("platform %d repeats point %d", i, j)
+			}
+		}
+		platforms = append(platforms, NewPlatform(pl.W, pl.H, path, max(pl.Speed, 0)))
+	}
+	var portals []Portal
+	for i, pt := range sc.Portals {
+		a, b := image.Point{pt.A[0], pt.A[1]}, image.Point{pt.B[0], pt.B[1]}
+		if !in(a) || !in(b) || !radius(pt.R) {
+			return fmt.Errorf("portal %d needs both ends in the world and a radius from 0 to %d", i, MAXRADIUS)
+		}
+		portals = append(portals, Portal{A: a, B: b, R: max(pt.R, MINRADIUS), Turn: pt.Turn})
+	}
+	var sensors []Sensor
+	for i, sn := range sc.Sensors {
+		m, err := ParseMaterial(sn.Material)
+		if err != nil {
+			return fmt.Errorf("sensor %d: %w", i, err)
+		}
+		if m == Empty || m.IsStatic() || sn.Channel < 0 {
+			return fmt.Errorf("sensor %d needs a particle material and a channel of 0 or more", i)
+		}
+		r := Span(image.Point{sn.X0, sn.Y0}, image.Point{sn.X1, sn.Y1})
+		if !r.In(bounds) {
+			return fmt.Errorf("sensor %d leaves the world", i)
+		}
+		sensors = append(sensors, Sensor{Rect: r, Material: m, Channel: sn.Channel})
+	}
+	var doors []Door
+	for i, d := range sc.Doors {
+		if d.Channel < 0 {
+			return fmt.Errorf("door %d has a negative channel", i)
+		}
+		r := Span(image.Point{d.X0, d.Y0}, image.Point{d.X1, d.Y1})
+		if !r.In(bounds) {
+			return fmt.Errorf("door %d leaves the world", i)
+		}
+		doors = append(doors, Door{r, d.Channel})
+	}
+	var challenge *Challenge
+	if len(sc.Goals) > 0 || sc.Limit > 0 {
+		challenge = &Challenge{Limit: uint64(max(sc.Limit, 0) * float64(SIMRATE)), start: s.tick}
+		for i, sg := range sc.Goals {
+			g := Goal{
+				Rect:    Span(image.Point{sg.X0, sg.Y0}, image.Point{sg.X1, sg.Y1}),
+				Count:   sg.Count,
+				Channel: sg.Channel,
+				Ticks:   int(sg.Seconds * float64(SIMRATE)),
+			}
+			switch sg.Kind {
+			case "fill":
+				g.Kind = GoalFill
+			case "avoid":
+				g.Kind = GoalAvoid
+			case "hold":
+				g.Kind = GoalHold
+			default:
+				return fmt.Errorf("goal %d: unknown kind %q", i, sg.Kind)
+			}
+			if g.Kind == GoalHold {
+				if sg.Channel <= 0 || g.Ticks <= 0 {
+					return fmt.Errorf("goal %d needs a channel and a time", i)
+				}
+			} else {
+				m, err := ParseMaterial(sg.Material)
+				if err != nil {
+					return fmt.Errorf("goal %d: %w", i, err)
+				}
+				if m == Empty || m.IsStatic() || sg.Count < 0 {
+					return fmt.Errorf("goal %d needs a particle material and a count of 0 or more", i)
+				}
+				if !g.Rect.In(bounds) {
+					return fmt.Errorf("goal %d leaves the world", i)
+				}
+				g.Material = m
+			}
+			challenge.Goals = append(challenge.Goals, g)
+		}
+	}
+
+	if sc.Seed != nil {
+		s.Seed(sc.Seed[0], sc.Seed[1])
+	}
+	for i, sh := range sc.Shapes {
+		m := shapes[i]
+		a, b := image.Point{sh.X0, sh.Y0}, image.Point{sh.X1, sh.Y1}
+		switch sh.Shape {
+		case "rect", "ellipse":
+			r := Span(a, b)
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				for x := r.Min.X; x < r.Max.X; x++ {
+					if sh.Shape == "rect" || InEllipse(r, x, y) {
+						s.SpawnCell(x, y, m, Velocity{})
+					}
+				}
+			}
+		case "line":
+			Line(a.X, a.Y, b.X, b.Y, func(x, y int) {
+				s.SpawnDisc(x, y, max(sh.R, MINRADIUS), m, Velocity{})
+			})
+		case "disc":
+			s.SpawnDisc(a.X, a.Y, sh.R, m, Velocity{})
+		}
+	}
+	for i, st := range sc.Stamps {
+		s.PlaceStamp(stamps[i], image.Point{st.X, st.Y})
+	}
+	s.emitters = append(s.emitters, emitters...)
+	for _, p := range platforms {
+		s.platforms = append(s.platforms, p)
+		s.fill(p.Rect, PlatformCell)
+	}
+	s.portals = append(s.portals, portals...)
+	for _, sn := range sensors {
+		s.sensors = append(s.sensors, sn)
+		s.fill(sn.Rect, SensorCell)
+	}
+	for _, d := range doors {
+		s.doors = append(s.doors, d)
+		s.fill(d.Rect, DoorCell)
+	}
+	if challenge != nil {
+		s.challenge = challenge
+	}
+	// The scene is the starting point, not something to undo.
+	s.history.Reset()
+	return nil
+}
+
+// ToggleTap removes the emitter over p, or else starts a tap there that
+// pours the selected material every tick. Taps are emitters like those of
+// scenes, so either kind can be stopped.
+func (s *Simulation) ToggleTap(p image.Point) {
+	for i, em := range s.emitters {
+		if r := max(em.R, BRUSHRADIUS/2); (p.X-em.X)*(p.X-em.X)+(p.Y-em.Y)*(p.Y-em.Y) <= r*r {
+			s.emitters = slices.Delete(s.emitters, i, i+1)
+			return
+		}
+	}
+	if s.source.material == Empty {
+		return
+	}
+	s.emitters = append(s.emitters, Emitter{p.X, p.Y, TAPRADIUS, s.source.material, 1, 0})
+}
+
+// Emit runs the emitters due on this tick. Emitted material comes through
+// the command buffer, so it is never part of an undo step.
+func (s *Simulation) Emit() {
+	for _, em := range s.emitters {
+		if s.tick%uint64(em.Every) != 0 || em.Channel != 0 && !s.signals[em.Channel] {
+			continue
+		}
+		if wired, live := s.wiredAround(image.Rect(em.X, em.Y, em.X+1, em.Y+1)); !wired || live {
+			s.commands.SpawnDisc(em.X, em.Y, em.R, em.Material, Velocity{})
+		}
+	}
+}
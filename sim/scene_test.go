@@ -0,0 +1,47 @@
+package sim
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestApplySceneRejects applies scenes that go wrong after a good first
+// shape and checks each is turned away with the world left as it was.
+func TestApplySceneRejects(t *testing.T) {
+	smallWorld(t)
+	good := SceneShape{Shape: "rect", Material: "wall", X0: 10, Y0: 140, X1: 190, Y1: 141}
+	for name, sc := range map[string]Scene{
+		"huge disc":        {Shapes: []SceneShape{good, {Shape: "disc", Material: "sand", X0: 100, Y0: 50, R: 1 << 30}}},
+		"negative disc":    {Shapes: []SceneShape{good, {Shape: "disc", Material: "sand", X0: 100, Y0: 50, R: -1}}},
+		"huge line":        {Shapes: []SceneShape{good, {Shape: "line", Material: "wall", X1: 10, Y1: 10, R: MAXRADIUS + 1}}},
+		"huge rect":        {Shapes: []SceneShape{good, {Shape: "rect", Material: "wall", X0: -1 << 30, X1: 1 << 30, Y1: 1 << 30}}},
+		"ellipse past":     {Shapes: []SceneShape{good, {Shape: "ellipse", Material: "wall", X0: 150, Y0: 100, X1: 200, Y1: 120}}},
+		"disc off grid":    {Shapes: []SceneShape{good, {Shape: "disc", Material: "sand", X0: -5, Y0: 50, R: 3}}},
+		"unknown shape":    {Shapes: []SceneShape{good, {Shape: "star", Material: "sand"}}},
+		"unknown stamp":    {Shapes: []SceneShape{good}, Stamps: []SceneStamp{{Name: "nothing", X: 10, Y: 10}}},
+		"huge emitter":     {Shapes: []SceneShape{good}, Emitters: []SceneEmitter{{Material: "sand", X: 10, Y: 10, R: 1 << 30}}},
+		"fast platform":    {Shapes: []SceneShape{good}, Platforms: []ScenePlatform{{W: 10, H: 2, Path: [][2]int{{20, 100}, {50, 100}}, Speed: 1e30}}},
+		"huge portal":      {Shapes: []SceneShape{good}, Portals: []ScenePortal{{A: [2]int{20, 20}, B: [2]int{50, 20}, R: 1 << 30}}},
+		"portal off grid":  {Shapes: []SceneShape{good}, Portals: []ScenePortal{{A: [2]int{20, 20}, B: [2]int{500, 20}, R: 3}}},
+		"sensor past":      {Shapes: []SceneShape{good}, Sensors: []SceneSensor{{Material: "sand", X0: 190, Y0: 10, X1: 210, Y1: 12}}},
+		"door past":        {Shapes: []SceneShape{good}, Doors: []SceneDoor{{X0: 10, Y0: 140, X1: 20, Y1: 1 << 30}}},
+		"goal past":        {Shapes: []SceneShape{good}, Goals: []SceneGoal{{Kind: "fill", Material: "sand", X1: 1 << 30, Y1: 10, Count: 1}}},
+		"bad goal at last": {Shapes: []SceneShape{good}, Emitters: []SceneEmitter{{Material: "sand", X: 10, Y: 10, R: 3}}, Goals: []SceneGoal{{Kind: "win"}}},
+	} {
+		s := NewSimulation(nil)
+		var before, after bytes.Buffer
+		if err := s.Save(&before); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.ApplyScene(sc); err == nil {
+			t.Errorf("%s: applied", name)
+			continue
+		}
+		if err := s.Save(&after); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(before.Bytes(), after.Bytes()) || s.challenge != nil {
+			t.Errorf("%s: half applied", name)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jdavasligil/go-ecs"
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/jdavasligil/sandbox/grid"
+	"github.com/jdavasligil/sandbox/input"
+)
+
+const SCRIPTBUDGET = 50 * time.Millisecond // Lua time allowed per system per tick
+
+// Script is a Lua file extending the sandbox through the sandbox table:
+//
+//	sandbox.width, sandbox.height   size of the world in cells
+//	sandbox.tick()                  ticks simulated so far
+//	sandbox.get(x, y)               material name in a cell, or nil if empty
+//	sandbox.spawn(x, y, m, vx, vy)  place material m, with optional velocity
+//	sandbox.disc(x, y, r, m)        fill a disc with material m
+//	sandbox.erase(x, y, r)          erase a disc, radius 0 if left out
+//	sandbox.element{name=, color=, flows=, static=, update=}
+//	                                define a material; update(x, y) runs
+//	                                each tick for each of its particles
+//	sandbox.brush(fn)               paint with fn(x, y, r, m) instead of discs
+//	sandbox.at(tick, fn)            call fn once on the given tick
+//	sandbox.every(n, fn)            call fn every n ticks
+//
+// Only the base, table, string and math libraries are open, without the
+// functions that load files, so a script cannot reach the file system.
+// math.random draws from the simulation's generator, so runs with the same
+// seed replay alike. Scripts only run while physics does, and their edits
+// are never part of an undo step, except for brushes, which paint strokes.
+// Discs are no larger than MAXRADIUS, whatever radius is asked for.
+type Script struct {
+	path   string
+	L      *lua.LState
+	sim    *Simulation // the simulation being called for
+	loaded bool        // elements may only be defined while loading
+
+	brush  *lua.LFunction
+	v      Velocity // brush motion, given to discs painted by the brush
+	timers []scriptTimer
+	cells  []Position // scratch for element updates
+}
+
+type scriptTimer struct {
+	tick  uint64 // when at fires, or zero
+	every uint64 // period of every, or zero
+	fn    *lua.LFunction
+}
+
+// LoadScript runs the script at path, registering the elements it defines.
+// Call it before creating the simulation the script is attached to.
+func LoadScript(path string) (*Script, error) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile", "load", "loadstring", "require", "module"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+	sc := &Script{path: path, L: L}
+	math := L.GetGlobal("math").(*lua.LTable)
+	L.SetField(math, "random", L.NewFunction(sc.random))
+	L.SetField(math, "randomseed", lua.LNil)
+
+	api := L.NewTable()
+	L.SetField(api, "width", lua.LNumber(grid.WIDTH))
+	L.SetField(api, "height", lua.LNumber(grid.HEIGHT))
+	for name, fn := range map[string]lua.LGFunction{
+		"tick":    sc.tick,
+		"get":     sc.get,
+		"spawn":   sc.spawn,
+		"disc":    sc.disc,
+		"erase":   sc.erase,
+		"element": sc.element,
+		"brush":   sc.setBrush,
+		"at":      sc.at,
+		"every":   sc.every,
+	} {
+		L.SetField(api, name, L.NewFunction(fn))
+	}
+	L.SetGlobal("sandbox", api)
+
+	if err := L.DoFile(path); err != nil {
+		L.Close()
+		return nil, err
+	}
+	sc.loaded = true
+	return sc, nil
+}
+
+// Attach runs the script's timers and brush on sim.
+func (sc *Script) Attach(sim *Simulation) {
+	sc.sim = sim
+	sim.systems.Add("script", StageSpawn, sc)
+	if sc.brush != nil {
+		sim.brush = sc.paint
+	}
+}
+
+// Run fires the timers due on this tick.
+func (sc *Script) Run(s *Simulation) {
+	defer sc.enter(s)()
+	kept := sc.timers[:0]
+	for _, t := range sc.timers {
+		due := t.tick == s.tick || t.every > 0 && s.tick%t.every == 0
+		if due && !sc.call(t.fn) {
+			continue
+		}
+		if t.every > 0 || t.tick > s.tick {
+			kept = append(kept, t)
+		}
+	}
+	sc.timers = kept
+}
+
+// enter points the script at s for a system's run within SCRIPTBUDGET, and
+// returns the function ending it. Edits stay out of any stroke.
+func (sc *Script) enter(s *Simulation) func() {
+	sc.sim = s
+	stroke := s.history.current
+	s.history.current = nil
+	ctx, cancel := context.WithTimeout(context.Background(), SCRIPTBUDGET)
+	sc.L.SetContext(ctx)
+	return func() {
+		sc.L.RemoveContext()
+		cancel()
+		s.history.current = stroke
+	}
+}
+
+// call calls fn with args, logging and reporting false if it fails.
+func (sc *Script) call(fn *lua.LFunction, args ...lua.LValue) bool {
+	if err := sc.L.CallByParam(lua.P{Fn: fn, Protect: true}, args...); err != nil {
+		scriptLog.Error("script failed", "path", sc.path, "err", err)
+		return false
+	}
+	return true
+}
+
+// paint is the Simulation brush of a script calling sandbox.brush.
+func (sc *Script) paint(x, y, r int, m Material, v Velocity) {
+	sc.v = v
+	defer func() { sc.v = Velocity{} }()
+	ctx, cancel := context.WithTimeout(context.Background(), SCRIPTBUDGET)
+	defer cancel()
+	sc.L.SetContext(ctx)
+	defer sc.L.RemoveContext()
+	if !sc.call(sc.brush, lua.LNumber(x), lua.LNumber(y), lua.LNumber(r), lua.LString(m.String())) {
+		sc.sim.brush = nil
+	}
+}
+
+// update runs fn for each particle of material m.
+func (sc *Script) update(s *Simulation, m Material, fn *lua.LFunction) bool {
+	defer sc.enter(s)()
+	// Collect first, since fn may add and remove particles.
+	sc.cells = sc.cells[:0]
+	ents, mats := ecs.Query[Material](&s.world)
+	for i, e := range ents {
+		if mats[i] == m {
+			p, _ := ecs.Get[Position](&s.world, e)
+			sc.cells = append(sc.cells, p)
+		}
+	}
+	for _, p := range sc.cells {
+		x, y := int(p.X), int(p.Y)
+		if s.grid.At(x, y) != m {
+			continue
+		}
+		if !sc.call(fn, lua.LNumber(x), lua.LNumber(y)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (sc *Script) checkMaterial(L *lua.LState, n int) Material {
+	m, err := ParseMaterial(L.CheckString(n))
+	if err != nil {
+		L.ArgError(n, err.Error())
+	}
+	return m
+}
+
+func (sc *Script) random(L *lua.LState) int {
+	f := float64(sc.sim.rng.Float32())
+	switch L.GetTop() {
+	case 0:
+		L.Push(lua.LNumber(f))
+	case 1:
+		L.Push(lua.LNumber(1 + int(f*float64(L.CheckInt(1)))))
+	default:
+		lo, hi := L.CheckInt(1), L.CheckInt(2)
+		L.Push(lua.LNumber(lo + int(f*float64(hi-lo+1))))
+	}
+	return 1
+}
+
+func (sc *Script) tick(L *lua.LState) int {
+	L.Push(lua.LNumber(sc.sim.tick))
+	return 1
+}
+
+func (sc *Script) get(L *lua.LState) int {
+	x, y := L.CheckInt(1), L.CheckInt(2)
+	if x < 0 || y < 0 || x >= grid.WIDTH || y >= grid.HEIGHT || !sc.sim.grid.IsSet(x, y) {
+		L.Push(lua.LNil)
+	} else {
+		L.Push(lua.LString(sc.sim.grid.At(x, y).String()))
+	}
+	return 1
+}
+
+func (sc *Script) spawn(L *lua.LState) int {
+	x, y, m := L.CheckInt(1), L.CheckInt(2), sc.checkMaterial(L, 3)
+	v := Velocity{float32(L.OptNumber(4, 0)), float32(L.OptNumber(5, 0))}
+	sc.sim.SpawnCell(x, y, m, v)
+	return 0
+}
+
+func (sc *Script) disc(L *lua.LState) int {
+	x, y, r, m := L.CheckInt(1), L.CheckInt(2), L.CheckInt(3), sc.checkMaterial(L, 4)
+	sc.sim.SpawnDisc(x, y, r, m, sc.v)
+	return 0
+}
+
+func (sc *Script) erase(L *lua.LState) int {
+	sc.sim.EraseDisc(L.CheckInt(1), L.CheckInt(2), L.OptInt(3, 0))
+	return 0
+}
+
+func (sc *Script) element(L *lua.LState) int {
+	if sc.loaded {
+		L.RaiseError("elements must be defined as the script loads")
+	}
+	t := L.CheckTable(1)
+	e := Element{
+		Name:   lua.LVAsString(t.RawGetString("name")),
+		Flows:  lua.LVAsBool(t.RawGetString("flows")),
+		Static: lua.LVAsBool(t.RawGetString("static")),
+	}
+	if e.Name == "" {
+		L.ArgError(1, "element needs a name")
+	}
+	if slices.ContainsFunc(Elements, func(o Element) bool { return o.Name == e.Name }) {
+		L.ArgError(1, fmt.Sprintf("material %q already exists", e.Name))
+	}
+	if input.IsCommand(e.Name) {
+		L.ArgError(1, fmt.Sprintf("%q is the name of a command", e.Name))
+	}
+	var err error
+	if e.Color, err = ParseHex(lua.LVAsString(t.RawGetString("color"))); err != nil {
+		L.ArgError(1, err.Error())
+	}
+	var m Material
+	if fn, ok := t.RawGetString("update").(*lua.LFunction); ok {
+		e.Update = SystemFunc(func(s *Simulation) {
+			if fn != nil && !sc.update(s, m, fn) {
+				fn = nil
+			}
+		})
+	}
+	m = RegisterElement(e)
+	L.Push(lua.LString(e.Name))
+	return 1
+}
+
+func (sc *Script) setBrush(L *lua.LState) int {
+	sc.brush = L.CheckFunction(1)
+	if sc.sim != nil {
+		sc.sim.brush = sc.paint
+	}
+	return 0
+}
+
+func (sc *Script) at(L *lua.LState) int {
+	sc.timers = append(sc.timers, scriptTimer{tick: uint64(L.CheckInt(1)), fn: L.CheckFunction(2)})
+	return 0
+}
+
+func (sc *Script) every(L *lua.LState) int {
+	n := L.CheckInt(1)
+	if n <= 0 {
+		L.ArgError(1, "period must be positive")
+	}
+	sc.timers = append(sc.timers, scriptTimer{every: uint64(n), fn: L.CheckFunction(2)})
+	return 0
+}
@@ -0,0 +1,91 @@
+package sim
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/jdavasligil/go-ecs"
+)
+
+// SensorCell and DoorCell are the materials sensors and doors are drawn in.
+// Only scenes place them, so they cannot be selected.
+var SensorCell, DoorCell Material
+
+func registerSensors() {
+	SensorCell = RegisterElement(Element{
+		Name:   "sensor",
+		Color:  color.RGBA{0xb0, 0x3a, 0x3a, 0xff},
+		Static: true,
+		Hidden: true,
+	})
+	DoorCell = RegisterElement(Element{
+		Name:   "door",
+		Color:  color.RGBA{0x7a, 0x5a, 0x8c, 0xff},
+		Static: true,
+		Hidden: true,
+	})
+}
+
+// Sensor is a solid pad that detects particles of one material touching it,
+// or inside it once its cells are erased. While it does, it drives the
+// signal on its channel, which opens the doors and runs the emitters
+// listening to that channel, and powers the wire touching it. A channel is
+// on while any of its sensors is.
+type Sensor struct {
+	Rect     image.Rectangle
+	Material Material
+	Channel  int // 0 to drive wire alone
+
+	on bool
+}
+
+// Door is a solid block that opens, vanishing from the grids, while the
+// signal on its channel is on or live wire touches it, and closes again
+// around anything in its way once neither is.
+type Door struct {
+	Rect    image.Rectangle
+	Channel int // 0 to open for wire alone
+}
+
+// Sense updates each sensor from the particles touching it, publishing
+// EventSensed for one of them as a sensor comes on, powers the wires, then
+// opens or closes the doors to match their channels and wires.
+func (s *Simulation) Sense() {
+	clear(s.signals)
+	for i := range s.sensors {
+		sn := &s.sensors[i]
+		s.fill(sn.Rect, SensorCell)
+		var touched ecs.Entity
+		for _, e := range s.particlesAt(sn.Rect.Inset(-1)) {
+			if m, _ := ecs.Get[Material](&s.world, e); m == sn.Material {
+				touched = e
+				break
+			}
+		}
+		if touched != 0 && !sn.on && s.bus.Wants(EventSensed) {
+			p, _ := ecs.Get[Position](&s.world, touched)
+			s.bus.Publish(Event{EventSensed, touched, int(p.X), int(p.Y), sn.Material})
+		}
+		sn.on = touched != 0
+		if sn.on && sn.Channel != 0 {
+			s.signals[sn.Channel] = true
+		}
+	}
+	s.power()
+	for _, d := range s.doors {
+		if _, live := s.wiredAround(d.Rect); !live && (d.Channel == 0 || !s.signals[d.Channel]) {
+			s.fill(d.Rect, DoorCell)
+			continue
+		}
+		r := d.Rect.Intersect(s.grid.Bounds())
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if s.grid.At(x, y) == DoorCell {
+					s.grid.Clear(x, y)
+					s.col.Clear(x, y)
+					s.chunks.Wake(x, y)
+				}
+			}
+		}
+	}
+}
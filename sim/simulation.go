@@ -0,0 +1,755 @@
+// Package sim is the engine of the sandbox: the falling sand simulation,
+// its materials, tools and scenes, and saving, loading and replaying it.
+// Frontends embed it through Simulation.
+package sim
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jdavasligil/go-ecs"
+	"golang.org/x/mobile/event/mouse"
+
+	"github.com/jdavasligil/sandbox/grid"
+	"github.com/jdavasligil/sandbox/input"
+)
+
+// Simulation is a world and everything that runs it. It is not safe for
+// concurrent use: a frontend runs it on one goroutine, stepping it and
+// handing it input and commands between ticks.
+type Simulation struct {
+	world   ecs.World
+	grid    MaterialGrid // material drawn in each cell
+	col     grid.Grid    // cells occupied by resting particles and walls
+	chunks  Chunks       // resting particles by chunk
+	hash    SpatialHash  // every particle by position
+	pool    *Pool        // physics workers, started on first use
+	scratch physicsScratch
+	motion  []Motion // particles moved by the last tick
+	systems Scheduler
+	bus     Bus
+	brush   func(x, y, r int, m Material, v Velocity) // paints instead of SpawnDisc, if set
+	field   Field
+	source  Source
+	history History
+	stamps  []Stamp
+	stamp   int // index of the selected stamp
+
+	symmetry Symmetry // repeats brush and line strokes
+
+	// commands holds the changes the running system queued, carried out
+	// once it returns.
+	commands Commands
+	// moved marks the particles whose position was set or changed this
+	// tick, with where each was before.
+	moved Changes[Position]
+
+	// boundary marks the walls painted by ToolBoundary, which nothing
+	// else erases.
+	boundary grid.Grid
+
+	emitters  []Emitter
+	platforms []Platform
+	portals   []Portal
+	riding    []ecs.Entity // particles resting on conveyors
+	conveyed  float32      // cells owed to the riders
+	opening   *Portal      // end opened by TogglePortal, awaiting its pair
+	sensors   []Sensor
+	doors     []Door
+	signals   map[int]bool // channels switched on by sensors this tick
+	challenge *Challenge   // goals of the scene being played, if any
+
+	// The cells of fans, wires and gates, relisted when staticStale.
+	fans, wires, gates []image.Point
+	staticStale        bool
+	lit                grid.Grid     // wire cells powered this tick
+	surge              []image.Point // scratch for power
+
+	sinking     []sinking // particles resting against drains
+	drainCredit float64   // particles that may be drained this tick
+
+	selection image.Rectangle // region marked by the select tool
+	clipboard Clipboard
+
+	// restore is the autosave offered at startup, until it is taken or
+	// the first stroke is drawn.
+	restore string
+
+	peers []Presence // cursors of the players joined to -host
+
+	sound    *Mixer   // nil without -sound
+	observer Observer // nil unless watched, such as by -metrics
+
+	// rng jitters spawned particles. pcg is its source, kept so the
+	// generator state can be saved, and seed is what it started from.
+	seed [2]uint64
+	pcg  *rand.PCG
+	rng  *rand.Rand
+
+	tick uint64 // ticks simulated, including paused ones
+
+	// SavePath is the file used by ActionSave and ActionLoad.
+	SavePath string
+	// Check has every tick end with CheckInvariants, exiting on the first
+	// fault.
+	Check bool
+	// DrainRate is how many particles drains swallow a second, or 0 for
+	// no limit.
+	DrainRate float64
+
+	paused bool // physics frozen; drawing still applies
+	steps  int  // ticks to run despite the pause
+	speed  int  // index into SPEEDS
+}
+
+func NewSimulation(stamps []Stamp) *Simulation {
+	s := &Simulation{
+		stamps:   stamps,
+		world:    NewWorld(),
+		grid:     NewMaterialGrid(),
+		col:      grid.NewGrid(),
+		boundary: grid.NewGrid(),
+		lit:      grid.NewGrid(),
+		chunks:   NewChunks(),
+		hash:     NewSpatialHash(),
+		field:    NewField(),
+		source:   Source{radius: BRUSHRADIUS, material: Sand},
+		history:  NewHistory(),
+		systems:  NewScheduler(),
+		signals:  make(map[int]bool),
+		speed:    2, // 1x
+	}
+	// A random seed that -seed can repeat.
+	s.Seed(rand.Uint64(), 0)
+	s.bus.Subscribe(EventSettled, s.sink)
+	s.bus.Subscribe(EventSettled, s.ride)
+	return s
+}
+
+// Close stops the physics workers of s once it is no longer needed.
+func (s *Simulation) Close() {
+	if s.pool != nil {
+		s.pool.Close()
+		s.pool = nil
+	}
+}
+
+// Seed restarts the random generator from the given seed.
+func (s *Simulation) Seed(seed1, seed2 uint64) {
+	s.seed = [2]uint64{seed1, seed2}
+	s.pcg = rand.NewPCG(seed1, seed2)
+	s.rng = rand.New(s.pcg)
+}
+
+// Seeds returns the seed the random generator last started from.
+func (s *Simulation) Seeds() [2]uint64 {
+	return s.seed
+}
+
+// Observer is told about each tick once it is done.
+type Observer interface {
+	// Observe counts a tick that took took and moved moved particles.
+	Observe(took time.Duration, moved int)
+}
+
+// Watch has o observe every tick from now on, in place of any observer
+// before it.
+func (s *Simulation) Watch(o Observer) {
+	s.observer = o
+}
+
+// Systems returns the scheduler of the systems each tick runs, for adding
+// more or turning them off.
+func (s *Simulation) Systems() *Scheduler {
+	return &s.systems
+}
+
+// SetSound plays the events of s on m.
+func (s *Simulation) SetSound(m *Mixer) {
+	s.sound = m
+	m.Listen(&s.bus)
+}
+
+// OfferRestore offers the autosave at path for ActionRestore to load,
+// until it is taken or the first stroke is drawn.
+func (s *Simulation) OfferRestore(path string) {
+	s.restore = path
+}
+
+// World returns the entities of the particles.
+func (s *Simulation) World() *ecs.World {
+	return &s.world
+}
+
+// Grid returns the material drawn in each cell.
+func (s *Simulation) Grid() *MaterialGrid {
+	return &s.grid
+}
+
+// Field returns the velocity of the particle in each cell.
+func (s *Simulation) Field() *Field {
+	return &s.field
+}
+
+// Motion returns the particles the last tick moved.
+func (s *Simulation) Motion() []Motion {
+	return s.motion
+}
+
+// Taps returns the emitters pouring into the world.
+func (s *Simulation) Taps() []Emitter {
+	return s.emitters
+}
+
+// Portals appends the portals to dst and returns the result, including an
+// end opened but not yet linked.
+func (s *Simulation) Portals(dst []Portal) []Portal {
+	dst = append(dst, s.portals...)
+	if s.opening != nil {
+		dst = append(dst, *s.opening)
+	}
+	return dst
+}
+
+// Tick returns how many ticks have been simulated, including paused ones.
+func (s *Simulation) Tick() uint64 {
+	return s.tick
+}
+
+// Speed returns the multiplier of the simulation speed.
+func (s *Simulation) Speed() float64 {
+	return SPEEDS[s.speed]
+}
+
+// SetPaused freezes physics or lets it run again. Drawing still applies
+// while paused.
+func (s *Simulation) SetPaused(paused bool) {
+	s.paused = paused
+}
+
+// Sweep compacts the stores of the particle components, giving back the
+// memory of particles since removed.
+func (s *Simulation) Sweep() {
+	ecs.Sweep[Position](&s.world)
+	ecs.Sweep[Velocity](&s.world)
+	ecs.Sweep[Falling](&s.world)
+	ecs.Sweep[Material](&s.world)
+}
+
+// Paused reports whether physics is frozen.
+func (s *Simulation) Paused() bool {
+	return s.paused
+}
+
+// Gravity returns the downward acceleration of falling particles in
+// px/s/s.
+func (s *Simulation) Gravity() float32 {
+	return GRAVITY
+}
+
+// SetGravity sets GRAVITY, which all simulations share, to g. Like any other
+// change to s, call it between ticks on the goroutine stepping s, since
+// physics reads it while a tick runs. g must be finite.
+func (s *Simulation) SetGravity(g float32) error {
+	if math.IsNaN(float64(g)) || math.IsInf(float64(g), 0) {
+		return fmt.Errorf("gravity %v is not finite", g)
+	}
+	GRAVITY = g
+	return nil
+}
+
+// Resting returns how many cells resting particles and walls hold.
+func (s *Simulation) Resting() int {
+	return s.col.Count()
+}
+
+// NewWorld returns an empty world with the particle components initialized.
+func NewWorld() ecs.World {
+	w := ecs.NewWorld(ecs.WorldOptions{
+		EntityLimit:    uint32(grid.WIDTH * grid.HEIGHT),
+		RecycleLimit:   1024,
+		ComponentLimit: 255,
+	})
+	InitializeWorld(&w)
+	return w
+}
+
+// Clear destroys every particle and wall and forgets the undo history.
+func (s *Simulation) Clear() {
+	s.world = NewWorld()
+	s.grid.Reset()
+	s.col.Reset()
+	s.boundary.Reset()
+	s.chunks.Reset()
+	s.hash.Reset()
+	s.moved.Reset()
+	s.field.Reset()
+	s.history.Reset()
+	s.sinking = s.sinking[:0]
+	s.riding = s.riding[:0]
+	s.staticStale = true
+}
+
+// Unload clears the world and drops everything a scene adds besides cells:
+// emitters, platforms, portals, sensors, doors and any challenge.
+func (s *Simulation) Unload() {
+	s.Clear()
+	s.emitters = s.emitters[:0]
+	s.platforms = s.platforms[:0]
+	s.portals = s.portals[:0]
+	s.opening = nil
+	s.sensors = s.sensors[:0]
+	s.doors = s.doors[:0]
+	clear(s.signals)
+	s.challenge = nil
+	s.selection = image.Rectangle{}
+}
+
+// HandleMouse moves the brush and starts or finishes strokes.
+func (s *Simulation) HandleMouse(e mouse.Event) {
+	source := &s.source
+	if e.Button.IsWheel() {
+		source.Resize(e.Button)
+		return
+	}
+	source.p.X = max(min(e.X, float32(grid.WIDTH-1)), 0)
+	source.p.Y = max(min(e.Y, float32(grid.HEIGHT-1)), 0)
+	if e.Direction == mouse.DirPress {
+		source.button = e.Button
+		source.anchor = source.p
+		source.stroke = StrokeTool(e, source.tool)
+		s.history.Begin()
+		s.restore = ""
+	}
+	if e.Direction == mouse.DirRelease && source.isActive {
+		if source.stroke != ToolBrush {
+			s.ApplyStroke()
+		}
+		s.history.End()
+	}
+	source.isActive = (source.isActive || (e.Direction == mouse.DirPress)) && (e.Direction != mouse.DirRelease)
+}
+
+// Step advances one tick, running the scheduled systems stage by stage.
+// While paused only StageInput runs, so the brush still paints.
+func (s *Simulation) Step() {
+	start := time.Now()
+	s.moved.Reset()
+	s.systems.Run(s, StageInput)
+	if !s.paused || s.steps > 0 {
+		for stage := StageInput + 1; stage < STAGES; stage++ {
+			s.systems.Run(s, stage)
+		}
+		s.steps = max(s.steps-1, 0)
+	}
+	s.motion = s.Moves(s.motion)
+	s.source.prev = s.source.p
+	s.tick++
+	if s.observer != nil {
+		s.observer.Observe(time.Since(start), len(s.moved.Ents()))
+	}
+	if s.Check {
+		if err := s.CheckInvariants(); err != nil {
+			fatal(simLog, "invariant broken", "tick", s.tick, "err", err)
+		}
+	}
+}
+
+// Stats returns the counters shown by the HUD. TPS and Dropped are measured
+// by whoever runs the ticks and left for them to fill in.
+func (s *Simulation) Stats() Stats {
+	falling, _ := ecs.Query[Falling](&s.world)
+	return Stats{
+		Target:    int(math.Round(float64(SIMRATE) * SPEEDS[s.speed])),
+		Particles: s.world.EntityCount(),
+		Falling:   len(falling),
+		Budget:    MAXSAND,
+	}
+}
+
+// MaterialStats writes over dst the particles of each material there are
+// any of, sharing out the memory of the particle components by count, and
+// returns it with the memory the world takes in all.
+func (s *Simulation) MaterialStats(dst []MaterialStat) ([]MaterialStat, uintptr) {
+	w := &s.world
+	parts := ecs.MemUsage[Position](w) + ecs.MemUsage[Velocity](w) + ecs.MemUsage[Falling](w) + ecs.MemUsage[Material](w)
+	_, ms := ecs.Query[Material](w)
+	var counts [math.MaxUint8 + 1]int
+	for _, m := range ms {
+		counts[m]++
+	}
+	dst = dst[:0]
+	for m, n := range counts[:len(Elements)] {
+		if n > 0 {
+			dst = append(dst, MaterialStat{Material(m), n, parts * uintptr(n) / uintptr(len(ms))})
+		}
+	}
+	return dst, w.MemUsage() + parts
+}
+
+// Status returns the input state the renderer draws previews from.
+func (s *Simulation) Status() Status {
+	source := &s.source
+	st := Status{
+		Radius:    source.radius,
+		Material:  source.material,
+		Tool:      source.tool,
+		Paused:    s.paused,
+		Speed:     SPEEDS[s.speed],
+		Symmetry:  s.symmetry,
+		Selection: s.selection,
+		Restore:   s.restore != "",
+		Goal:      s.GoalLine(),
+	}
+	if s.challenge != nil {
+		st.Outcome = s.challenge.Outcome
+	}
+	if len(s.stamps) > 0 {
+		st.Stamp = s.stamps[s.stamp].Name
+	}
+	if source.isActive && source.stroke != ToolBrush && source.stroke != ToolBoundary {
+		st.Stroke = source.stroke
+		st.Anchor = image.Point{int(source.anchor.X), int(source.anchor.Y)}
+	}
+	return st
+}
+
+// Paint applies the brush for one tick while a brush or boundary stroke is
+// held. Other tools act once their drag is released.
+func (s *Simulation) Paint() {
+	source := &s.source
+	if source.isActive && source.stroke == ToolBoundary {
+		for _, t := range s.symmetry.Transforms() {
+			p := t(source.p)
+			s.PaintBoundary(int(p.X), int(p.Y), source.radius, source.button != mouse.ButtonRight)
+		}
+		return
+	}
+	if !source.isActive || source.stroke != ToolBrush {
+		return
+	}
+	if source.IsErasing() {
+		s.DestroySand(source.radius)
+	} else if !s.grid.IsSet(int(source.p.X), int(source.p.Y)) && s.world.EntityCount() < MAXSAND {
+		s.SpawnMaterial(source.radius)
+	}
+}
+
+// SpawnMaterial fills the brush disc of radius r around the source with its
+// material. Particles inherit the brush motion.
+func (s *Simulation) SpawnMaterial(r int) {
+	source := &s.source
+	dx := (source.p.X - source.prev.X)
+	dy := (source.p.Y - source.prev.Y)
+	v := Velocity{dx / DELTA / 2.0, dy / DELTA / 2.0}
+	for _, t := range s.symmetry.Transforms() {
+		p := t(source.p)
+		if s.brush != nil {
+			s.brush(int(p.X), int(p.Y), r, source.material, t.Vector(v))
+			continue
+		}
+		s.SpawnDisc(int(p.X), int(p.Y), r, source.material, t.Vector(v))
+	}
+	source.v = v
+}
+
+// SpawnDisc fills the disc of radius r centered on (h, k) with material m.
+// Radii past MAXRADIUS are cut down to it, so no caller can stall a tick
+// with a huge disc.
+func (s *Simulation) SpawnDisc(h, k, r int, m Material, v Velocity) {
+	r = min(r, MAXRADIUS)
+	for y := k - r; y < k+r; y++ {
+		for x := h - r; x < h+r; x++ {
+			if (x-h)*(x-h)+(y-k)*(y-k) <= r*r {
+				s.SpawnCell(x, y, m, v)
+			}
+		}
+	}
+}
+
+// SpawnCell places material m at (x, y) unless the cell is occupied or off the
+// grid. Particles start at velocity v plus some jitter, while static
+// materials are written straight into the grids.
+func (s *Simulation) SpawnCell(x, y int, m Material, v Velocity) {
+	if x < 0 || y < 0 || x >= grid.WIDTH || y >= grid.HEIGHT || s.grid.IsSet(x, y) {
+		return
+	}
+	if m.IsStatic() {
+		s.grid.Set(x, y, m)
+		s.col.Set(x, y)
+		s.history.Placed(Cell{x, y, m})
+		s.placed(x, y)
+		return
+	}
+	if s.isFull() {
+		return
+	}
+	e := s.world.NewEntity()
+	vx := v.X + (s.rng.Float32()-s.rng.Float32())/DELTA/2.0
+	vy := v.Y + (s.rng.Float32()-s.rng.Float32())/DELTA/2.0
+	p := Position{float32(x), float32(y)}
+	ecs.Add(&s.world, e, p)
+	ecs.Add(&s.world, e, Velocity{vx, vy})
+	ecs.Add(&s.world, e, Falling{})
+	ecs.Add(&s.world, e, m)
+	s.hash.Insert(e, x, y)
+	s.moved.Mark(e, p)
+	s.history.Added(e)
+	s.bus.Publish(Event{EventSpawned, e, x, y, m})
+}
+
+// placed starts whatever static material newly placed at (x, y) does to
+// its surroundings.
+func (s *Simulation) placed(x, y int) {
+	s.drainAt(x, y)
+	s.conveyAt(x, y)
+	s.staticStale = s.staticStale || s.grid.At(x, y).Listed()
+}
+
+// Listed reports whether the cells of material m are kept in a list of
+// their own, as fans, wires and gates are.
+func (m Material) Listed() bool {
+	return m.IsFan() || m.Conducts() || Elements[m].Logic != NoLogic
+}
+
+// relist finds the cells of fans, wires and gates again.
+func (s *Simulation) relist() {
+	s.fans, s.wires, s.gates = s.fans[:0], s.wires[:0], s.gates[:0]
+	for i, m := range s.grid.data {
+		p := image.Point{i % grid.WIDTH, i / grid.WIDTH}
+		switch {
+		case m.IsFan():
+			s.fans = append(s.fans, p)
+		case m.Conducts():
+			s.wires = append(s.wires, p)
+		case Elements[m].Logic != NoLogic:
+			s.gates = append(s.gates, p)
+		}
+	}
+	s.staticStale = false
+}
+
+// isFull reports whether the world has as many particles as it can hold.
+// Falling particles may share cells, so they can outnumber the free ones.
+func (s *Simulation) isFull() bool {
+	return s.world.EntityCount() >= s.world.EntityLimit()
+}
+
+// DestroySand erases everything within radius of the source and its images.
+func (s *Simulation) DestroySand(radius int) {
+	for _, t := range s.symmetry.Transforms() {
+		p := t(s.source.p)
+		s.EraseDisc(int(p.X), int(p.Y), radius)
+	}
+}
+
+// EraseDisc erases everything within radius of (h, k), cutting radius down
+// to MAXRADIUS as SpawnDisc does.
+func (s *Simulation) EraseDisc(h, k, radius int) {
+	radius = min(radius, MAXRADIUS)
+	r := image.Rect(h-radius, k-radius, h+radius+1, k+radius+1)
+	s.EraseRegion(r, func(x, y int) bool {
+		return (x-h)*(x-h)+(y-k)*(y-k) <= radius*radius
+	})
+}
+
+// EraseRegion erases the cells of r for which inside reports true: walls are
+// cleared from the grids and overlapping particles are destroyed. Boundaries
+// are left standing.
+func (s *Simulation) EraseRegion(r image.Rectangle, inside func(x, y int) bool) {
+	r = r.Intersect(s.grid.Bounds())
+	in := func(x, y int) bool {
+		return (image.Point{x, y}).In(r) && inside(x, y)
+	}
+
+	// Collect first since removal reorders the buckets.
+	doomed := make([]ecs.Entity, 0)
+	for _, e := range s.hash.Within(r, nil) {
+		if p, _ := ecs.Get[Position](&s.world, e); in(int(p.X), int(p.Y)) {
+			doomed = append(doomed, e)
+		}
+	}
+	for _, e := range doomed {
+		if p, ok := s.RemoveParticle(e); ok {
+			s.history.Removed(p)
+		}
+	}
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if in(x, y) && s.grid.IsSet(x, y) && !s.boundary.IsSet(x, y) {
+				if m := s.grid.At(x, y); m.IsStatic() {
+					s.history.Cleared(Cell{x, y, m.Unlit()})
+					s.staticStale = s.staticStale || m.Listed()
+				}
+				s.grid.Clear(x, y)
+				s.col.Clear(x, y)
+				s.chunks.Wake(x, y)
+				s.field.Set(x, y, Velocity{})
+			}
+		}
+	}
+}
+
+// RemoveParticle clears the cell held by particle e and destroys it,
+// returning what it was so it can be restored.
+func (s *Simulation) RemoveParticle(e ecs.Entity) (Particle, bool) {
+	pos, ok := ecs.Get[Position](&s.world, e)
+	if !ok {
+		return Particle{}, false
+	}
+	v, _ := ecs.Get[Velocity](&s.world, e)
+	m, _ := ecs.Get[Material](&s.world, e)
+	_, falling := ecs.Get[Falling](&s.world, e)
+	x, y := int(pos.X), int(pos.Y)
+	if s.grid.At(x, y) == m {
+		s.grid.Clear(x, y)
+	}
+	if !falling {
+		s.col.Clear(x, y)
+		s.chunks.Wake(x, y)
+	}
+	s.field.Set(x, y, Velocity{})
+	s.hash.Remove(e, x, y)
+	s.moved.Forget(e)
+	Despawn(&s.world, e)
+	s.bus.Publish(Event{EventDestroyed, e, x, y, m})
+	return Particle{E: e, P: pos, V: v, M: m, Falling: falling}, true
+}
+
+// RestoreParticle brings back a removed particle under a new entity, unless
+// its cell has since been filled.
+func (s *Simulation) RestoreParticle(p Particle) (ecs.Entity, bool) {
+	x, y := int(p.P.X), int(p.P.Y)
+	if s.grid.IsSet(x, y) || s.isFull() {
+		return 0, false
+	}
+	e := s.world.NewEntity()
+	ecs.Add(&s.world, e, p.P)
+	ecs.Add(&s.world, e, p.V)
+	ecs.Add(&s.world, e, p.M)
+	if p.Falling {
+		ecs.Add(&s.world, e, Falling{})
+	} else {
+		s.col.Set(x, y)
+		s.chunks.Rest(e, x, y)
+	}
+	s.grid.Set(x, y, p.M)
+	s.hash.Insert(e, x, y)
+	s.moved.Mark(e, p.P)
+	s.bus.Publish(Event{EventSpawned, e, x, y, p.M})
+	return e, true
+}
+
+// PlaceObstacles turns the dark, opaque pixels of img into walls. Light or
+// transparent pixels leave their cells alone.
+func (s *Simulation) PlaceObstacles(img *image.RGBA) {
+	b := img.Bounds().Intersect(s.grid.Bounds())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			luma := (299*int(c.R) + 587*int(c.G) + 114*int(c.B)) / 1000
+			if c.A >= 128 && luma < OBSTACLELUMA*int(c.A)/255 {
+				s.SpawnCell(x, y, Wall, Velocity{})
+			}
+		}
+	}
+}
+
+// Handle applies one input event: a mouse event, a Material or Tool to
+// select, or an Action.
+func (s *Simulation) Handle(event any) {
+	switch e := event.(type) {
+	case mouse.Event:
+		s.HandleMouse(e)
+	case Material:
+		s.source.material = e
+	case Tool:
+		s.source.tool = e
+	case Preset:
+		s.PlayPreset(e)
+	case input.Action:
+		switch e {
+		case input.ActionUndo:
+			s.Undo()
+		case input.ActionRedo:
+			s.Redo()
+		case input.ActionPause:
+			s.paused = !s.paused
+		case input.ActionStep:
+			if s.paused {
+				s.steps++
+			}
+		case input.ActionClear:
+			s.Clear()
+		case input.ActionNextMaterial, input.ActionPrevMaterial:
+			step := 1
+			if e == input.ActionPrevMaterial {
+				step = -1
+			}
+			s.source.material = s.source.material.Step(step)
+		case input.ActionStamp:
+			s.Stamp()
+		case input.ActionNextStamp:
+			if len(s.stamps) > 0 {
+				s.stamp = (s.stamp + 1) % len(s.stamps)
+			}
+		case input.ActionSymmetry:
+			s.symmetry = (s.symmetry + 1) % SYMMETRIES
+		case input.ActionCopy, input.ActionCut:
+			if !s.selection.Empty() {
+				s.clipboard = s.Copy(s.selection)
+			}
+			if e == input.ActionCut {
+				s.Delete(s.selection)
+			}
+		case input.ActionPaste:
+			s.Paste(s.clipboard, image.Point{int(s.source.p.X), int(s.source.p.Y)})
+		case input.ActionDelete:
+			s.Delete(s.selection)
+		case input.ActionSave:
+			if err := s.SaveFile(s.SavePath); err != nil {
+				simLog.Error("cannot save", "err", err)
+			} else {
+				simLog.Info("saved", "path", s.SavePath)
+			}
+		case input.ActionLoad:
+			if err := s.LoadFile(s.SavePath); err != nil {
+				simLog.Error("cannot load", "err", err)
+			}
+		case input.ActionRestore:
+			if s.restore == "" {
+				break
+			}
+			if err := s.LoadFile(s.restore); err != nil {
+				simLog.Error("cannot restore", "err", err)
+			}
+			s.restore = ""
+		case input.ActionTap:
+			s.ToggleTap(image.Point{int(s.source.p.X), int(s.source.p.Y)})
+		case input.ActionPortal:
+			s.TogglePortal(image.Point{int(s.source.p.X), int(s.source.p.Y)})
+		case input.ActionSlower, input.ActionFaster:
+			if e == input.ActionSlower {
+				s.speed = max(s.speed-1, 0)
+			} else {
+				s.speed = min(s.speed+1, len(SPEEDS)-1)
+			}
+		case input.ActionMute:
+			s.sound.Mute()
+		case input.ActionQuieter:
+			s.sound.Louder(-1)
+		case input.ActionLouder:
+			s.sound.Louder(1)
+		case input.ActionNextTrack:
+			s.sound.Music().Skip()
+		case input.ActionMusicQuieter:
+			s.sound.Music().Louder(-1)
+		case input.ActionMusicLouder:
+			s.sound.Music().Louder(1)
+		}
+	}
+}
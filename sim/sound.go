@@ -0,0 +1,168 @@
+package sim
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	SOUNDRATE   = 22050 // samples per second of the mono 16-bit PCM played
+	SOUNDBLOCKS = 50    // blocks a second the mixer writes, each adding what it heard
+	SOUNDAHEAD  = 4     // blocks written ahead of time, so the player never runs dry
+	VOLUMESTEP  = 10    // percent the volume keys change it by
+)
+
+// Sound is one of the noises the mixer makes.
+type Sound uint8
+
+const (
+	SoundPour   Sound = iota // particles spawned by tools and emitters
+	SoundSettle              // grains coming to rest
+	SoundSplash              // water coming to rest
+	SOUNDS
+)
+
+// voice shapes the filtered noise of a sound.
+type voice struct {
+	cutoff float64 // share of each sample taken into the low pass filter
+	high   bool    // keep what the filter takes out rather than what it lets through
+	gain   float64
+	decay  float64 // share of its level a sound keeps each block once quiet
+}
+
+var voices = [SOUNDS]voice{
+	SoundPour:   {cutoff: 0.25, gain: 0.5, decay: 0.6},
+	SoundSettle: {cutoff: 0.04, gain: 1.2, decay: 0.5},
+	SoundSplash: {cutoff: 0.3, high: true, gain: 0.6, decay: 0.7},
+}
+
+// Mixer turns the events of a simulation into noise streamed to an audio
+// player subprocess, such as aplay, as little endian signed 16-bit mono PCM
+// at SOUNDRATE. The louder a burst of events, the louder its sound. The
+// mixer runs on its own goroutine, a block at a time in step with the
+// clock.
+type Mixer struct {
+	stdin io.WriteCloser
+	music *Music // nil without tracks
+
+	heard  [SOUNDS]atomic.Int64 // events since the last block
+	volume atomic.Int32         // percent
+	muted  atomic.Bool
+}
+
+// StartSound starts the player command, split at spaces, and a mixer
+// feeding it at volume percent, with music under it if music is not nil.
+func StartSound(player string, volume int, music *Music) (*Mixer, error) {
+	args := strings.Fields(player)
+	if len(args) == 0 {
+		return nil, errors.New("no sound player")
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	m := &Mixer{stdin: stdin, music: music}
+	m.volume.Store(int32(max(min(volume, 100), 0)))
+	go m.run()
+	return m, nil
+}
+
+// Listen makes the mixer hear the events published on b.
+func (m *Mixer) Listen(b *Bus) {
+	b.Subscribe(EventSpawned, func(Event) { m.heard[SoundPour].Add(1) })
+	b.Subscribe(EventSettled, func(e Event) {
+		if e.M.Flows() {
+			m.heard[SoundSplash].Add(1)
+		} else {
+			m.heard[SoundSettle].Add(1)
+		}
+	})
+}
+
+func (m *Mixer) run() {
+	rng := rand.New(rand.NewPCG(1, 2))
+	out := make([]byte, 2*SOUNDRATE/SOUNDBLOCKS)
+	var level, want, low [SOUNDS]float64
+	ticker := time.NewTicker(time.Second / SOUNDBLOCKS)
+	defer ticker.Stop()
+	for ahead := SOUNDAHEAD; ; ahead = max(ahead-1, 0) {
+		if ahead == 0 {
+			<-ticker.C
+		}
+		for i := range want {
+			// Loudness grows with the log of the events heard, so a
+			// trickle is audible and a flood does not clip.
+			n := float64(m.heard[i].Swap(0))
+			want[i] = max(want[i]*voices[i].decay, min(math.Log2(1+n)/10, 1))
+		}
+		tune, loud := m.music.next()
+		gain := float64(m.volume.Load()) / 100
+		if m.muted.Load() {
+			gain = 0
+		}
+		for j := 0; j < len(out); j += 2 {
+			sample := 0.0
+			for i, v := range voices {
+				level[i] += (want[i] - level[i]) / 256
+				noise := 2*rng.Float64() - 1
+				low[i] += (noise - low[i]) * v.cutoff
+				x := low[i]
+				if v.high {
+					x = noise - low[i]
+				}
+				sample += x * level[i] * v.gain
+			}
+			if tune != nil {
+				sample += tune[j/2] * loud
+			}
+			s := max(min(sample*gain, 1), -1)
+			binary.LittleEndian.PutUint16(out[j:], uint16(int16(s*math.MaxInt16)))
+		}
+		if _, err := m.stdin.Write(out); err != nil {
+			soundLog.Error("player stopped", "err", err)
+			return
+		}
+	}
+}
+
+// Louder changes the volume by steps of VOLUMESTEP, lowering it if steps is
+// negative.
+func (m *Mixer) Louder(steps int) {
+	if m == nil {
+		return
+	}
+	v := max(min(int(m.volume.Load())+steps*VOLUMESTEP, 100), 0)
+	m.volume.Store(int32(v))
+	soundLog.Info("volume", "percent", v)
+}
+
+// Music returns the music the mixer plays, if any.
+func (m *Mixer) Music() *Music {
+	if m == nil {
+		return nil
+	}
+	return m.music
+}
+
+// Mute silences the mixer, or brings its sound back.
+func (m *Mixer) Mute() {
+	if m == nil {
+		return
+	}
+	muted := !m.muted.Load()
+	m.muted.Store(muted)
+	soundLog.Info("muted", "muted", muted)
+}
@@ -0,0 +1,44 @@
+package sim
+
+import "golang.org/x/mobile/event/mouse"
+
+const (
+	BRUSHRADIUS  = 8   // px
+	MINRADIUS    = 1   // px
+	TAPRADIUS    = 1   // px, of the stream a tap pours
+	MAXRADIUS    = 64  // px
+	OBSTACLELUMA = 128 // luma below which an obstacle pixel becomes wall
+	WATERFLOW    = 32  // px water may spread sideways as it settles
+)
+
+// OBJECTS
+type Source struct {
+	prev Position
+	p    Position
+	v    Velocity
+
+	radius   int
+	material Material
+	button   mouse.Button // held since the last press
+	isActive bool
+
+	tool   Tool     // selected tool for plain drags
+	anchor Position // where the current drag began
+	stroke Tool     // tool used for the current drag
+}
+
+// IsErasing reports whether the brush removes rather than places material.
+func (s *Source) IsErasing() bool {
+	return s.button == mouse.ButtonRight || s.material == Empty
+}
+
+// Resize grows or shrinks the brush by one step of the mouse wheel.
+func (s *Source) Resize(b mouse.Button) {
+	switch b {
+	case mouse.ButtonWheelUp:
+		s.radius++
+	case mouse.ButtonWheelDown:
+		s.radius--
+	}
+	s.radius = max(min(s.radius, MAXRADIUS), MINRADIUS)
+}
@@ -0,0 +1,82 @@
+package sim
+
+import (
+	"image"
+	"slices"
+
+	"github.com/jdavasligil/go-ecs"
+
+	"github.com/jdavasligil/sandbox/grid"
+)
+
+const HASHCELL = 8 // side of a spatial hash bucket; divides BAND
+
+// SpatialHash buckets particles by position so the ones in a region can be
+// found without scanning the whole world. Several falling particles may
+// share a cell, so each bucket holds a list.
+type SpatialHash struct {
+	w, h    int // buckets across and down
+	buckets [][]ecs.Entity
+}
+
+func NewSpatialHash() SpatialHash {
+	w := (grid.WIDTH + HASHCELL - 1) / HASHCELL
+	h := (grid.HEIGHT + HASHCELL - 1) / HASHCELL
+	// Give each bucket room for one particle per cell up front, so moving
+	// particles about seldom allocates.
+	const n = HASHCELL * HASHCELL
+	room := make([]ecs.Entity, w*h*n)
+	buckets := make([][]ecs.Entity, w*h)
+	for i := range buckets {
+		buckets[i] = room[i*n : i*n : (i+1)*n]
+	}
+	return SpatialHash{w: w, h: h, buckets: buckets}
+}
+
+func (h *SpatialHash) bucket(x, y int) int {
+	return x/HASHCELL + h.w*(y/HASHCELL)
+}
+
+// Insert files particle e at cell (x, y).
+func (h *SpatialHash) Insert(e ecs.Entity, x, y int) {
+	i := h.bucket(x, y)
+	h.buckets[i] = append(h.buckets[i], e)
+}
+
+// Remove drops particle e, last filed at cell (x, y).
+func (h *SpatialHash) Remove(e ecs.Entity, x, y int) {
+	b := h.buckets[h.bucket(x, y)]
+	if j := slices.Index(b, e); j >= 0 {
+		b[j] = b[len(b)-1]
+		h.buckets[h.bucket(x, y)] = b[:len(b)-1]
+	}
+}
+
+// Move refiles particle e from cell (x0, y0) to (x1, y1).
+func (h *SpatialHash) Move(e ecs.Entity, x0, y0, x1, y1 int) {
+	if h.bucket(x0, y0) != h.bucket(x1, y1) {
+		h.Remove(e, x0, y0)
+		h.Insert(e, x1, y1)
+	}
+}
+
+// Within appends to ents the particles filed in buckets overlapping r and
+// returns the result. Callers check the exact positions themselves.
+func (h *SpatialHash) Within(r image.Rectangle, ents []ecs.Entity) []ecs.Entity {
+	r = r.Intersect(image.Rect(0, 0, grid.WIDTH, grid.HEIGHT))
+	if r.Empty() {
+		return ents
+	}
+	for by := r.Min.Y / HASHCELL; by <= (r.Max.Y-1)/HASHCELL; by++ {
+		for bx := r.Min.X / HASHCELL; bx <= (r.Max.X-1)/HASHCELL; bx++ {
+			ents = append(ents, h.buckets[bx+h.w*by]...)
+		}
+	}
+	return ents
+}
+
+func (h *SpatialHash) Reset() {
+	for i := range h.buckets {
+		h.buckets[i] = h.buckets[i][:0]
+	}
+}
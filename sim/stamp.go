@@ -0,0 +1,125 @@
+package sim
+
+import (
+	"bufio"
+	"embed"
+	"fmt"
+	"image"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/jdavasligil/sandbox/grid"
+)
+
+// STAMPCHARS maps the characters of a stamp file to materials. Any other
+// character leaves its cell untouched.
+var STAMPCHARS = map[rune]Material{
+	'#': Wall,
+	'.': Sand,
+	'~': Water,
+}
+
+//go:embed stamps/*.txt
+var builtinStamps embed.FS
+
+// Stamp is a small pre-made structure placed into the world in one go.
+type Stamp struct {
+	Name  string
+	W, H  int
+	Cells []Material // row major, Empty where the stamp leaves the world alone
+}
+
+// ParseStamp reads a stamp drawn as text, one row per line, using the
+// characters of STAMPCHARS.
+func ParseStamp(name string, r io.Reader) (Stamp, error) {
+	var rows []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		rows = append(rows, strings.TrimRight(sc.Text(), " \r"))
+	}
+	if err := sc.Err(); err != nil {
+		return Stamp{}, err
+	}
+	s := Stamp{Name: name, H: len(rows)}
+	for _, row := range rows {
+		s.W = max(s.W, len([]rune(row)))
+	}
+	if s.W == 0 || s.W > grid.WIDTH || s.H > grid.HEIGHT {
+		return Stamp{}, fmt.Errorf("stamp %s: size %dx%d does not fit the world", name, s.W, s.H)
+	}
+	s.Cells = make([]Material, s.W*s.H)
+	for y, row := range rows {
+		for x, c := range []rune(row) {
+			s.Cells[x+s.W*y] = STAMPCHARS[c]
+		}
+	}
+	return s, nil
+}
+
+// LoadStamps returns the built-in stamps followed by the .txt stamps in dir,
+// if dir is not empty. Stamps are named after their files.
+func LoadStamps(dir string) ([]Stamp, error) {
+	stamps, err := readStamps(builtinStamps, "stamps")
+	if err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		user, err := readStamps(os.DirFS(dir), ".")
+		if err != nil {
+			return nil, err
+		}
+		stamps = append(stamps, user...)
+	}
+	return stamps, nil
+}
+
+func readStamps(fsys fs.FS, dir string) ([]Stamp, error) {
+	names, err := fs.Glob(fsys, path.Join(dir, "*.txt"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	stamps := make([]Stamp, 0, len(names))
+	for _, name := range names {
+		f, err := fsys.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		s, err := ParseStamp(strings.TrimSuffix(path.Base(name), ".txt"), f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		stamps = append(stamps, s)
+	}
+	return stamps, nil
+}
+
+// Stamp places the selected stamp centered on the source as a single undo
+// step, or as part of the stroke being drawn. Cells already holding material
+// are left as they are.
+func (s *Simulation) Stamp() {
+	if len(s.stamps) == 0 {
+		return
+	}
+	s.PlaceStamp(s.stamps[s.stamp], image.Point{int(s.source.p.X), int(s.source.p.Y)})
+}
+
+// PlaceStamp places st centered on p.
+func (s *Simulation) PlaceStamp(st Stamp, p image.Point) {
+	x0 := p.X - st.W/2
+	y0 := p.Y - st.H/2
+	s.Record(func() {
+		for y := 0; y < st.H; y++ {
+			for x := 0; x < st.W; x++ {
+				if m := st.Cells[x+st.W*y]; m != Empty {
+					s.SpawnCell(x0+x, y0+y, m, Velocity{})
+				}
+			}
+		}
+	})
+}
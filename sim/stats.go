@@ -0,0 +1,46 @@
+package sim
+
+import "image"
+
+// Stats are the simulation counters reported by the HUD.
+type Stats struct {
+	TPS       int // simulation ticks over the last second
+	Target    int // ticks per second at the current speed
+	Dropped   int // ticks skipped over the last second to keep up
+	Particles int // live particle entities
+	Falling   int // particles still in motion
+	Budget    int // particles the brush stops at, or 0 if unknown
+}
+
+// Status is the input state the renderer needs to draw previews.
+type Status struct {
+	Radius   int // brush radius in px
+	Material Material
+	Tool     Tool
+	Paused   bool
+	Speed    float64 // simulation speed multiplier
+	Stamp    string  // name of the selected stamp
+	Symmetry Symmetry
+
+	// Selection is the region marked by the select tool, if any.
+	Selection image.Rectangle
+
+	// Restore is set while an autosave found at startup is on offer.
+	Restore bool
+
+	// Goal sums up the challenge being played, if any, and Outcome says
+	// how it ended.
+	Goal    string
+	Outcome Outcome
+
+	// Stroke is the shape tool being dragged from Anchor, if any.
+	Stroke Tool
+	Anchor image.Point
+}
+
+// MaterialStat counts the particles of one material.
+type MaterialStat struct {
+	Material Material
+	Count    int
+	Bytes    uintptr // their share of the memory of the particle components
+}
@@ -0,0 +1,88 @@
+package sim
+
+import (
+	"math"
+
+	"github.com/jdavasligil/sandbox/grid"
+)
+
+const RADIAL = 6 // images of a stroke under radial symmetry
+
+// Symmetry repeats brush and line strokes across the world.
+type Symmetry uint8
+
+const (
+	SymmetryOff    Symmetry = iota
+	SymmetryMirror          // across the vertical center line
+	SymmetryQuad            // across both center lines
+	SymmetryRadial          // rotated RADIAL times about the center
+	SYMMETRIES              // number of symmetry modes
+)
+
+func (sym Symmetry) String() string {
+	switch sym {
+	case SymmetryOff:
+		return "off"
+	case SymmetryMirror:
+		return "mirror"
+	case SymmetryQuad:
+		return "quad"
+	case SymmetryRadial:
+		return "radial"
+	}
+	return "unknown"
+}
+
+// Transform maps a point of a stroke to one of its images.
+type Transform func(p Position) Position
+
+// Vector maps a velocity the way t maps points.
+func (t Transform) Vector(v Velocity) Velocity {
+	o := t(Position{})
+	q := t(Position{v.X, v.Y})
+	return Velocity{q.X - o.X, q.Y - o.Y}
+}
+
+// Transforms returns the maps from a stroke to each of its images, starting
+// with the identity. The slice is shared and must not be modified.
+func (sym Symmetry) Transforms() []Transform {
+	return symmetryTransforms[sym%SYMMETRIES]
+}
+
+// symmetryTransforms holds the transforms of every mode for the configured
+// world size.
+var symmetryTransforms = buildTransforms()
+
+func buildTransforms() (ts [SYMMETRIES][]Transform) {
+	for sym := range SYMMETRIES {
+		ts[sym] = sym.transforms()
+	}
+	return ts
+}
+
+func (sym Symmetry) transforms() []Transform {
+	w, h := float32(grid.WIDTH), float32(grid.HEIGHT)
+	identity := func(p Position) Position { return p }
+	flipX := func(p Position) Position { return Position{w - 1 - p.X, p.Y} }
+	flipY := func(p Position) Position { return Position{p.X, h - 1 - p.Y} }
+	switch sym {
+	case SymmetryMirror:
+		return []Transform{identity, flipX}
+	case SymmetryQuad:
+		return []Transform{identity, flipX, flipY, func(p Position) Position {
+			return flipX(flipY(p))
+		}}
+	case SymmetryRadial:
+		ts := make([]Transform, RADIAL)
+		for i := range ts {
+			sin, cos := math.Sincos(2 * math.Pi * float64(i) / RADIAL)
+			s, c := float32(sin), float32(cos)
+			ts[i] = func(p Position) Position {
+				x, y := p.X-w/2, p.Y-h/2
+				return Position{c*x - s*y + w/2, s*x + c*y + h/2}
+			}
+		}
+		return ts
+	}
+	return []Transform{identity}
+}
@@ -0,0 +1,122 @@
+package sim
+
+import (
+	"fmt"
+	"time"
+)
+
+// Stage orders the systems of a tick. Step runs the stages in order, and
+// the systems of a stage in the order they were added.
+type Stage uint8
+
+const (
+	StageInput Stage = iota // runs even while paused
+	StageSpawn
+	StageSettle
+	StagePhysics
+	StageElements // the Update systems of registered elements
+	STAGES
+)
+
+// System is a behavior run once a tick.
+type System interface {
+	Run(s *Simulation)
+}
+
+// SystemFunc adapts a function, such as a method expression of Simulation,
+// to a System.
+type SystemFunc func(s *Simulation)
+
+func (f SystemFunc) Run(s *Simulation) {
+	f(s)
+}
+
+// Scheduler runs the systems of a Simulation by stage, timing each one.
+type Scheduler struct {
+	systems []scheduled
+}
+
+// NewScheduler returns the systems of a tick.
+func NewScheduler() Scheduler {
+	var sc Scheduler
+	sc.Add("paint", StageInput, SystemFunc((*Simulation).Paint))
+	sc.Add("emit", StageSpawn, SystemFunc((*Simulation).Emit))
+	sc.Add("platforms", StageSpawn, SystemFunc((*Simulation).MovePlatforms))
+	sc.Add("fans", StageSpawn, SystemFunc((*Simulation).Blow))
+	sc.Add("conveyors", StageSpawn, SystemFunc((*Simulation).Convey))
+	sc.Add("settle", StageSettle, SystemFunc((*Simulation).Settle))
+	sc.Add("physics", StagePhysics, SystemFunc((*Simulation).ApplyPhysics))
+	sc.Add("portals", StagePhysics, SystemFunc((*Simulation).Teleport))
+	sc.Add("sensors", StagePhysics, SystemFunc((*Simulation).Sense))
+	sc.Add("goals", StagePhysics, SystemFunc((*Simulation).CheckGoals))
+	for _, e := range Elements {
+		if e.Update != nil {
+			sc.Add(e.Name, StageElements, e.Update)
+		}
+	}
+	return sc
+}
+
+type scheduled struct {
+	name  string
+	stage Stage
+	sys   System
+	off   bool
+	took  time.Duration // spent running since the last Timings
+}
+
+// Add schedules sys under name at the end of stage.
+func (sc *Scheduler) Add(name string, stage Stage, sys System) {
+	// Keep the list sorted by stage, so a stage runs as one stretch.
+	i := len(sc.systems)
+	for i > 0 && sc.systems[i-1].stage > stage {
+		i--
+	}
+	sc.systems = append(sc.systems, scheduled{})
+	copy(sc.systems[i+1:], sc.systems[i:])
+	sc.systems[i] = scheduled{name: name, stage: stage, sys: sys}
+}
+
+// Enable turns the named system on or off.
+func (sc *Scheduler) Enable(name string, on bool) error {
+	for i := range sc.systems {
+		if sc.systems[i].name == name {
+			sc.systems[i].off = !on
+			return nil
+		}
+	}
+	return fmt.Errorf("no system %q", name)
+}
+
+// Run runs the systems of stage that are turned on, carrying out the
+// commands each one queued before the next starts.
+func (sc *Scheduler) Run(s *Simulation, stage Stage) {
+	for i := range sc.systems {
+		sys := &sc.systems[i]
+		if sys.stage != stage || sys.off {
+			continue
+		}
+		start := time.Now()
+		sys.sys.Run(s)
+		s.commands.Flush(s)
+		sys.took += time.Since(start)
+	}
+}
+
+// SystemTiming is the time a system spent running.
+type SystemTiming struct {
+	Name string
+	Took time.Duration
+}
+
+// Timings writes over dst the time each system spent running since the
+// last call, in the order they run, and starts timing afresh.
+func (sc *Scheduler) Timings(dst []SystemTiming) []SystemTiming {
+	dst = dst[:0]
+	for i := range sc.systems {
+		sys := &sc.systems[i]
+		dst = append(dst, SystemTiming{sys.name, sys.took})
+		sys.took = 0
+	}
+	return dst
+}
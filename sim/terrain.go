@@ -0,0 +1,114 @@
+package sim
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+
+	"github.com/jdavasligil/sandbox/grid"
+)
+
+// Stone is the static rock generated terrain is carved from.
+var Stone Material
+
+func registerTerrain() {
+	Stone = RegisterElement(Element{Name: "stone", Color: color.RGBA{0x6e, 0x68, 0x62, 0xff}, Static: true})
+}
+
+// TOPSOIL is the greatest depth of the sand covering generated hills.
+const TOPSOIL = 16
+
+// Terrain builds a landscape of stone hills under sand, with lakes of water
+// in the valleys below sea level and winding caves underground. The same
+// seed always builds the same landscape for a world of the same size.
+//
+// Parameters are hills, how far the ground rises and falls as a share of
+// the world height; caves, the width of the caves as a share of the noise
+// carving them, or 0 for none; and sea, the height of the water from the
+// top as a share of the world height.
+func Terrain(p Params, seed uint64) (Scene, error) {
+	hills := p.Get("hills", 0.2)
+	caves := p.Get("caves", 0.03)
+	sea := p.Get("sea", 0.5)
+	if hills < 0 || hills > 0.5 || caves < 0 || caves > 0.5 || sea < 0 || sea > 1 {
+		return Scene{}, fmt.Errorf("want hills and caves from 0 to 0.5 and sea from 0 to 1")
+	}
+	h := float64(grid.HEIGHT)
+	ground := func(x int) int {
+		n := fractal(seed, float64(x)/(float64(grid.WIDTH)/4), 0)
+		return int(h * (0.5 + hills*(2*n-1)))
+	}
+	cells := make([]Material, grid.WIDTH*grid.HEIGHT)
+	level := int(h * sea)
+	for x := range grid.WIDTH {
+		top := max(ground(x), 1)
+		soil := top + int(TOPSOIL*fractal(seed+1, float64(x)/32, 0))
+		for y := level; y < top; y++ {
+			cells[x+grid.WIDTH*y] = Water
+		}
+		for y := top; y < grid.HEIGHT; y++ {
+			m := Stone
+			switch {
+			case y < soil:
+				m = Sand
+			case y > soil+TOPSOIL && y < grid.HEIGHT-TOPSOIL &&
+				math.Abs(fractal(seed+2, float64(x)/96, float64(y)/64)-0.5) < caves:
+				m = Empty
+			}
+			cells[x+grid.WIDTH*y] = m
+		}
+	}
+
+	// Each row goes in as runs of one material.
+	var sc Scene
+	for y := range grid.HEIGHT {
+		for x := 0; x < grid.WIDTH; {
+			m, x0 := cells[x+grid.WIDTH*y], x
+			for x < grid.WIDTH && cells[x+grid.WIDTH*y] == m {
+				x++
+			}
+			if m != Empty {
+				sc.Shapes = append(sc.Shapes, SceneShape{Shape: "rect", Material: m.String(), X0: x0, Y0: y, X1: x - 1, Y1: y})
+			}
+		}
+	}
+	return sc, nil
+}
+
+// fractal samples four octaves of value noise at (x, y), from 0 to 1.
+func fractal(seed uint64, x, y float64) float64 {
+	sum, amp, total := 0.0, 1.0, 0.0
+	for o := range 4 {
+		sum += amp * noise(seed+uint64(o), x, y)
+		total += amp
+		amp /= 2
+		x, y = x*2, y*2
+	}
+	return sum / total
+}
+
+// noise samples smooth value noise at (x, y), from 0 to 1, interpolating
+// random values at whole coordinates.
+func noise(seed uint64, x, y float64) float64 {
+	fx, fy := math.Floor(x), math.Floor(y)
+	ix, iy := int64(fx), int64(fy)
+	tx, ty := smooth(x-fx), smooth(y-fy)
+	lerp := func(a, b, t float64) float64 { return a + (b-a)*t }
+	top := lerp(lattice(seed, ix, iy), lattice(seed, ix+1, iy), tx)
+	bottom := lerp(lattice(seed, ix, iy+1), lattice(seed, ix+1, iy+1), tx)
+	return lerp(top, bottom, ty)
+}
+
+func smooth(t float64) float64 {
+	return t * t * (3 - 2*t)
+}
+
+// lattice returns the random value from 0 to 1 of the whole coordinates
+// (x, y), mixing them with the seed as splitmix64 does.
+func lattice(seed uint64, x, y int64) float64 {
+	z := seed ^ uint64(x)*0x9e3779b97f4a7c15 ^ uint64(y)*0xc2b2ae3d27d4eb4f
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	z ^= z >> 31
+	return float64(z>>11) / (1 << 53)
+}
@@ -0,0 +1,212 @@
+package sim
+
+import (
+	"image"
+	"slices"
+
+	"golang.org/x/mobile/event/key"
+	"golang.org/x/mobile/event/mouse"
+
+	"github.com/jdavasligil/sandbox/grid"
+)
+
+// Tool decides what a drag of the mouse does.
+type Tool uint8
+
+const (
+	ToolBrush    Tool = iota // paint continuously under the cursor
+	ToolLine                 // paint a straight line from press to release
+	ToolRect                 // fill the rectangle spanned by the drag
+	ToolEllipse              // fill the ellipse inscribed in the drag
+	ToolFill                 // flood fill the region under the release
+	ToolPick                 // select the material under the release
+	ToolSelect               // select the rectangle spanned by the drag
+	ToolBoundary             // paint boundary walls under the cursor
+	TOOLS
+)
+
+const FILLCAP = 1 << 18 // most cells a single flood fill may touch
+
+func (t Tool) String() string {
+	switch t {
+	case ToolBrush:
+		return "brush"
+	case ToolLine:
+		return "line"
+	case ToolRect:
+		return "rect"
+	case ToolEllipse:
+		return "ellipse"
+	case ToolFill:
+		return "fill"
+	case ToolPick:
+		return "pick"
+	case ToolSelect:
+		return "select"
+	case ToolBoundary:
+		return "boundary"
+	}
+	return "unknown"
+}
+
+// StrokeTool returns the tool used for a drag started by the press e when
+// tool is selected. Holding alt picks a material and shift draws a line.
+func StrokeTool(e mouse.Event, tool Tool) Tool {
+	if e.Modifiers&key.ModAlt != 0 {
+		return ToolPick
+	}
+	if e.Modifiers&key.ModShift != 0 {
+		return ToolLine
+	}
+	return tool
+}
+
+// Line calls plot for every cell on the line from (x0, y0) to (x1, y1).
+func Line(x0, y0, x1, y1 int, plot func(x, y int)) {
+	dx := abs(x1 - x0)
+	dy := -abs(y1 - y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	// Bresenham's algorithm for all octants.
+	err := dx + dy
+	for {
+		plot(x0, y0)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// Span returns the cells covered by a drag from a to b, inclusive.
+func Span(a, b image.Point) image.Rectangle {
+	r := image.Rectangle{a, b}.Canon()
+	r.Max = r.Max.Add(image.Point{1, 1})
+	return r
+}
+
+// InEllipse reports whether (x, y) lies in the ellipse inscribed in r.
+func InEllipse(r image.Rectangle, x, y int) bool {
+	rx := float64(r.Dx()) / 2
+	ry := float64(r.Dy()) / 2
+	dx := (float64(x) + 0.5 - float64(r.Min.X) - rx) / rx
+	dy := (float64(y) + 0.5 - float64(r.Min.Y) - ry) / ry
+	return dx*dx+dy*dy <= 1
+}
+
+// ApplyStroke performs the shape tool of a released drag, from the press
+// point to the source, erasing instead if the brush is erasing.
+func (s *Simulation) ApplyStroke() {
+	source, g := &s.source, &s.grid
+	a := image.Point{int(source.anchor.X), int(source.anchor.Y)}
+	b := image.Point{int(source.p.X), int(source.p.Y)}
+	switch source.stroke {
+	case ToolPick:
+		if b.In(g.Bounds()) && g.IsSet(b.X, b.Y) && slices.Contains(Materials, g.At(b.X, b.Y).Unlit()) {
+			source.material = g.At(b.X, b.Y).Unlit()
+		}
+	case ToolSelect:
+		// A click without a drag clears the selection.
+		s.selection = image.Rectangle{}
+		if a != b {
+			s.selection = Span(a, b).Intersect(g.Bounds())
+		}
+	case ToolLine:
+		for _, t := range s.symmetry.Transforms() {
+			ta, tb := t(source.anchor), t(source.p)
+			Line(int(ta.X), int(ta.Y), int(tb.X), int(tb.Y), func(x, y int) {
+				if source.IsErasing() {
+					s.EraseDisc(x, y, source.radius)
+				} else {
+					s.SpawnDisc(x, y, source.radius, source.material, Velocity{})
+				}
+			})
+		}
+	case ToolRect, ToolEllipse:
+		r := Span(a, b)
+		inside := func(x, y int) bool {
+			return source.stroke == ToolRect || InEllipse(r, x, y)
+		}
+		if source.IsErasing() {
+			s.EraseRegion(r, inside)
+			return
+		}
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if inside(x, y) {
+					s.SpawnCell(x, y, source.material, Velocity{})
+				}
+			}
+		}
+	case ToolFill:
+		if !b.In(g.Bounds()) {
+			return
+		}
+		target := g.At(b.X, b.Y)
+		if source.IsErasing() == (target == Empty) {
+			// Nothing to erase, or nowhere to fill.
+			return
+		}
+		region, bounds := FloodRegion(g, b, target)
+		if source.IsErasing() {
+			s.EraseRegion(bounds, func(x, y int) bool {
+				return region[x+grid.WIDTH*y]
+			})
+			return
+		}
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				if region[x+grid.WIDTH*y] {
+					s.SpawnCell(x, y, source.material, Velocity{})
+				}
+			}
+		}
+	}
+}
+
+// FloodRegion marks the cells of material m connected to p, up to FILLCAP of
+// them, and returns the mask along with its bounds.
+func FloodRegion(g *MaterialGrid, p image.Point, m Material) ([]bool, image.Rectangle) {
+	region := make([]bool, grid.WIDTH*grid.HEIGHT)
+	queue := []image.Point{p}
+	region[p.X+grid.WIDTH*p.Y] = true
+	bounds := image.Rectangle{p, p.Add(image.Point{1, 1})}
+	for n := 1; len(queue) > 0; {
+		c := queue[0]
+		queue = queue[1:]
+		for _, d := range [4]image.Point{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+			q := c.Add(d)
+			if !q.In(g.Bounds()) || region[q.X+grid.WIDTH*q.Y] || g.At(q.X, q.Y) != m {
+				continue
+			}
+			if n == FILLCAP {
+				return region, bounds
+			}
+			region[q.X+grid.WIDTH*q.Y] = true
+			bounds = bounds.Union(image.Rectangle{q, q.Add(image.Point{1, 1})})
+			queue = append(queue, q)
+			n++
+		}
+	}
+	return region, bounds
+}
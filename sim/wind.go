@@ -0,0 +1,92 @@
+package sim
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/jdavasligil/go-ecs"
+)
+
+const (
+	FANRANGE = 48  // cells a fan blows across
+	FANFORCE = 980 // px/s/s, twice the default gravity so fans can lift sand
+)
+
+// Fans are static materials that blow the particles in front of them, up to
+// FANRANGE cells or the first wall. A block of fan cells blows from its
+// front face only, so stacking them makes a wider fan, not a stronger one.
+var FanUp, FanDown, FanLeft, FanRight Material
+
+func registerFans() {
+	fan := func(name string, d image.Point, c color.RGBA) Material {
+		return RegisterElement(Element{Name: name, Color: c, Static: true, Blows: d})
+	}
+	FanUp = fan("fan-up", image.Point{0, -1}, color.RGBA{0x5a, 0x8c, 0xa8, 0xff})
+	FanDown = fan("fan-down", image.Point{0, 1}, color.RGBA{0x4a, 0x74, 0x8c, 0xff})
+	FanLeft = fan("fan-left", image.Point{-1, 0}, color.RGBA{0x6a, 0x8c, 0x9e, 0xff})
+	FanRight = fan("fan-right", image.Point{1, 0}, color.RGBA{0x3e, 0x66, 0x7a, 0xff})
+}
+
+// Blows returns the direction the wind of material m blows, or zero if m is
+// not a fan.
+func (m Material) Blows() image.Point {
+	return Elements[m].Blows
+}
+
+// IsFan reports whether material m blows.
+func (m Material) IsFan() bool {
+	return m.Blows() != (image.Point{})
+}
+
+// Blow pushes the particles in front of each fan, waking those resting in
+// its way unless it blows them down onto what holds them.
+func (s *Simulation) Blow() {
+	if s.staticStale {
+		s.relist()
+	}
+	for _, f := range s.fans {
+		m := s.grid.At(f.X, f.Y)
+		d := m.Blows()
+		if q := f.Add(d); !m.IsFan() || q.In(s.grid.Bounds()) && s.grid.At(q.X, q.Y) == m {
+			continue
+		}
+		end := f
+		for n := 0; n < FANRANGE; n++ {
+			q := end.Add(d)
+			if !q.In(s.grid.Bounds()) || s.grid.At(q.X, q.Y).IsStatic() {
+				break
+			}
+			end = q
+		}
+		if end == f {
+			continue
+		}
+		ray := image.Rectangle{f.Add(d), end}.Canon()
+		ray.Max = ray.Max.Add(image.Point{1, 1})
+		dv := Velocity{float32(d.X) * FANFORCE * DELTA, float32(d.Y) * FANFORCE * DELTA}
+		for _, e := range s.particlesAt(ray) {
+			if _, falling := ecs.Get[Falling](&s.world, e); !falling {
+				if d.Y > 0 {
+					continue
+				}
+				s.wake(e)
+			}
+			v, _ := ecs.GetMut[Velocity](&s.world, e)
+			v.X = max(min(v.X+dv.X, MAXVEL), -MAXVEL)
+			v.Y = max(min(v.Y+dv.Y, MAXVEL), -MAXVEL)
+		}
+	}
+}
+
+// wake sets resting particle e falling again.
+func (s *Simulation) wake(e ecs.Entity) {
+	p, _ := ecs.Get[Position](&s.world, e)
+	x, y := int(p.X), int(p.Y)
+	s.col.Clear(x, y)
+	s.chunks.Wake(x, y)
+	ecs.Add(&s.world, e, Falling{})
+	if s.bus.Wants(EventWoken) {
+		m, _ := ecs.Get[Material](&s.world, e)
+		s.bus.Publish(Event{EventWoken, e, x, y, m})
+	}
+}
@@ -0,0 +1,167 @@
+package sim
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/jdavasligil/go-ecs"
+)
+
+// WorldComponent is a component type written by SaveWorld. Its values are
+// saved as fixed size little-endian records.
+type WorldComponent struct {
+	Name string
+	size int // bytes per value
+	save func(w io.Writer, world *ecs.World, ents []ecs.Entity) error
+	load func(r io.Reader, world *ecs.World, ents []ecs.Entity, n int) error
+}
+
+// WorldComponents lists the components saved with each entity. Add new
+// components to the end; loaders skip components they do not know, so
+// saves stay readable both ways.
+var WorldComponents = []WorldComponent{
+	Column[Position]("position"),
+	Column[Velocity]("velocity"),
+	Column[Material]("material"),
+	Column[Falling]("falling"),
+}
+
+// Column returns the WorldComponent storing components of type T, which
+// must have a fixed size, under name.
+func Column[T ecs.Component](name string) WorldComponent {
+	var zero T
+	return WorldComponent{
+		Name: name,
+		size: binary.Size(zero),
+		save: func(w io.Writer, world *ecs.World, ents []ecs.Entity) error {
+			var index []uint32
+			var values []T
+			for i, e := range ents {
+				if v, ok := ecs.Get[T](world, e); ok {
+					index = append(index, uint32(i))
+					values = append(values, v)
+				}
+			}
+			out := []any{uint32(len(index)), index, values}
+			if len(index) == len(ents) {
+				out = []any{uint32(len(index)), values}
+			}
+			for _, data := range out {
+				if err := binary.Write(w, binary.LittleEndian, data); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		load: func(r io.Reader, world *ecs.World, ents []ecs.Entity, n int) error {
+			index := make([]uint32, n)
+			values := make([]T, n)
+			in := []any{index, values}
+			if n == len(ents) {
+				for i := range index {
+					index[i] = uint32(i)
+				}
+				in = []any{values}
+			}
+			for _, data := range in {
+				if err := binary.Read(r, binary.LittleEndian, data); err != nil {
+					return err
+				}
+			}
+			for i, at := range index {
+				if int(at) >= len(ents) {
+					return fmt.Errorf("%s of entity %d, of %d", name, at, len(ents))
+				}
+				ecs.Add(world, ents[at], values[i])
+			}
+			return nil
+		},
+	}
+}
+
+// SaveWorld writes the entities ents of world to w with their
+// WorldComponents. Each component is a column of the entities that have
+// it, so a loaded world holds the same entities in the same order:
+//
+//	uint32 entities, uint32 components
+//	for each component:
+//		uint8 name length, name, uint32 value size, uint32 count
+//		count uint32 entity indices, left out if every entity has it
+//		count values
+func SaveWorld(w io.Writer, world *ecs.World, ents []ecs.Entity) error {
+	for _, data := range []any{uint32(len(ents)), uint32(len(WorldComponents))} {
+		if err := binary.Write(w, binary.LittleEndian, data); err != nil {
+			return err
+		}
+	}
+	for _, c := range WorldComponents {
+		head := []any{uint8(len(c.Name)), []byte(c.Name), uint32(c.size)}
+		for _, data := range head {
+			if err := binary.Write(w, binary.LittleEndian, data); err != nil {
+				return err
+			}
+		}
+		if err := c.save(w, world, ents); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadWorld creates the entities saved by SaveWorld in world and returns
+// them in their saved order. Components not in WorldComponents are skipped.
+// No more than limit entities are read.
+func LoadWorld(r io.Reader, world *ecs.World, limit int) ([]ecs.Entity, error) {
+	var n, components uint32
+	for _, data := range []any{&n, &components} {
+		if err := binary.Read(r, binary.LittleEndian, data); err != nil {
+			return nil, err
+		}
+	}
+	if int(n) > limit {
+		return nil, fmt.Errorf("world of %d entities is too large", n)
+	}
+	known := make(map[string]WorldComponent)
+	for _, c := range WorldComponents {
+		known[c.Name] = c
+	}
+	ents := make([]ecs.Entity, n)
+	for i := range ents {
+		ents[i] = world.NewEntity()
+	}
+	for range components {
+		var length uint8
+		if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+			return nil, err
+		}
+		name := make([]byte, length)
+		var size, count uint32
+		for _, data := range []any{name, &size, &count} {
+			if err := binary.Read(r, binary.LittleEndian, data); err != nil {
+				return nil, err
+			}
+		}
+		if count > n {
+			return nil, fmt.Errorf("%d %s for %d entities", count, name, n)
+		}
+		c, ok := known[string(name)]
+		if !ok {
+			skip := int64(count) * int64(size)
+			if count < n {
+				skip += 4 * int64(count)
+			}
+			if _, err := io.CopyN(io.Discard, r, skip); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if int(size) != c.size {
+			return nil, fmt.Errorf("%s is %d bytes, want %d", name, size, c.size)
+		}
+		if err := c.load(r, world, ents, int(count)); err != nil {
+			return nil, err
+		}
+	}
+	return ents, nil
+}